@@ -14,7 +14,7 @@ const PEER_ENDPOINT = process.env.PEER_ENDPOINT || 'localhost:7051';
 const PEER_HOST_ALIAS = process.env.PEER_HOST_ALIAS || 'peer0.org1.example.com';
 
 const CERT_PATH = path.resolve(__dirname, process.env.CERT_PATH || '../fabric-samples/test-network/organizations/peerOrganizations/org1.example.com/users/User1@org1.example.com/msp/signcerts/cert.pem');
-const KEY_DIR_PATH = path.resolve(__dirname, '../fabric-samples/test-network/organizations/peerOrganizations/org1.example.com/users/User1@org1.example.com/msp/keystore');
+const KEY_DIR_PATH = path.resolve(__dirname, process.env.KEY_DIR_PATH || '../fabric-samples/test-network/organizations/peerOrganizations/org1.example.com/users/User1@org1.example.com/msp/keystore');
 const TLS_CERT_PATH = path.resolve(__dirname, process.env.TLS_CERT_PATH || '../fabric-samples/test-network/organizations/peerOrganizations/org1.example.com/peers/peer0.org1.example.com/tls/ca.crt');
 
 /**
@@ -57,8 +57,47 @@ function parseChainResult(result) {
     return JSON.parse(new TextDecoder().decode(result));
 }
 
+/**
+ * Map chaincode error codes to HTTP statuses
+ */
+function statusForCode(code) {
+    if (code.endsWith('_NOT_FOUND')) return 404;
+    if (code === 'UNAUTHENTICATED') return 401;
+    if (code === 'FORBIDDEN') return 403;
+    if (code === 'VERSION_CONFLICT' || code === 'ALREADY_EXISTS') return 409;
+    if (code.startsWith('INVALID_') || code === 'VALIDATION_FAILED') return 400;
+    if (code === 'CHAINCODE_ERROR') return 500;
+    return 422;
+}
+
+/**
+ * Utility to parse chaincode errors into { status, body }. The chaincode returns a
+ * JSON envelope of code, message, entity and field; the gateway passes it on in the
+ * error details of the endorsing peers.
+ */
+function parseChainError(error) {
+    const messages = (error.details || []).map(d => d.message).concat(error.message);
+    for (const message of messages) {
+        const start = message ? message.indexOf('{') : -1;
+        if (start < 0) continue;
+        try {
+            const envelope = JSON.parse(message.slice(start));
+            if (envelope.code) {
+                return {
+                    status: statusForCode(envelope.code),
+                    body: { error: envelope.message, code: envelope.code, entity: envelope.entity, field: envelope.field, errors: envelope.errors },
+                };
+            }
+        } catch (e) {
+            // not an envelope; try the next message
+        }
+    }
+    return { status: 500, body: { error: error.message, code: 'CHAINCODE_ERROR' } };
+}
+
 module.exports = {
     connect: connectToGateway,
     hashPassword,
-    parseChainResult
+    parseChainResult,
+    parseChainError
 };
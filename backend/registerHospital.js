@@ -21,7 +21,7 @@ async function registerHospital(id, name, password, location) {
 
 const args = process.argv.slice(2);
 if (args.length < 4) {
-    console.log('Usage: node registerHospital.js <ID> <Name> <Password> <Location>');
+    console.log('Usage: node registerHospital.js <ID> <Name> <Password> <Location>   (ID must start with HOSP-)');
 } else {
     registerHospital(...args);
 }
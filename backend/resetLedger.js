@@ -8,7 +8,8 @@ async function resetLedger() {
         client = cl;
 
         console.log('--- Resetting Ledger (4x4 Initial Data) ---');
-        await contract.submitTransaction('ClearLedger');
+        // ClearLedger only runs on dev networks and needs the channel name as confirmation.
+        await contract.submitTransaction('ClearLedger', process.env.CHANNEL_NAME || 'organchannel');
         await contract.submitTransaction('InitLedger');
         console.log('✅ Ledger successfully re-seeded with 4 Patients and 4 Donors.');
 
@@ -6,7 +6,8 @@ const cors = require('cors');
 const bodyParser = require("body-parser");
 const session = require('express-session');
 const path = require('path');
-const { connect, parseChainResult } = require('./gatewayConnection');
+const crypto = require('crypto');
+const { connect, parseChainResult, parseChainError } = require('./gatewayConnection');
 
 const app = express();
 const PORT = process.env.PORT || 3001;
@@ -25,6 +26,34 @@ app.use(session({
 
 let gateway, client, contract;
 
+// Donor email and phone are encrypted on chain with this hospital's AES-256 key
+// (64 hex characters), which travels only in the transient map.
+function withPiiKey(transientData) {
+    if (process.env.PII_ENCRYPTION_KEY) {
+        transientData.pii_key = Buffer.from(process.env.PII_ENCRYPTION_KEY, 'hex');
+    }
+    return transientData;
+}
+
+// National IDs reach the ledger only as an HMAC-SHA256 under NATIONAL_ID_HASH_KEY, so
+// they cannot be recovered by hashing every possible ID. Every hospital's backend must
+// use the same key for duplicate donors and multi-listed patients to be caught across
+// hospitals.
+function hashNationalId(nationalId) {
+    if (!nationalId) {
+        return '';
+    }
+    const normalized = String(nationalId).replace(/[\s-]/g, '').toUpperCase();
+    return crypto.createHmac('sha256', process.env.NATIONAL_ID_HASH_KEY || '').update(normalized).digest('hex');
+}
+
+// Chaincode failures carry a code (e.g. DONOR_NOT_FOUND) that the frontend maps to
+// its own messages; pass it on with a matching HTTP status.
+function sendChainError(res, error) {
+    const { status, body } = parseChainError(error);
+    res.status(status).json(body);
+}
+
 // --- FABRIC CONNECTION ---
 async function startServer() {
     try {
@@ -49,19 +78,159 @@ app.get('/api/health', (req, res) => res.json({ status: 'ok', connected: !!contr
 
 app.get('/api/patients', async (req, res) => {
     try {
-        const result = await contract.evaluateTransaction('GetAllPatients');
+        const { pageSize, bookmark } = req.query;
+        const result = pageSize
+            ? await contract.evaluateTransaction('GetAllPatientsPaginated', String(pageSize), bookmark || '')
+            : await contract.evaluateTransaction('GetAllPatients');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Waiting patients for one organ, optionally of one blood type and in another status.
+app.get('/api/patients/waiting', async (req, res) => {
+    try {
+        const { organ, bloodType, status } = req.query;
+        const result = await contract.evaluateTransaction('QueryWaitingPatients', organ || '', bloodType || '', status || '');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// One organ's waitlist as a CSV file for spreadsheets.
+app.get('/api/patients/waitlist.csv', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetWaitlistCSV', req.query.organ || '');
+        res.attachment(`waitlist-${req.query.organ}.csv`);
+        res.type('text/csv').send(Buffer.from(result).toString());
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// People listed for the same organ at more than one hospital, optionally for one organ.
+app.get('/api/patients/multi-listings', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('DetectMultiListings', req.query.organ || '');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Verified donors with an organ available, optionally of one blood type.
+app.get('/api/donors/available', async (req, res) => {
+    try {
+        const { organ, bloodType } = req.query;
+        const result = await contract.evaluateTransaction('QueryDonorsByOrgan', organ || '', bloodType || '');
         res.json(parseChainResult(result));
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
     }
 });
 
 app.get('/api/donors', async (req, res) => {
     try {
-        const result = await contract.evaluateTransaction('GetAllDonors');
+        const { pageSize, bookmark } = req.query;
+        const result = pageSize
+            ? await contract.evaluateTransaction('GetAllDonorsPaginated', String(pageSize), bookmark || '')
+            : await contract.evaluateTransaction('GetAllDonors');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/patients/:id/matches', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('FindMatchesForPatient', req.params.id);
         res.json(parseChainResult(result));
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/organs', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetDonorOrgans', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/organs/:id/custody', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetCustodyChain', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/organs/:id/viability', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetOrganViability', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/stats', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetLedgerStats');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/stats/transplants', async (req, res) => {
+    try {
+        const { granularity, from, to } = req.query;
+        const result = await contract.evaluateTransaction('GetTransplantStats', granularity || '', from || '', to || '');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/hospitals/:id/dashboard', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetHospitalDashboard', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// FHIR R4 exports for hospital EHR systems.
+const sendFhir = (res, result) => res.type('application/fhir+json').send(Buffer.from(result).toString());
+
+app.get('/api/patients/:id/fhir', async (req, res) => {
+    try {
+        sendFhir(res, await contract.evaluateTransaction('ExportPatientFHIR', req.params.id));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/fhir', async (req, res) => {
+    try {
+        sendFhir(res, await contract.evaluateTransaction('ExportDonorFHIR', req.params.id));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/hospitals/:id/fhir', async (req, res) => {
+    try {
+        sendFhir(res, await contract.evaluateTransaction('ExportHospitalFHIR', req.params.id));
+    } catch (error) {
+        sendChainError(res, error);
     }
 });
 
@@ -77,50 +246,712 @@ app.post('/api/auth/login', async (req, res) => {
 
 app.post('/api/patients', async (req, res) => {
     try {
-        const { id, nameHash, bloodType, hla, organNeeded, hospitalId } = req.body;
-        await contract.submitTransaction('CreatePatient', id, nameHash, bloodType, hla, organNeeded, '', hospitalId);
+        const { id, nameHash, bloodType, hla, organNeeded, urgency, nationalId } = req.body;
+        await contract.submitTransaction('CreatePatient', id, nameHash, bloodType, hla, organNeeded, '', urgency || '', hashNationalId(nationalId));
         res.json({ success: true, id });
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
+    }
+});
+
+// Batch routes create each valid record and report the rest per item in one transaction.
+app.post('/api/patients/batch', async (req, res) => {
+    try {
+        const records = (req.body.records || []).map(({ id, nameHash, bloodType, hla, organNeeded, urgency, nationalId }) => ({
+            id, nameHash, bloodType, hla, organNeeded, urgency: urgency || '', identityHash: hashNationalId(nationalId),
+        }));
+        const result = await contract.submitTransaction('CreatePatientsBatch', JSON.stringify(records));
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Corrections to a patient's record; `changes` may hold nameHash, nationalId, bloodType, hla and ipfsHash.
+app.put('/api/patients/:id', async (req, res) => {
+    try {
+        const { changes = {}, reason } = req.body;
+        const update = { ...changes };
+        if (update.nationalId !== undefined) {
+            update.identityHash = update.nationalId ? hashNationalId(update.nationalId) : '';
+            delete update.nationalId;
+        }
+        const result = await contract.submitTransaction('UpdatePatient', req.params.id, JSON.stringify(update), reason || '',
+            String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/urgency', async (req, res) => {
+    try {
+        const { urgency, reason } = req.body;
+        const result = await contract.submitTransaction('SetPatientUrgency', req.params.id, urgency, reason || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/escalate', async (req, res) => {
+    try {
+        const { urgency, justificationHash } = req.body;
+        const result = await contract.submitTransaction('EscalatePatient', req.params.id, urgency || '', justificationHash || '');
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/score', async (req, res) => {
+    try {
+        const { scoreType, score } = req.body;
+        const result = await contract.submitTransaction('UpdateClinicalScore', req.params.id, scoreType, String(score), String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, score: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/patients/:id/scores', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetClinicalScoreHistory', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/liver-allocation', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetLiverAllocation', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/deactivate', async (req, res) => {
+    try {
+        const { reason } = req.body;
+        const result = await contract.submitTransaction('DeactivatePatient', req.params.id, reason || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/reactivate', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('ReactivatePatient', req.params.id, String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Transfers take two steps: the current hospital initiates, the receiving hospital
+// accepts. Either may cancel a pending transfer.
+app.post('/api/patients/:id/transfer', async (req, res) => {
+    try {
+        const { toHospitalId, reason } = req.body;
+        const result = await contract.submitTransaction('InitiateTransfer', req.params.id, toHospitalId, reason || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/transfer/accept', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('AcceptTransfer', req.params.id, String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/transfer/cancel', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('CancelTransfer', req.params.id, String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/remove', async (req, res) => {
+    try {
+        const { reasonCode, reason, removedAt } = req.body;
+        const result = await contract.submitTransaction('RemovePatientFromWaitlist', req.params.id, reasonCode || '', reason || '',
+            removedAt || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, patient: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/patients/:id/sensitization', async (req, res) => {
+    try {
+        const { cpra, unacceptableAntigens } = req.body;
+        let version = req.body.expectedVersion ?? 0;
+        let result;
+        if (cpra !== undefined) {
+            result = await contract.submitTransaction('UpdatePatientCPRA', req.params.id, String(cpra), String(version));
+            version = parseChainResult(result).version;
+        }
+        if (unacceptableAntigens !== undefined) {
+            result = await contract.submitTransaction('SetUnacceptableAntigens', req.params.id, JSON.stringify(unacceptableAntigens), String(version));
+        }
+        res.json({ success: true, patient: result ? parseChainResult(result) : null });
+    } catch (error) {
+        sendChainError(res, error);
     }
 });
 
 app.post('/api/donors', async (req, res) => {
     try {
-        const { id, name, email, phone, bloodType, hla, organsAvailable, consentHash } = req.body;
-        await contract.submitTransaction('CreateDonor', id, name || '', email || '', phone || '', bloodType, hla, JSON.stringify(organsAvailable), '', consentHash);
+        const { id, name, email, phone, bloodType, hla, organsAvailable, consentHash, donorType, donorDetails, nationalId } = req.body;
+        const donorPII = JSON.stringify({ name: name || '', email: email || '', phone: phone || '' });
+        await contract.submit('CreateDonor', {
+            arguments: [id, bloodType, hla, JSON.stringify(organsAvailable), '', consentHash, donorType || '', JSON.stringify(donorDetails || {}), hashNationalId(nationalId)],
+            transientData: withPiiKey({ donor_pii: Buffer.from(donorPII) }),
+        });
         res.json({ success: true, id });
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/batch', async (req, res) => {
+    try {
+        // PII travels as transient data keyed by donor ID and never reaches the ledger.
+        const donorPII = {};
+        const records = (req.body.records || []).map(({ id, name, email, phone, bloodType, hla, organsAvailable, consentHash, donorType, donorDetails, nationalId }) => {
+            donorPII[id] = { name: name || '', email: email || '', phone: phone || '' };
+            return {
+                id, bloodType, hla, organsAvailable, consentHash: consentHash || '', donorType: donorType || '', details: donorDetails || {},
+                nationalIdHash: hashNationalId(nationalId),
+            };
+        });
+        const result = await contract.submit('CreateDonorsBatch', {
+            arguments: [JSON.stringify(records)],
+            transientData: withPiiKey({ donor_pii: Buffer.from(JSON.stringify(donorPII)) }),
+        });
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Imports are all-or-nothing; dryRun only reports what would be accepted.
+app.post('/api/import', async (req, res) => {
+    try {
+        const donorPII = {};
+        const rows = (req.body.rows || []).map(({ docType, record }) => {
+            if (docType === 'patient' && record) {
+                const { nationalId, ...rest } = record;
+                return { docType, record: { ...rest, identityHash: hashNationalId(nationalId) } };
+            }
+            if (docType !== 'donor' || !record) {
+                return { docType, record };
+            }
+            const { name, email, phone, donorDetails, nationalId, ...rest } = record;
+            donorPII[record.id] = { name: name || '', email: email || '', phone: phone || '' };
+            return { docType, record: { ...rest, details: donorDetails || {}, nationalIdHash: hashNationalId(nationalId) } };
+        });
+        const result = await contract.submit('ImportRecords', {
+            arguments: [JSON.stringify(rows), String(Boolean(req.body.dryRun))],
+            transientData: withPiiKey({ donor_pii: Buffer.from(JSON.stringify(donorPII)) }),
+        });
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Patients and donors are archived rather than deleted; auditors can list them.
+app.post('/api/records/:id/archive', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('ArchiveRecord', req.params.id, req.body.reason);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/archived', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetArchivedRecords', req.query.docType || '');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// A record's audit trail, optionally between two dates (YYYY-MM-DD or RFC 3339).
+app.get('/api/audit/:recordType/:recordId', async (req, res) => {
+    try {
+        const { from, to, pageSize, bookmark } = req.query;
+        const result = await contract.evaluateTransaction('GetAuditTrail', req.params.recordType, req.params.recordId, from || '', to || '', String(pageSize || 50), bookmark || '');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/audit/:recordType/:recordId/export', async (req, res) => {
+    try {
+        const { from, to } = req.query;
+        const result = await contract.evaluateTransaction('ExportAuditBundle', req.params.recordType, req.params.recordId, from || '', to || '');
+        res.attachment(`audit-${req.params.recordType}-${req.params.recordId}.json`);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Only researcher identities may export; the gateway identity must carry role=researcher.
+app.get('/api/research/dataset', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('ExportResearchDataset');
+        res.attachment('research-dataset.json');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Generates and records a national registry submission; the gateway identity must be
+// a network admin. ?download=1 returns the flat file itself.
+app.post('/api/registry/submissions', async (req, res) => {
+    try {
+        const result = parseChainResult(await contract.submitTransaction('CreateRegistrySubmission'));
+        if (req.query.download) {
+            res.attachment(`${result.submission.id}.txt`);
+            return res.type('text/plain').send(result.file);
+        }
+        res.json(result);
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/registry/submissions/:id', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetRegistrySubmission', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Matches for one patient, donor or creating hospital, or every match with no filter.
+app.get('/api/matches', async (req, res) => {
+    try {
+        const { patientId, donorId, hospitalId } = req.query;
+        let result;
+        if (patientId) result = await contract.evaluateTransaction('GetMatchesByPatient', patientId);
+        else if (donorId) result = await contract.evaluateTransaction('GetMatchesByDonor', donorId);
+        else if (hospitalId) result = await contract.evaluateTransaction('GetMatchesByHospital', hospitalId);
+        else result = await contract.evaluateTransaction('GetAllMatches');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
     }
 });
 
 app.post('/api/matches', async (req, res) => {
     try {
-        const { id, patientId, donorId, organType, hlaScore, approvedBy } = req.body;
-        await contract.submitTransaction('CreateMatch', id, patientId, donorId, organType, hlaScore, approvedBy);
-        res.json({ success: true, id });
+        const { id, patientId, donorId, organType } = req.body;
+        const result = await contract.submitTransaction('CreateMatch', id || '', patientId, donorId, organType);
+        const match = parseChainResult(result);
+        res.json({ success: true, id: match.matchId, match });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/matches/:id/approve', async (req, res) => {
+    try {
+        await contract.submitTransaction('ApproveMatch', req.params.id, String(req.body.expectedVersion ?? 0));
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/matches/:id/reject', async (req, res) => {
+    try {
+        const { reasonCode, reason } = req.body;
+        await contract.submitTransaction('RejectMatch', req.params.id, reasonCode, reason || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/matches/:id/cancel', async (req, res) => {
+    try {
+        const { reasonCode, reason } = req.body;
+        await contract.submitTransaction('CancelMatch', req.params.id, reasonCode, reason || '', String(req.body.expectedVersion ?? 0));
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/matches/:id/crossmatch', async (req, res) => {
+    try {
+        const { resultType, labId, result } = req.body;
+        const match = await contract.submitTransaction('RecordCrossmatchResult', req.params.id, resultType, labId, result);
+        res.json({ success: true, match: parseChainResult(match) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/matches/:id/transplant', async (req, res) => {
+    try {
+        const { surgeon, transplantDate, coldIschemiaMinutes } = req.body;
+        const result = await contract.submitTransaction('ConfirmTransplant', req.params.id, surgeon, transplantDate, String(coldIschemiaMinutes ?? 0));
+        res.json({ success: true, transplant: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/offers', async (req, res) => {
+    try {
+        const { donorId, organType, expiryMinutes } = req.body;
+        const result = await contract.submitTransaction('OfferOrgan', donorId, organType, String(expiryMinutes || 60));
+        res.json({ success: true, offer: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/offers/:id/accept', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('AcceptOffer', req.params.id);
+        res.json({ success: true, match: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/offers/:id/decline', async (req, res) => {
+    try {
+        const { reasonCode, reason } = req.body;
+        const result = await contract.submitTransaction('DeclineOffer', req.params.id, reasonCode, reason || '');
+        res.json({ success: true, nextOffer: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/offers/:id/expire', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('ExpireOffer', req.params.id);
+        res.json({ success: true, nextOffer: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/exchange/pairs', async (req, res) => {
+    try {
+        const { id, patientId, donorId } = req.body;
+        await contract.submitTransaction('RegisterExchangePair', id, patientId, donorId);
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/exchange/cycles', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('FindExchangeCycles');
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/exchange/chains', async (req, res) => {
+    try {
+        const { id, pairIds } = req.body;
+        const result = await contract.submitTransaction('ProposeExchangeChain', id, JSON.stringify(pairIds || []));
+        res.json({ success: true, chain: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/exchange/chains/:id/approve', async (req, res) => {
+    try {
+        const { pairId } = req.body;
+        const result = await contract.submitTransaction('ApproveExchangeChain', req.params.id, pairId);
+        res.json({ success: true, chain: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/exchange/chains/:id/reject', async (req, res) => {
+    try {
+        const { pairId, reason } = req.body;
+        await contract.submitTransaction('RejectExchangeChain', req.params.id, pairId, reason || '');
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/classify', async (req, res) => {
+    try {
+        const { donorType, donorDetails } = req.body;
+        await contract.submitTransaction('ClassifyDonor', req.params.id, donorType, JSON.stringify(donorDetails || {}));
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/death-declaration', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetDeathDeclaration', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Must be submitted by a physician-role identity; two different physicians confirm a death.
+app.post('/api/donors/:id/death-declaration/attest', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('AttestDeath', req.params.id);
+        res.json({ success: true, declaration: parseChainResult(result) });
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/recipient', async (req, res) => {
+    try {
+        const { patientId } = req.body;
+        const result = await contract.submitTransaction('DirectDonorToRecipient', req.params.id, patientId || '');
+        res.json({ success: true, donor: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/patients/:id/directed-donors', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetDirectedDonors', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/consent', async (req, res) => {
+    try {
+        const { documentHash, signedAt, expiresAt, scope } = req.body;
+        const result = await contract.submitTransaction('RecordConsent', req.params.id, documentHash, signedAt, expiresAt || '', JSON.stringify(scope || []));
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/research-consent', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('SetResearchConsent', req.params.id, String(Boolean(req.body.consent)));
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/public-key', async (req, res) => {
+    try {
+        const { publicKeyPem } = req.body;
+        const result = await contract.submitTransaction('RegisterDonorPublicKey', req.params.id, publicKeyPem);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// signature is hex: ASN.1 DER or WebCrypto's raw r||s, over the consent document hash.
+app.post('/api/donors/:id/consent/:version/verify', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('VerifyConsentSignature', req.params.id, req.params.version, req.body.signature);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// The donor's own revocation, signed with their registered key over the SHA-256 of
+// {"donorId","action":"REVOKE_CONSENT","version"}; any hospital may submit it.
+app.post('/api/donors/:id/revoke-consent', async (req, res) => {
+    try {
+        await contract.submitTransaction('RevokeConsent', req.params.id, req.body.signature || '');
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Withdrawal for reasons other than consent; the donor becomes INACTIVE.
+app.post('/api/donors/:id/withdraw', async (req, res) => {
+    try {
+        const { initiatedBy, reason } = req.body;
+        const result = await contract.submitTransaction('WithdrawDonor', req.params.id, initiatedBy || '', reason || '',
+            String(req.body.expectedVersion ?? 0));
+        res.json({ success: true, donor: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/serology', async (req, res) => {
+    try {
+        const result = await contract.evaluateTransaction('GetSerologyPanel', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/serology', async (req, res) => {
+    try {
+        const { test, result, labId, flagNote } = req.body;
+        const panel = await contract.submitTransaction('RecordScreeningResult', req.params.id, test, result, labId, flagNote || '');
+        res.json({ success: true, panel: parseChainResult(panel) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Right to erasure: purges the donor's private data, keeping only hashes on chain.
+app.post('/api/donors/:id/erase', async (req, res) => {
+    try {
+        const result = await contract.submitTransaction('PurgeDonorPII', req.params.id);
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.get('/api/donors/:id/private', async (req, res) => {
+    try {
+        const result = await contract.evaluate('GetDonorPrivate', {
+            arguments: [req.params.id],
+            transientData: withPiiKey({}),
+        });
+        res.json(parseChainResult(result));
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/donors/:id/private', async (req, res) => {
+    try {
+        const { name, email, phone } = req.body;
+        const donorPII = JSON.stringify({ name: name || '', email: email || '', phone: phone || '' });
+        await contract.submit('CreateDonorPrivate', {
+            arguments: [req.params.id],
+            transientData: withPiiKey({ donor_pii: Buffer.from(donorPII) }),
+        });
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.put('/api/donors/:id', async (req, res) => {
+    try {
+        const { email, phone, organsAvailable } = req.body;
+        const transientData = {};
+        if (email || phone) {
+            transientData.donor_pii = Buffer.from(JSON.stringify({ email: email || '', phone: phone || '' }));
+        }
+        await contract.submit('UpdateDonor', {
+            arguments: [req.params.id, organsAvailable ? JSON.stringify(organsAvailable) : '', String(req.body.expectedVersion ?? 0)],
+            transientData: withPiiKey(transientData),
+        });
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+// Contact-only changes. A donor's own change carries their signature over the contact change hash.
+app.patch('/api/donors/:id/contact', async (req, res) => {
+    try {
+        const { email, phone, signature } = req.body;
+        const transientData = { donor_pii: Buffer.from(JSON.stringify({ email: email || '', phone: phone || '' })) };
+        const result = await contract.submit('UpdateDonorContact', {
+            arguments: [req.params.id, signature || '', String(req.body.expectedVersion ?? 0)],
+            transientData: withPiiKey(transientData),
+        });
+        res.json({ success: true, donor: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
     }
 });
 
 app.patch('/api/donors/:id/status', async (req, res) => {
     try {
-        await contract.submitTransaction('UpdateDonorStatus', req.params.id, req.body.organToRemove);
+        await contract.submitTransaction('UpdateDonorStatus', req.params.id, req.body.organToRemove, String(req.body.expectedVersion ?? 0));
+        res.json({ success: true });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.patch('/api/organs/:id/status', async (req, res) => {
+    try {
+        const { status } = req.body;
+        await contract.submitTransaction('UpdateOrganStatus', req.params.id, status);
         res.json({ success: true });
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/organs/:id/custody', async (req, res) => {
+    try {
+        const { actor, action, location } = req.body;
+        const result = await contract.submitTransaction('AppendCustodyEvent', req.params.id, actor, action, location);
+        res.json({ success: true, event: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
+    }
+});
+
+app.post('/api/organs/:id/recovery', async (req, res) => {
+    try {
+        const { recoveredAt } = req.body;
+        const result = await contract.submitTransaction('RecordOrganRecovery', req.params.id, recoveredAt);
+        res.json({ success: true, organ: parseChainResult(result) });
+    } catch (error) {
+        sendChainError(res, error);
     }
 });
 
 app.post('/api/donors/:id/verify', async (req, res) => {
     try {
-        const { hospitalId, status } = req.body;
-        await contract.submitTransaction('VerifyDonor', req.params.id, hospitalId, status);
+        const { status } = req.body;
+        await contract.submitTransaction('VerifyDonor', req.params.id, status);
         res.json({ success: true });
     } catch (error) {
-        res.status(500).json({ error: error.message });
+        sendChainError(res, error);
     }
 });
 
@@ -18,7 +18,7 @@ async function verify() {
         console.table(donors.map(d => ({ ID: d.id, Blood: d.bloodType, Organs: d.organsAvailable.join(', '), Status: d.verificationStatus })));
 
         console.log('\n[Hospitals]');
-        const hospitals = ['ADMIN-HOSP', 'HOS1'];
+        const hospitals = ['HOSP-ADMIN', 'HOSP-001'];
         for (const id of hospitals) {
             try {
                 const h = parseChainResult(await contract.evaluateTransaction('GetHospital', id));
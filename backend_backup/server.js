@@ -112,7 +112,7 @@ app.post('/api/init', async (req, res) => {
 // Clear all data from ledger
 app.delete('/api/clear', async (req, res) => {
     try {
-        await contract.submitTransaction('ClearLedger');
+        await contract.submitTransaction('ClearLedger', CHANNEL_NAME);
         res.json({ success: true, message: 'All patients, donors, and matches cleared from ledger' });
     } catch (error) {
         res.status(500).json({ success: false, error: error.message });
@@ -205,6 +205,17 @@ function parseChainResult(result) {
     }
 }
 
+// National IDs reach the ledger only as an HMAC-SHA256 under NATIONAL_ID_HASH_KEY, so
+// they cannot be recovered by hashing every possible ID. Every hospital's backend must
+// use the same key for duplicate donors and multi-listed patients to be caught across
+// hospitals.
+function hashNationalId(nationalId) {
+    if (!nationalId) {
+        return '';
+    }
+    const normalized = String(nationalId).replace(/[\s-]/g, '').toUpperCase();
+    return crypto.createHmac('sha256', process.env.NATIONAL_ID_HASH_KEY || '').update(normalized).digest('hex');
+}
 
 // Upload JSON data to local IPFS node and return the CID
 async function uploadToIPFS(data) {
@@ -271,7 +282,7 @@ app.get('/api/patients/:id', async (req, res) => {
 // Create patient
 app.post('/api/patients', async (req, res) => {
     try {
-        const { id, nameHash, bloodType, hla, organNeeded, hospitalId } = req.body;
+        const { id, nameHash, bloodType, hla, organNeeded, hospitalId, nationalId } = req.body;
 
         // Upload detailed data to IPFS
         const ipfsHash = await uploadToIPFS({
@@ -293,7 +304,8 @@ app.post('/api/patients', async (req, res) => {
             hla,
             organNeeded,
             ipfsHash,
-            hospitalId
+            '',
+            hashNationalId(nationalId)
         );
         res.json({ success: true, id, ipfsHash });
     } catch (error) {
@@ -325,15 +337,13 @@ app.get('/api/donors/:id', async (req, res) => {
 // Create donor (self-registration)
 app.post('/api/donors', async (req, res) => {
     try {
-        const { id, name, email, phone, bloodType, hla, organsAvailable, consentHash } = req.body;
+        const { id, name, email, phone, bloodType, hla, organsAvailable, consentHash, donorType, donorDetails, nationalId } = req.body;
 
-        // Upload detailed data to IPFS
+        // Upload detailed data to IPFS. Content pinned there is public and cannot be
+        // erased, so name, email and phone are kept out of it.
         const ipfsHash = await uploadToIPFS({
             docType: 'donor',
             id,
-            name,
-            email,
-            phone,
             bloodType,
             hla,
             organsAvailable,
@@ -341,18 +351,15 @@ app.post('/api/donors', async (req, res) => {
             createdAt: new Date().toISOString()
         });
 
-        await contract.submitTransaction(
-            'CreateDonor',
-            id,
-            name || '',
-            email || '',
-            phone || '',
-            bloodType,
-            hla,
-            JSON.stringify(organsAvailable),
-            ipfsHash,
-            consentHash
-        );
+        // Name, email and phone go in the transient map so they never reach block data.
+        const donorPII = JSON.stringify({ name: name || '', email: email || '', phone: phone || '' });
+        await contract.submit('CreateDonor', {
+            arguments: [id, bloodType, hla, JSON.stringify(organsAvailable), ipfsHash, consentHash, donorType || '', JSON.stringify(donorDetails || {}), hashNationalId(nationalId)],
+            transientData: {
+                donor_pii: Buffer.from(donorPII),
+                ...(process.env.PII_ENCRYPTION_KEY && { pii_key: Buffer.from(process.env.PII_ENCRYPTION_KEY, 'hex') }),
+            },
+        });
         res.json({ success: true, id, message: 'Donor registered. Pending hospital verification.', ipfsHash });
     } catch (error) {
         res.status(500).json({ success: false, error: error.message });
@@ -362,8 +369,8 @@ app.post('/api/donors', async (req, res) => {
 // Verify donor (hospital only)
 app.post('/api/donors/:id/verify', async (req, res) => {
     try {
-        const { hospitalId, status } = req.body; // status: VERIFIED or REJECTED
-        await contract.submitTransaction('VerifyDonor', req.params.id, hospitalId, status);
+        const { status } = req.body; // status: VERIFIED or REJECTED
+        await contract.submitTransaction('VerifyDonor', req.params.id, status);
         res.json({ success: true, message: `Donor ${status.toLowerCase()} successfully` });
     } catch (error) {
         res.status(500).json({ success: false, error: error.message });
@@ -373,15 +380,13 @@ app.post('/api/donors/:id/verify', async (req, res) => {
 // Create match
 app.post('/api/matches', async (req, res) => {
     try {
-        const { id, patientId, donorId, organType, hlaScore, approvedBy } = req.body;
+        const { id, patientId, donorId, organType } = req.body;
         await contract.submitTransaction(
             'CreateMatch',
             id,
             patientId,
             donorId,
-            organType,
-            hlaScore,
-            approvedBy
+            organType
         );
         res.json({ success: true, id });
     } catch (error) {
@@ -414,8 +419,8 @@ app.get('/api/matches', async (req, res) => {
 // Update donor status (remove used organ)
 app.patch('/api/donors/:id/status', async (req, res) => {
     try {
-        const { organToRemove } = req.body;
-        await contract.submitTransaction('UpdateDonorStatus', req.params.id, organToRemove);
+        const { organToRemove, expectedVersion } = req.body;
+        await contract.submitTransaction('UpdateDonorStatus', req.params.id, organToRemove, String(expectedVersion ?? 0));
         res.json({ success: true });
     } catch (error) {
         res.status(500).json({ success: false, error: error.message });
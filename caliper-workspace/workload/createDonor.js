@@ -18,15 +18,22 @@ class MyWorkload extends WorkloadModuleBase {
             invokerIdentity: 'User1',
             contractArguments: [
                 id,
-                'Donor ' + id, // name
-                'donor' + id + '@example.com', // email
-                '1234567890', // phone
                 'O-', // bloodType
-                'HLA-A2,B44', // hla
+                'A2,B44', // hla
                 JSON.stringify(['Kidney', 'Liver']), // organsAvailableJSON
                 'Qm' + Math.random().toString(36).substring(7), // ipfsHash
-                'consent-' + Math.random().toString(36).substring(7) // consentHash
+                'consent-' + Math.random().toString(36).substring(7), // consentHash
+                'DBD', // donorType
+                JSON.stringify({ brainDeathAt: new Date(Date.now() - 60000).toISOString().replace(/\.\d+Z$/, 'Z') }), // donorDetailsJSON
+                '' // nationalIdHash
             ],
+            transientMap: {
+                donor_pii: Buffer.from(JSON.stringify({
+                    name: 'Donor ' + id,
+                    email: 'donor' + id + '@example.com',
+                    phone: '1234567890'
+                }))
+            },
             readOnly: false
         };
 
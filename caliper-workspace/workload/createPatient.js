@@ -20,10 +20,11 @@ class MyWorkload extends WorkloadModuleBase {
                 id,
                 'hash-' + Math.random().toString(36).substring(7), // nameHash
                 'A+', // bloodType
-                'HLA-A2,B44', // hla
+                'A2,B44', // hla
                 'Kidney', // organNeeded
                 'Qm' + Math.random().toString(36).substring(7), // ipfsHash
-                'ADMIN-HOSP' // hospitalId
+                'ROUTINE', // urgency
+                '' // identityHash
             ],
             readOnly: false
         };
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Roles are read from the "role" attribute of the caller's enrollment certificate,
+// e.g. fabric-ca-client register --id.attrs 'role=hospital:ecert'.
+const (
+	roleAttribute = "role"
+
+	RoleHospital  = "hospital"
+	RoleAdmin     = "admin"
+	RoleRegulator = "regulator"
+	RolePhysician = "physician"
+	// RoleCoordinator is a transplant coordinator who reads records across hospitals.
+	RoleCoordinator = "coordinator"
+	// RoleResearcher is an approved research identity; it may only read de-identified
+	// data, see researchFunctions.
+	RoleResearcher = "researcher"
+)
+
+// callerRole returns the role attribute of the invoking identity.
+func callerRole(ctx contractapi.TransactionContextInterface) (string, error) {
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if actor.Role == "" {
+		return "", codedError(CodeForbidden, "", "", "caller identity has no %q attribute", roleAttribute)
+	}
+	return actor.Role, nil
+}
+
+// requireRole rejects the invocation unless the caller holds one of the given roles.
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	role, err := callerRole(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles {
+		if role == r {
+			return nil
+		}
+	}
+	return codedError(CodeForbidden, "", "", "role %q may not call this function; requires %s", role, strings.Join(roles, " or "))
+}
+
+// patientScope returns the hospital whose patients the caller may read, or "" when the
+// caller may read every hospital's patients. Hospital and physician identities are
+// limited to the hospital in their certificate.
+func patientScope(ctx contractapi.TransactionContextInterface) (string, error) {
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch actor.Role {
+	case RoleAdmin, RoleCoordinator, RoleRegulator:
+		return "", nil
+	case RoleHospital, RolePhysician:
+		return actor.HospitalID, nil
+	}
+	return "", codedError(CodeForbidden, "", "", "callers without a role may not read patient records")
+}
+
+// requirePatientVisible rejects reads of a patient held by another hospital.
+func requirePatientVisible(ctx contractapi.TransactionContextInterface, p *Patient) error {
+	scope, err := patientScope(ctx)
+	if err != nil {
+		return err
+	}
+	if scope != "" && p.HospitalID != scope {
+		return codedError(CodeForbidden, docTypePatient, "", "patient %s is held by another hospital", p.ID)
+	}
+	return nil
+}
+
+// visiblePatients keeps the patients the caller may read.
+func visiblePatients(ctx contractapi.TransactionContextInterface, patients []*Patient) ([]*Patient, error) {
+	scope, err := patientScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if scope == "" {
+		return patients, nil
+	}
+	visible := []*Patient{}
+	for _, p := range patients {
+		if p.HospitalID == scope {
+			visible = append(visible, p)
+		}
+	}
+	return visible, nil
+}
+
+// readOnlyRoles may only call the functions in evaluateTransactions. Regulators audit
+// the registry for national oversight bodies; coordinators follow cases across
+// hospitals.
+var readOnlyRoles = []string{RoleRegulator, RoleCoordinator}
+
+// evaluateTransactions lists the functions that do not change the ledger. They are
+// tagged as evaluate-only in the contract metadata, and they are all read-only roles
+// may call.
+var evaluateTransactions = []string{
+	"AuthenticateHospital", "CalculateHLAScore", "CheckCompatibility", "ComputeCompatibility", "DetectMultiListings",
+	"ExportAuditBundle", "ExportDonorFHIR", "ExportHospitalFHIR", "ExportPatientFHIR", "ExportResearchDataset",
+	"FindCompatibleDonors", "FindExchangeCycles", "FindMatchesForPatient",
+	"GetAccessConfig", "GetAllDonors", "GetAllDonorsPaginated", "GetAllHospitals", "GetAllMatches",
+	"GetAllMatchesPaginated", "GetAllPatients", "GetAllPatientsPaginated", "GetArchivedRecords", "GetAuditTrail",
+	"GetClinicalScoreHistory", "GetCommitteeReview", "GetCustodyChain", "GetDeathDeclaration",
+	"GetDirectedDonors", "GetDonor", "GetDonorAcceptanceRate", "GetDonorHistory",
+	"GetDonorHistoryPaginated", "GetDonorOrgans", "GetDonorPrivate", "GetDonorsNeedingReverification",
+	"GetEpletTable", "GetExchangeChain", "GetExchangePair", "GetHospital", "GetHospitalDashboard",
+	"GetLedgerStats", "GetLiverAllocation", "GetMatchChain", "GetMatchesByDonor", "GetMatchesByHospital",
+	"GetMatchesByPatient", "GetOffer", "GetOffersForOrgan", "GetOrgan", "GetOrganViability",
+	"GetPatient", "GetPatientHistory", "GetPatientHistoryPaginated", "GetPolicyConfig",
+	"GetRecentActivity", "GetRegistrySubmission", "GetSerologyPanel", "GetTransplantStats", "GetWaitlist", "GetWaitlistCSV", "IsBloodCompatible",
+	"QueryDonors", "QueryDonorsByOrgan", "QueryDonorsBySelector", "QueryPatients",
+	"QueryPatientsBySelector", "QueryWaitingPatients", "RecordExists", "SimulateAllocation",
+}
+
+// researchFunctions are the only functions researcher identities may call.
+var researchFunctions = []string{"ExportResearchDataset"}
+
+// GetEvaluateTransactions implements contractapi.EvaluationContractInterface.
+func (s *SmartContract) GetEvaluateTransactions() []string {
+	return evaluateTransactions
+}
+
+// requireReadOnlyAccess rejects read-only roles invoking a function that changes the
+// ledger, and researchers invoking anything but the research functions.
+func requireReadOnlyAccess(ctx contractapi.TransactionContextInterface, actor *Actor) error {
+	fn := invokedFunction(ctx)
+	if actor.Role == RoleResearcher && !containsString(researchFunctions, fn) {
+		return codedError(CodeForbidden, "", "", "role %q may only call %s, not %s", actor.Role, strings.Join(researchFunctions, ", "), fn)
+	}
+	if !containsString(readOnlyRoles, actor.Role) {
+		return nil
+	}
+	if !containsString(evaluateTransactions, fn) {
+		return codedError(CodeForbidden, "", "", "role %q is read-only and may not call %s", actor.Role, fn)
+	}
+	return nil
+}
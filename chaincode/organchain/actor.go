@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// hospitalAttribute names the hospital a caller acts for, e.g.
+// fabric-ca-client register --id.attrs 'role=hospital:ecert,hospitalId=HOSP-001:ecert'.
+// Functions take the acting hospital from here rather than from their arguments.
+const hospitalAttribute = "hospitalId"
+
+// Actor is the authenticated caller of a transaction. Role is empty for donors
+// registering themselves; HospitalID is empty for callers that act for no hospital.
+type Actor struct {
+	ID         string
+	MSPID      string
+	Role       string
+	HospitalID string
+}
+
+// TransactionContext is the transaction context every function receives. The
+// BeforeTransaction hook resolves the caller once and keeps it here.
+type TransactionContext struct {
+	contractapi.TransactionContext
+	actor *Actor
+	// indexed holds the index keys of the records written so far; see reindex.
+	indexed map[string][]string
+	// audited holds the hashes of the records written so far, auditHeads the heads of
+	// their audit chains by head key, and auditSeq counts the audit entries; see
+	// writeAudit.
+	audited    map[string]string
+	auditHeads map[string]auditChainHead
+	auditSeq   int
+	// nationalIDs maps the national ID hashes of the donors created so far to their
+	// donor IDs; see requireUniqueNationalID.
+	nationalIDs map[string]string
+}
+
+// newSmartContract returns the contract with its context and authentication hook.
+func newSmartContract() *SmartContract {
+	s := &SmartContract{}
+	s.TransactionContextHandler = new(TransactionContext)
+	s.BeforeTransaction = authenticate
+	return s
+}
+
+// authenticate runs before every function, rejecting callers whose certificate does
+// not identify them well enough for their role, and read-only roles calling functions
+// that write.
+func authenticate(ctx *TransactionContext) error {
+	actor, err := resolveActor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := requireReadOnlyAccess(ctx, actor); err != nil {
+		return err
+	}
+	ctx.actor = actor
+	return nil
+}
+
+func resolveActor(ctx contractapi.TransactionContextInterface) (*Actor, error) {
+	cid := ctx.GetClientIdentity()
+	id, err := cid.GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client identity: %v", err)
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role, _, err := cid.GetAttributeValue(roleAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read caller role: %v", err)
+	}
+	hospitalID, _, err := cid.GetAttributeValue(hospitalAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read caller hospital: %v", err)
+	}
+	switch role {
+	case "", RoleRegulator, RoleCoordinator, RoleResearcher:
+	case RoleHospital, RolePhysician:
+		if hospitalID == "" {
+			return nil, codedError(CodeUnauthenticated, "", "", "%s identities must carry a %q attribute", role, hospitalAttribute)
+		}
+	case RoleAdmin:
+		if hospitalID == "" {
+			hospitalID = adminHospitalID
+		}
+	default:
+		return nil, codedError(CodeUnauthenticated, "", "", "unknown role %q", role)
+	}
+	return &Actor{ID: id, MSPID: mspID, Role: role, HospitalID: hospitalID}, nil
+}
+
+// invokedFunction returns the name of the contract function being invoked, without
+// its contract namespace.
+func invokedFunction(ctx contractapi.TransactionContextInterface) string {
+	fn, _ := ctx.GetStub().GetFunctionAndParameters()
+	return fn[strings.LastIndex(fn, ":")+1:]
+}
+
+// actorOf returns the caller resolved by authenticate.
+func actorOf(ctx contractapi.TransactionContextInterface) (*Actor, error) {
+	if tc, ok := ctx.(*TransactionContext); ok && tc.actor != nil {
+		return tc.actor, nil
+	}
+	return resolveActor(ctx)
+}
+
+// actingHospital returns the hospital the caller acts for, which must be active.
+func actingHospital(ctx contractapi.TransactionContextInterface) (string, error) {
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if actor.HospitalID == "" {
+		return "", codedError(CodeForbidden, "", "", "caller identity acts for no hospital")
+	}
+	if _, err := activeHospital(ctx, actor.HospitalID); err != nil {
+		return "", err
+	}
+	return actor.HospitalID, nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AllocationCandidate is a waiting patient ranked against a donor organ.
+type AllocationCandidate struct {
+	Rank          int    `json:"rank"`
+	PatientID     string `json:"patientId"`
+	HospitalID    string `json:"hospitalId"`
+	Urgency       string `json:"urgency"`
+	BloodTypeTier string `json:"bloodTypeTier"`
+	HLAScore      int    `json:"hlaScore"`
+	WaitingSince  string `json:"waitingSince"`
+	// WaitingDays counts active days on the list; WaitTimePoints is the priority they
+	// earn, and PriorityScore is HLAScore plus WaitTimePoints.
+	WaitingDays    int     `json:"waitingDays"`
+	WaitTimePoints float64 `json:"waitTimePoints"`
+	PriorityScore  float64 `json:"priorityScore"`
+}
+
+// OrganAllocation is the ranked waitlist for one organ offered by a donor.
+type OrganAllocation struct {
+	OrganType         string                 `json:"organType"`
+	ProposedPatientID string                 `json:"proposedPatientId"`
+	ProposedHLAScore  int                    `json:"proposedHlaScore"`
+	Candidates        []*AllocationCandidate `json:"candidates"`
+}
+
+// AllocationSimulation is a what-if allocation run. Nothing in it is written to the ledger.
+type AllocationSimulation struct {
+	Simulation  bool               `json:"simulation"`
+	DonorID     string             `json:"donorId"`
+	GeneratedAt string             `json:"generatedAt"`
+	Allocations []*OrganAllocation `json:"allocations"`
+}
+
+// CommitteePair is an eligible donor/patient pairing prepared for committee review.
+type CommitteePair struct {
+	Rank           int            `json:"rank"`
+	DonorID        string         `json:"donorId"`
+	PatientID      string         `json:"patientId"`
+	HospitalID     string         `json:"hospitalId"`
+	OrganType      string         `json:"organType"`
+	Urgency        string         `json:"urgency"`
+	BloodTypeTier  string         `json:"bloodTypeTier"`
+	HLAScore       int            `json:"hlaScore"`
+	HLABreakdown   map[string]int `json:"hlaBreakdown"`
+	WaitingSince   string         `json:"waitingSince"`
+	WaitingDays    int            `json:"waitingDays"`
+	WaitTimePoints float64        `json:"waitTimePoints"`
+	PriorityScore  float64        `json:"priorityScore"`
+}
+
+func bloodTypeTier(recipient, donor string) string {
+	if recipient == donor {
+		return "IDENTICAL"
+	}
+	return "COMPATIBLE"
+}
+
+// rankCandidates returns the waiting patients eligible for a donor organ, best first:
+// most urgent tier, then highest priority score (HLA score plus waiting-time points),
+// then longest active waiting time. It ranks whichever patients it is given; callers
+// are responsible for what the ranking exposes.
+func (s *SmartContract) rankCandidates(cfg *PolicyConfig, d *Donor, organType string, patients []*Patient, now time.Time) []*AllocationCandidate {
+	waits := map[string]time.Duration{}
+	candidates := []*AllocationCandidate{}
+	for _, p := range patients {
+		if p.Status != "WAITING" || p.OrganNeeded != organType || directedElsewhere(d, p.ID) {
+			continue
+		}
+		compat := s.evaluateCompatibility(cfg, p, d, organType, now)
+		if !compat.Compatible {
+			continue
+		}
+		wait := waitingTime(p, now)
+		waits[p.ID] = wait
+		points := waitTimePoints(wait)
+		candidates = append(candidates, &AllocationCandidate{
+			PatientID: p.ID, HospitalID: p.HospitalID, Urgency: p.Urgency,
+			BloodTypeTier: bloodTypeTier(p.BloodType, d.BloodType),
+			HLAScore:      compat.HLAScore, WaitingSince: p.CreatedAt,
+			WaitingDays: int(wait / (24 * time.Hour)), WaitTimePoints: points,
+			PriorityScore: float64(compat.HLAScore) + points,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ti, tj := urgencyTier(candidates[i].Urgency), urgencyTier(candidates[j].Urgency)
+		if ti != tj {
+			return ti < tj
+		}
+		if candidates[i].PriorityScore != candidates[j].PriorityScore {
+			return candidates[i].PriorityScore > candidates[j].PriorityScore
+		}
+		return waits[candidates[i].PatientID] > waits[candidates[j].PatientID]
+	})
+	for i, c := range candidates {
+		c.Rank = i + 1
+	}
+	return candidates
+}
+
+// SimulateAllocation ranks the waitlist against each of a donor's organs without
+// creating matches or changing any record. It ranks every hospital's patients, so only
+// admins, coordinators and regulators may call it.
+func (s *SmartContract) SimulateAllocation(ctx contractapi.TransactionContextInterface, donorId string) (*AllocationSimulation, error) {
+	if err := requireRole(ctx, RoleAdmin, RoleCoordinator, RoleRegulator); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if d.VerificationStatus != "VERIFIED" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor not verified")
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &AllocationSimulation{Simulation: true, DonorID: d.ID, GeneratedAt: now.Format(time.RFC3339), Allocations: []*OrganAllocation{}}
+	proposed := map[string]bool{}
+	for _, organ := range d.OrgansAvailable {
+		alloc := &OrganAllocation{OrganType: organ, Candidates: s.rankCandidates(cfg, d, organ, patients, *now)}
+		for _, c := range alloc.Candidates {
+			if !proposed[c.PatientID] {
+				proposed[c.PatientID] = true
+				alloc.ProposedPatientID = c.PatientID
+				alloc.ProposedHLAScore = c.HLAScore
+				break
+			}
+		}
+		sim.Allocations = append(sim.Allocations, alloc)
+	}
+	return sim, nil
+}
+
+// GetCommitteeReview lists every eligible donor/patient pair for an organ, best first,
+// leaving out patients already in an active match. Organs held by a match have
+// already left the donor's available list. Like SimulateAllocation it is limited to
+// admins, coordinators and regulators.
+func (s *SmartContract) GetCommitteeReview(ctx contractapi.TransactionContextInterface, organType string) ([]*CommitteePair, error) {
+	if err := requireRole(ctx, RoleAdmin, RoleCoordinator, RoleRegulator); err != nil {
+		return nil, err
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := s.GetAllMatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matchedPatients := map[string]bool{}
+	for _, m := range matches {
+		if terminalMatchStatuses[m.Status] || m.OrganType != organType {
+			continue
+		}
+		matchedPatients[m.PatientID] = true
+	}
+	patientsByID := map[string]*Patient{}
+	for _, p := range patients {
+		patientsByID[p.ID] = p
+	}
+
+	pairs := []*CommitteePair{}
+	for _, d := range donors {
+		if d.VerificationStatus != "VERIFIED" {
+			continue
+		}
+		for _, c := range s.rankCandidates(cfg, d, organType, patients, *now) {
+			if matchedPatients[c.PatientID] {
+				continue
+			}
+			pair := &CommitteePair{
+				DonorID: d.ID, PatientID: c.PatientID, HospitalID: c.HospitalID, OrganType: organType, Urgency: c.Urgency,
+				BloodTypeTier: c.BloodTypeTier, HLAScore: c.HLAScore,
+				HLABreakdown: hlaLocusMatches(patientsByID[c.PatientID].HLA, d.HLA),
+				WaitingSince: c.WaitingSince, WaitingDays: c.WaitingDays,
+				WaitTimePoints: c.WaitTimePoints, PriorityScore: c.PriorityScore,
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		ti, tj := urgencyTier(pairs[i].Urgency), urgencyTier(pairs[j].Urgency)
+		if ti != tj {
+			return ti < tj
+		}
+		if pairs[i].PriorityScore != pairs[j].PriorityScore {
+			return pairs[i].PriorityScore > pairs[j].PriorityScore
+		}
+		return pairs[i].WaitingDays > pairs[j].WaitingDays
+	})
+	for i, p := range pairs {
+		p.Rank = i + 1
+	}
+	return pairs, nil
+}
+
+// DonorCandidate is a verified donor ranked for a patient's needed organ.
+type DonorCandidate struct {
+	Rank          int            `json:"rank"`
+	DonorID       string         `json:"donorId"`
+	OrganType     string         `json:"organType"`
+	BloodTypeTier string         `json:"bloodTypeTier"`
+	HLAScore      int            `json:"hlaScore"`
+	LocusMatches  map[string]int `json:"locusMatches"`
+	EpletLoad     int            `json:"epletLoad"`
+}
+
+// FindMatchesForPatient ranks the verified donors who can currently give the patient
+// the organ they need: highest HLA score first, then identical blood type, so universal
+// donors are kept for patients who need them. Patients no longer waiting get an empty list.
+// The caller must be able to read the patient; see patientScope.
+func (s *SmartContract) FindMatchesForPatient(ctx contractapi.TransactionContextInterface, patientId string) ([]*DonorCandidate, error) {
+	candidates, _, err := s.rankDonors(ctx, patientId)
+	return candidates, err
+}
+
+// rankDonors does the work of FindMatchesForPatient and also returns the donor records
+// it ranked, by ID, so callers need not read them again.
+func (s *SmartContract) rankDonors(ctx contractapi.TransactionContextInterface, patientId string) ([]*DonorCandidate, map[string]*Donor, error) {
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := requirePatientVisible(ctx, p); err != nil {
+		return nil, nil, err
+	}
+	candidates := []*DonorCandidate{}
+	ranked := map[string]*Donor{}
+	if p.Status != "WAITING" {
+		return candidates, ranked, nil
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	eplets, err := s.GetEpletTable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, d := range donors {
+		if d.VerificationStatus != "VERIFIED" || directedElsewhere(d, p.ID) {
+			continue
+		}
+		compat := s.evaluateCompatibility(cfg, p, d, p.OrganNeeded, *now)
+		if !compat.Compatible {
+			continue
+		}
+		ranked[d.ID] = d
+		candidates = append(candidates, &DonorCandidate{
+			DonorID: d.ID, OrganType: p.OrganNeeded,
+			BloodTypeTier: bloodTypeTier(p.BloodType, d.BloodType),
+			HLAScore:      compat.HLAScore,
+			LocusMatches:  hlaLocusMatches(p.HLA, d.HLA),
+			EpletLoad:     eplets.mismatch(p.HLA, d.HLA).Load,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].HLAScore != candidates[j].HLAScore {
+			return candidates[i].HLAScore > candidates[j].HLAScore
+		}
+		if candidates[i].BloodTypeTier != candidates[j].BloodTypeTier {
+			return candidates[i].BloodTypeTier == "IDENTICAL"
+		}
+		return candidates[i].DonorID < candidates[j].DonorID
+	})
+	for i, c := range candidates {
+		c.Rank = i + 1
+	}
+	return candidates, ranked, nil
+}
+
+// FindCompatibleDonors returns the donor records behind FindMatchesForPatient, in rank order.
+func (s *SmartContract) FindCompatibleDonors(ctx contractapi.TransactionContextInterface, patientId string) ([]*Donor, error) {
+	candidates, ranked, err := s.rankDonors(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	result := []*Donor{}
+	for _, c := range candidates {
+		result = append(result, ranked[c.DonorID])
+	}
+	return result, nil
+}
+
+// GetWaitlist returns the waiting patients for an organ, most urgent first and
+// longest active waiting time first within each urgency tier.
+func (s *SmartContract) GetWaitlist(ctx contractapi.TransactionContextInterface, organType string) ([]*Patient, error) {
+	patients, err := s.GetAllPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	waitlist := []*Patient{}
+	for _, p := range patients {
+		if p.Status == "WAITING" && p.OrganNeeded == organType {
+			waitlist = append(waitlist, p)
+		}
+	}
+	sortWaitlist(waitlist, *now)
+	return waitlist, nil
+}
+
+// sortWaitlist orders patients most urgent first, then longest waiting.
+func sortWaitlist(patients []*Patient, now time.Time) {
+	sort.SliceStable(patients, func(i, j int) bool {
+		ti, tj := urgencyTier(patients[i].Urgency), urgencyTier(patients[j].Urgency)
+		if ti != tj {
+			return ti < tj
+		}
+		return waitingTime(patients[i], now) > waitingTime(patients[j], now)
+	})
+}
+
+// waitlistCSVHeader names the columns of GetWaitlistCSV.
+var waitlistCSVHeader = []string{"rank", "patientId", "hospitalId", "organNeeded", "bloodType", "urgency", "cpra", "listedAt", "waitingDays"}
+
+// csvCell guards a value against being read as a formula by spreadsheet programs.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// GetWaitlistCSV returns an organ's waitlist, as GetWaitlist orders it, as an RFC 4180
+// CSV document with a header row. Hospitals and physicians see only their own
+// patients, ranked among themselves.
+func (s *SmartContract) GetWaitlistCSV(ctx contractapi.TransactionContextInterface, organType string) (string, error) {
+	if err := validateOrgan(organType); err != nil {
+		return "", err
+	}
+	waitlist, err := s.GetWaitlist(ctx, organType)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.UseCRLF = true
+	if err := w.Write(waitlistCSVHeader); err != nil {
+		return "", err
+	}
+	for i, p := range waitlist {
+		row := []string{
+			strconv.Itoa(i + 1), p.ID, p.HospitalID, p.OrganNeeded, p.BloodType, p.Urgency, strconv.Itoa(p.CPRA),
+			p.CreatedAt, strconv.Itoa(int(waitingTime(p, *now).Hours() / 24)),
+		}
+		for j := range row {
+			row[j] = csvCell(row[j])
+		}
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetWaitlistOrdersByTierThenListingTime(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	// Listed an hour apart, in this order.
+	for i, tc := range []struct{ id, urgency string }{
+		{"PAT-101", "ROUTINE"},
+		{"PAT-102", "STATUS_1A"},
+		{"PAT-103", "ROUTINE"},
+		{"PAT-104", "STATUS_1B"},
+		{"PAT-105", "STATUS_1A"},
+		{"PAT-106", "URGENT"},
+	} {
+		l.Now = testEpoch.Add(time.Duration(i) * time.Hour)
+		l.mustInvoke("CreatePatient", tc.id, "h", "O+", "A2, B8, DR15", "Lung", "", tc.urgency, "")
+	}
+	l.mustInvoke("CreatePatient", "PAT-107", "h", "O+", "A2, B8, DR15", "Heart", "", "STATUS_1A", "")
+	l.Now = testEpoch.AddDate(0, 0, 7)
+
+	var waitlist []*Patient
+	l.mustInvokeJSON(&waitlist, "GetWaitlist", "Lung")
+	got := []string{}
+	for _, p := range waitlist {
+		got = append(got, p.ID)
+	}
+	want := "PAT-102 PAT-105 PAT-104 PAT-106 PAT-101 PAT-103"
+	if strings.Join(got, " ") != want {
+		t.Errorf("waitlist = %v, want %s", got, want)
+	}
+}
+
+func TestFindCompatibleDonorsFollowsCandidateRanking(t *testing.T) {
+	l := newSeededLedger(t)
+	l.mustInvoke("VerifyDonor", "DON-101", "VERIFIED")
+	l.mustInvoke("VerifyDonor", "DON-103", "VERIFIED")
+	l.asHospital("HOSP-001")
+
+	var candidates []*DonorCandidate
+	l.mustInvokeJSON(&candidates, "FindMatchesForPatient", "PAT-001")
+	var donors []*Donor
+	l.mustInvokeJSON(&donors, "FindCompatibleDonors", "PAT-001")
+	if len(donors) == 0 || len(donors) != len(candidates) {
+		t.Fatalf("FindCompatibleDonors returned %d donors for %d candidates", len(donors), len(candidates))
+	}
+	for i, d := range donors {
+		if d.ID != candidates[i].DonorID || d.BloodType == "" {
+			t.Errorf("donor %d = %s %q, want the record of candidate %s", i, d.ID, d.BloodType, candidates[i].DonorID)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// StatusArchived marks a patient or donor record that has been retired. Archived
+// records stay on the ledger so the matches, transplants and history that reference
+// them remain intact, but default queries and allocation leave them out.
+const StatusArchived = "ARCHIVED"
+
+// ArchivedRecord summarises one archived patient or donor for auditors.
+type ArchivedRecord struct {
+	ID         string `json:"id"`
+	DocType    string `json:"docType"`
+	HospitalID string `json:"hospitalId,omitempty" metadata:",optional"`
+	OwnerMSP   string `json:"ownerMsp"`
+	ArchivedAt string `json:"archivedAt"`
+	ArchivedBy string `json:"archivedBy"`
+	Reason     string `json:"reason"`
+}
+
+// ArchiveRecord retires a patient or donor in place of deleting it. The record must not
+// be held by an open match or offer. An archived donor lists no organs; an archived
+// record cannot be changed afterwards.
+func (s *SmartContract) ArchiveRecord(ctx contractapi.TransactionContextInterface, id, reason string) (*ArchivedRecord, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to archive a record")
+	}
+	p, err := findState[Patient](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	d, err := findState[Donor](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil && d == nil {
+		return nil, codedError("RECORD_NOT_FOUND", "", "id", "no patient or donor %s", id)
+	}
+	caller, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireNoOpenReference(ctx, id); err != nil {
+		return nil, err
+	}
+
+	rec := &ArchivedRecord{ID: id, ArchivedAt: ts, ArchivedBy: caller, Reason: reason}
+	if p != nil {
+		if err := s.requireOwnerOrg(ctx, p.OwnerMSP); err != nil {
+			return nil, err
+		}
+		if p.Status == StatusArchived {
+			return nil, codedError(CodeRecordArchived, docTypePatient, "", "patient %s is already archived", id)
+		}
+		p.Status, p.ArchivedAt, p.ArchivedBy, p.ArchiveReason = StatusArchived, ts, caller, reason
+		if err := putState(ctx, p.ID, p); err != nil {
+			return nil, err
+		}
+		rec.DocType, rec.HospitalID, rec.OwnerMSP = docTypePatient, p.HospitalID, p.OwnerMSP
+	} else {
+		if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+			return nil, err
+		}
+		if d.VerificationStatus == StatusArchived {
+			return nil, codedError(CodeRecordArchived, docTypeDonor, "", "donor %s is already archived", id)
+		}
+		d.VerificationStatus, d.ArchivedAt, d.ArchivedBy, d.ArchiveReason = StatusArchived, ts, caller, reason
+		d.OrgansAvailable = []string{}
+		if err := putState(ctx, d.ID, d); err != nil {
+			return nil, err
+		}
+		if err := s.syncDonorOrgans(ctx, d); err != nil {
+			return nil, err
+		}
+		rec.DocType, rec.OwnerMSP = docTypeDonor, d.OwnerMSP
+	}
+	return rec, emitEvent(ctx, EventRecordArchived, rec)
+}
+
+// requireNoOpenReference rejects archiving a patient or donor that an open match or a
+// pending offer still depends on. Completed matches do not block: the archived record
+// stays readable for them.
+func (s *SmartContract) requireNoOpenReference(ctx contractapi.TransactionContextInterface, id string) error {
+	matches, err := s.GetAllMatches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if !terminalMatchStatuses[m.Status] && (m.PatientID == id || m.DonorID == id) {
+			return codedError(CodeInvalidTransition, "", "", "%s is referenced by open match %s", id, m.ID)
+		}
+	}
+	offers, err := queryPopulate[Offer](ctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range offers {
+		if o.Status == "PENDING" && (o.PatientID == id || o.DonorID == id) {
+			return codedError(CodeInvalidTransition, docTypeOffer, "", "%s is referenced by pending offer %s", id, o.ID)
+		}
+	}
+	return nil
+}
+
+// requireNotArchived rejects changes to an archived donor.
+func requireNotArchived(d *Donor) error {
+	if d.VerificationStatus == StatusArchived {
+		return codedError(CodeRecordArchived, docTypeDonor, "", "donor %s was archived at %s", d.ID, d.ArchivedAt)
+	}
+	return nil
+}
+
+// requirePatientNotArchived rejects changes to an archived patient.
+func requirePatientNotArchived(p *Patient) error {
+	if p.Status == StatusArchived {
+		return codedError(CodeRecordArchived, docTypePatient, "", "patient %s was archived at %s", p.ID, p.ArchivedAt)
+	}
+	return nil
+}
+
+// GetArchivedRecords lists archived patients and donors, oldest archival first, for
+// regulators and network admins. docType may be "patient", "donor" or empty for both.
+func (s *SmartContract) GetArchivedRecords(ctx contractapi.TransactionContextInterface, docType string) ([]*ArchivedRecord, error) {
+	if err := requireRole(ctx, RoleRegulator, RoleAdmin); err != nil {
+		return nil, err
+	}
+	if docType != "" && docType != docTypePatient && docType != docTypeDonor {
+		return nil, codedError(CodeInvalidArgument, "", "docType", "docType must be %q, %q or empty", docTypePatient, docTypeDonor)
+	}
+	records := []*ArchivedRecord{}
+	if docType != docTypeDonor {
+		patients, err := queryPopulate[Patient](ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patients {
+			if p.Status == StatusArchived {
+				records = append(records, &ArchivedRecord{
+					ID: p.ID, DocType: docTypePatient, HospitalID: p.HospitalID, OwnerMSP: p.OwnerMSP,
+					ArchivedAt: p.ArchivedAt, ArchivedBy: p.ArchivedBy, Reason: p.ArchiveReason,
+				})
+			}
+		}
+	}
+	if docType != docTypePatient {
+		donors, err := queryPopulate[Donor](ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range donors {
+			if d.VerificationStatus == StatusArchived {
+				records = append(records, &ArchivedRecord{
+					ID: d.ID, DocType: docTypeDonor, OwnerMSP: d.OwnerMSP,
+					ArchivedAt: d.ArchivedAt, ArchivedBy: d.ArchivedBy, Reason: d.ArchiveReason,
+				})
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return compareByCreatedAt(records[i].ArchivedAt, records[j].ArchivedAt) < 0
+	})
+	return records, nil
+}
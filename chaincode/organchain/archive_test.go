@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArchiveRecordIsBlockedByOpenMatches(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	l.mustInvoke("CreateMatch", "MATCH-2", "PAT-002", "DON-101", "Liver")
+	l.mustInvoke("ApproveMatch", "MATCH-2", "1")
+
+	for _, tc := range []struct{ id, match string }{
+		{"PAT-001", "MATCH-1"},
+		{"PAT-002", "MATCH-2"},
+		// DON-101 is held by both; the approved match must block it as well.
+		{"DON-101", "MATCH-"},
+	} {
+		err := l.mustFail("ArchiveRecord", tc.id, "duplicate registration")
+		if !strings.Contains(err.Message, tc.match) {
+			t.Errorf("archiving %s failed with %q, want it to name %s", tc.id, err.Message, tc.match)
+		}
+	}
+	if p := l.patient("PAT-001"); p.Status == StatusArchived {
+		t.Error("PAT-001 was archived while its match was pending")
+	}
+	if d := l.donor("DON-101"); d.VerificationStatus == StatusArchived {
+		t.Error("DON-101 was archived while its match was approved")
+	}
+
+	// Once the pending match is rejected only the approved one still holds the donor.
+	l.mustInvoke("RejectMatch", "MATCH-1", ReasonOrganQuality, "biopsy findings", "1")
+	if err := l.mustFail("ArchiveRecord", "DON-101", "duplicate registration"); !strings.Contains(err.Message, "MATCH-2") {
+		t.Errorf("archiving DON-101 failed with %q, want it to name MATCH-2", err.Message)
+	}
+}
+
+func TestArchiveRecord(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	l.mustInvoke("RejectMatch", "MATCH-1", ReasonOrganQuality, "biopsy findings", "1")
+
+	// A rejected match no longer holds the patient.
+	l.mustInvoke("ArchiveRecord", "PAT-001", "duplicate registration")
+	expectEvent(t, l, EventRecordArchived, map[string]string{
+		"id": "PAT-001", "docType": docTypePatient, "hospitalId": "HOSP-001", "reason": "duplicate registration",
+	})
+	if p := l.patient("PAT-001"); p.Status != StatusArchived || p.ArchiveReason != "duplicate registration" {
+		t.Errorf("patient = %s %q, want archived for a duplicate registration", p.Status, p.ArchiveReason)
+	}
+	l.mustFail("ArchiveRecord", "PAT-001", "duplicate registration")
+
+	l.mustInvoke("ArchiveRecord", "DON-103", "consent withdrawn")
+	expectEvent(t, l, EventRecordArchived, map[string]string{"id": "DON-103", "docType": docTypeDonor})
+	if d := l.donor("DON-103"); d.VerificationStatus != StatusArchived || len(d.OrgansAvailable) != 0 {
+		t.Errorf("donor = %s %v, want archived with no organs", d.VerificationStatus, d.OrgansAvailable)
+	}
+
+	l.mustFail("ArchiveRecord", "PAT-002", "")
+	l.mustFail("ArchiveRecord", "PAT-999", "duplicate registration")
+}
+
+func TestCreateMatchRefusesArchivedPatients(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("ArchiveRecord", "PAT-001", "duplicate registration")
+
+	if err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney"); err.Code != CodeRecordArchived {
+		t.Errorf("matching an archived patient failed with %s %s, want %s", err.Code, err.Message, CodeRecordArchived)
+	}
+	if p := l.patient("PAT-001"); p.Status != StatusArchived {
+		t.Errorf("patient status = %s, want %s", p.Status, StatusArchived)
+	}
+}
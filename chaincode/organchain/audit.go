@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	docTypeAudit = "audit"
+	// docTypeAuditHead keys, per record type and ID, the chain's latest audit entry.
+	docTypeAuditHead = "auditHead"
+	// auditIDPrefix starts every audit entry ID, which is the prefix, the transaction
+	// ID and the entry's position among the transaction's writes.
+	auditIDPrefix = "AUDIT-"
+	// auditSeqFormat pads sequence numbers in audit keys so they sort as text.
+	auditSeqFormat = "%010d"
+)
+
+// AuditEntry records one write to a record: who made it, through which function, and
+// the SHA-256 of the record's stored JSON before and after. BeforeHash is empty for a
+// new record and AfterHash for a deleted one. Each record type and ID has its own
+// chain of entries, numbered by Seq from 1 in the order they were committed. Entries
+// are only ever added, under the composite key audit / recordType / recordId / seq, so
+// a record's entries can be read in order without replaying block history. PrevHash is
+// the SHA-256 of the stored JSON of the chain's previous entry, so that a removed or
+// altered entry shows.
+type AuditEntry struct {
+	ID         string `json:"id"`
+	Actor      string `json:"actor"`
+	ActorMSP   string `json:"actorMsp"`
+	ActorRole  string `json:"actorRole"`
+	HospitalID string `json:"hospitalId,omitempty" metadata:",optional"`
+	Function   string `json:"function"`
+	RecordType string `json:"recordType"`
+	RecordID   string `json:"recordId"`
+	BeforeHash string `json:"beforeHash"`
+	AfterHash  string `json:"afterHash"`
+	PrevHash   string `json:"prevHash"`
+	Seq        int    `json:"seq"`
+	TxID       string `json:"txId"`
+	Timestamp  string `json:"timestamp"`
+	DocType    string `json:"docType"`
+}
+
+func hashState(bytes []byte) string {
+	if bytes == nil {
+		return ""
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// storedHash returns the hash of the value at key as last written. Reads do not see
+// this transaction's writes, so hashes written earlier in it are remembered on the
+// transaction context.
+func storedHash(ctx contractapi.TransactionContextInterface, key string) (string, error) {
+	if tc, ok := ctx.(*TransactionContext); ok {
+		if h, ok := tc.audited[key]; ok {
+			return h, nil
+		}
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return hashState(bytes), nil
+}
+
+// auditChainHead is the latest entry of a record's audit chain: its hash and sequence
+// number. A chain with no entries has the zero head.
+type auditChainHead struct {
+	Hash string `json:"hash"`
+	Seq  int    `json:"seq"`
+}
+
+// auditHead returns the key of a record's chain head and the head it holds.
+func auditHead(ctx contractapi.TransactionContextInterface, recordType, recordID string) (string, auditChainHead, error) {
+	var head auditChainHead
+	key, err := ctx.GetStub().CreateCompositeKey(docTypeAuditHead, []string{recordType, recordID})
+	if err != nil {
+		return "", head, err
+	}
+	if tc, ok := ctx.(*TransactionContext); ok {
+		if h, ok := tc.auditHeads[key]; ok {
+			return key, h, nil
+		}
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", head, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if bytes != nil {
+		if err := json.Unmarshal(bytes, &head); err != nil {
+			return "", head, fmt.Errorf("invalid audit chain head for %s %s: %v", recordType, recordID, err)
+		}
+	}
+	return key, head, nil
+}
+
+// writeAudit records the write of value to the record stored at key; value is nil when
+// the record is being deleted. It must run before the write itself.
+func writeAudit(ctx contractapi.TransactionContextInterface, recordType, recordID, key string, value []byte) error {
+	before, err := storedHash(ctx, key)
+	if err != nil {
+		return err
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return err
+	}
+	t, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	seq := 0
+	tc, ok := ctx.(*TransactionContext)
+	if ok {
+		seq = tc.auditSeq
+	}
+	headKey, prev, err := auditHead(ctx, recordType, recordID)
+	if err != nil {
+		return err
+	}
+	txID := ctx.GetStub().GetTxID()
+	entry := &AuditEntry{
+		ID: fmt.Sprintf("%s%s-%03d", auditIDPrefix, txID, seq), Actor: actor.ID, ActorMSP: actor.MSPID, ActorRole: actor.Role,
+		HospitalID: actor.HospitalID, Function: invokedFunction(ctx), RecordType: recordType, RecordID: recordID,
+		BeforeHash: before, AfterHash: hashState(value), PrevHash: prev.Hash, Seq: prev.Seq + 1, TxID: txID, Timestamp: t.Format(time.RFC3339), DocType: docTypeAudit,
+	}
+	auditKey, err := ctx.GetStub().CreateCompositeKey(docTypeAudit, []string{recordType, recordID, fmt.Sprintf(auditSeqFormat, entry.Seq)})
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(auditKey, bytes); err != nil {
+		return err
+	}
+	head := auditChainHead{Hash: hashState(bytes), Seq: entry.Seq}
+	headBytes, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(headKey, headBytes); err != nil {
+		return err
+	}
+	if ok {
+		if tc.audited == nil {
+			tc.audited, tc.auditHeads = map[string]string{}, map[string]auditChainHead{}
+		}
+		tc.audited[key] = entry.AfterHash
+		tc.auditHeads[headKey] = head
+		tc.auditSeq++
+	}
+	return nil
+}
+
+// storedAuditEntry is an audit entry with the JSON it is stored as, which its
+// successor's PrevHash is computed over.
+type storedAuditEntry struct {
+	entry *AuditEntry
+	json  []byte
+}
+
+// parseDateBound reads a date filter, either a date such as 2026-01-31 or an RFC 3339
+// timestamp. A date used as an upper bound covers the whole day. Empty means unbounded.
+func parseDateBound(field, value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, codedError(CodeInvalidArgument, "", field, "%s %q must be a date such as 2026-01-31 or an RFC 3339 timestamp", field, value)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// auditEntries returns a record's audit entries between two dates in chain order. The
+// range runs from the first entry at or after fromDate to the last at or before
+// toDate, so it never leaves a gap in the chain even where transaction timestamps
+// are out of commit order.
+func auditEntries(ctx contractapi.TransactionContextInterface, recordType, recordID, fromDate, toDate string) ([]*storedAuditEntry, error) {
+	if err := validateFields(validateRequired("recordType", recordType), validateRequired("recordId", recordID)); err != nil {
+		return nil, err
+	}
+	from, errFrom := parseDateBound("fromDate", fromDate, false)
+	to, errTo := parseDateBound("toDate", toDate, true)
+	if err := validateFields(errFrom, errTo); err != nil {
+		return nil, err
+	}
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docTypeAudit, []string{recordType, recordID})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	entries := []*storedAuditEntry{}
+	first, last := -1, -1
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q on audit entry %s: %v", e.Timestamp, e.ID, err)
+		}
+		if first < 0 && (from == nil || !at.Before(*from)) {
+			first = len(entries)
+		}
+		if to == nil || !at.After(*to) {
+			last = len(entries)
+		}
+		entries = append(entries, &storedAuditEntry{entry: &e, json: kv.Value})
+	}
+	if first < 0 || last < first {
+		return []*storedAuditEntry{}, nil
+	}
+	return entries[first : last+1], nil
+}
+
+// AuditPage is one page of a record's audit trail plus the bookmark for the next call.
+type AuditPage struct {
+	Records      []*AuditEntry `json:"records"`
+	Bookmark     string        `json:"bookmark"`
+	FetchedCount int32         `json:"fetchedCount"`
+}
+
+// GetAuditTrail returns a page of the audit entries of a record, given by its
+// recordType (the docType, e.g. patient) and ID, in chain order and optionally between
+// two dates; see parseDateBound and auditEntries. The bookmark is an offset into the
+// trail, as for record histories.
+func (s *SmartContract) GetAuditTrail(ctx contractapi.TransactionContextInterface, recordType, recordId, fromDate, toDate string, pageSize int32, bookmark string) (*AuditPage, error) {
+	if err := requireRole(ctx, RoleRegulator, RoleAdmin); err != nil {
+		return nil, err
+	}
+	stored, err := auditEntries(ctx, recordType, recordId, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*AuditEntry, len(stored))
+	for i, e := range stored {
+		entries[i] = e.entry
+	}
+	page, next, fetched, err := historyPage(entries, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditPage{Records: page, Bookmark: next, FetchedCount: fetched}, nil
+}
+
+// AuditBundleEntry is an audit entry exactly as stored, with its SHA-256.
+type AuditBundleEntry struct {
+	Entry string `json:"entry"`
+	Hash  string `json:"hash"`
+}
+
+// AuditBundle is a record's audit trail packaged for independent checking: each
+// entry's hash is the SHA-256 of its Entry text, and each entry's prevHash must equal
+// the hash of the entry before it, whose seq is one less. The first entry's prevHash
+// links to the entry before the bundle's date range, or is empty if the trail starts
+// there. HeadHash is the hash of the record's latest entry on the ledger when the
+// bundle was exported.
+type AuditBundle struct {
+	RecordType  string              `json:"recordType"`
+	RecordID    string              `json:"recordId"`
+	FromDate    string              `json:"fromDate"`
+	ToDate      string              `json:"toDate"`
+	Entries     []*AuditBundleEntry `json:"entries"`
+	HeadHash    string              `json:"headHash"`
+	ChainIntact bool                `json:"chainIntact"`
+	ExportedBy  string              `json:"exportedBy"`
+	ExportedAt  string              `json:"exportedAt"`
+}
+
+// ExportAuditBundle exports a record's audit trail between two dates as an AuditBundle,
+// checking the hash chain as it goes.
+func (s *SmartContract) ExportAuditBundle(ctx contractapi.TransactionContextInterface, recordType, recordId, fromDate, toDate string) (*AuditBundle, error) {
+	if err := requireRole(ctx, RoleRegulator, RoleAdmin); err != nil {
+		return nil, err
+	}
+	stored, err := auditEntries(ctx, recordType, recordId, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	_, head, err := auditHead(ctx, recordType, recordId)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &AuditBundle{
+		RecordType: recordType, RecordID: recordId, FromDate: fromDate, ToDate: toDate, Entries: []*AuditBundleEntry{},
+		HeadHash: head.Hash, ChainIntact: true, ExportedBy: actor.ID, ExportedAt: ts,
+	}
+	for i, e := range stored {
+		hash := hashState(e.json)
+		if i > 0 && (e.entry.PrevHash != bundle.Entries[i-1].Hash || e.entry.Seq != stored[i-1].entry.Seq+1) {
+			bundle.ChainIntact = false
+		}
+		bundle.Entries = append(bundle.Entries, &AuditBundleEntry{Entry: string(e.json), Hash: hash})
+	}
+	return bundle, nil
+}
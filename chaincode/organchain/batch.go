@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxBatchSize caps the records of one batch call, keeping its read-write set within
+// what the ordering service accepts.
+const maxBatchSize = 500
+
+// BatchItemResult reports what became of one record of a batch, by its position in
+// the request. Code, Message, Field and Errors say why a record was not created, as
+// in ChaincodeError.
+type BatchItemResult struct {
+	Index   int           `json:"index"`
+	ID      string        `json:"id"`
+	Created bool          `json:"created"`
+	Code    string        `json:"code,omitempty" metadata:",optional"`
+	Message string        `json:"message,omitempty" metadata:",optional"`
+	Field   string        `json:"field,omitempty" metadata:",optional"`
+	Errors  []*FieldError `json:"errors,omitempty" metadata:",optional"`
+}
+
+// BatchResult is the outcome of a batch call, with one result per record in order.
+type BatchResult struct {
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []*BatchItemResult `json:"results"`
+}
+
+func (r *BatchResult) created(index int, id string) {
+	r.Created++
+	r.Results = append(r.Results, &BatchItemResult{Index: index, ID: id, Created: true})
+}
+
+func (r *BatchResult) failed(index int, id string, err error) {
+	item := &BatchItemResult{Index: index, ID: id}
+	item.Code, item.Message, item.Field, item.Errors = errorFields(err)
+	r.Failed++
+	r.Results = append(r.Results, item)
+}
+
+// errorFields splits err into the fields of its envelope for reporting as data. Errors
+// without a code are reported as INVALID_ARGUMENT.
+func errorFields(err error) (code, message, field string, fieldErrors []*FieldError) {
+	var ce *ChaincodeError
+	if errors.As(err, &ce) {
+		return ce.Code, ce.Message, ce.Field, ce.Errors
+	}
+	return CodeInvalidArgument, err.Error(), "", nil
+}
+
+// parseBatch reads the JSON array of records passed to a batch call.
+func parseBatch[T any](recordsJSON string) ([]*T, error) {
+	var records []*T
+	if err := json.Unmarshal([]byte(recordsJSON), &records); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "records", "records must be a JSON array of objects: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, codedError(CodeInvalidArgument, "", "records", "at least one record is required")
+	}
+	if len(records) > maxBatchSize {
+		return nil, codedError(CodeInvalidArgument, "", "records", "a batch may hold at most %d records, not %d", maxBatchSize, len(records))
+	}
+	for i, r := range records {
+		if r == nil {
+			return nil, codedError(CodeInvalidArgument, "", "records", "record %d is null", i)
+		}
+	}
+	return records, nil
+}
+
+// donorPIIByID is the donor_pii transient field of a batch: each donor's PII by donor ID.
+type donorPIIByID map[string]json.RawMessage
+
+func transientDonorPIIByID(ctx contractapi.TransactionContextInterface) (donorPIIByID, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	piiByID := donorPIIByID{}
+	if raw, ok := transient[donorPIITransientKey]; ok {
+		if err := json.Unmarshal(raw, &piiByID); err != nil {
+			return nil, codedError(CodeInvalidArgument, "", "pii", "donor PII must be a JSON object keyed by donor ID: %v", err)
+		}
+	}
+	return piiByID, nil
+}
+
+// reader returns newDonor's PII reader for one donor.
+func (m donorPIIByID) reader(id string) func() (*DonorPrivate, error) {
+	return func() (*DonorPrivate, error) {
+		raw, ok := m[id]
+		if !ok {
+			return nil, nil
+		}
+		return parseDonorPII(raw)
+	}
+}
+
+// repeatedInBatch reports an ID already seen earlier in the batch. RecordExists reads
+// the ledger as it was before the transaction, so it cannot catch these.
+func repeatedInBatch(seen map[string]bool, docType, id string) error {
+	if id == "" {
+		return nil
+	}
+	if seen[id] {
+		return codedError(CodeAlreadyExists, docType, "", "%s %s appears more than once in the request", docType, id)
+	}
+	seen[id] = true
+	return nil
+}
+
+// CreatePatientsBatch registers a JSON array of patients at the caller's hospital in
+// one transaction, each item taking CreatePatient's arguments; see PatientInput. Each
+// patient is validated as CreatePatient would; those that pass are created and those
+// that fail are reported in the result without affecting the rest.
+func (s *SmartContract) CreatePatientsBatch(ctx contractapi.TransactionContextInterface, recordsJSON string) (*BatchResult, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := parseBatch[PatientInput](recordsJSON)
+	if err != nil {
+		return nil, err
+	}
+	result := &BatchResult{Results: []*BatchItemResult{}}
+	seen, ids := map[string]bool{}, []string{}
+	for i, in := range inputs {
+		if err := repeatedInBatch(seen, docTypePatient, in.ID); err != nil {
+			result.failed(i, in.ID, err)
+			continue
+		}
+		p, err := s.newPatient(ctx, in)
+		if err != nil {
+			result.failed(i, in.ID, err)
+			continue
+		}
+		if err := putState(ctx, p.ID, p); err != nil {
+			return nil, err
+		}
+		result.created(i, p.ID)
+		ids = append(ids, p.ID)
+	}
+	if len(ids) > 0 {
+		if err := emitEvent(ctx, EventPatientsBatchCreated, map[string]interface{}{"patientIds": ids, "hospitalId": hospitalId}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// CreateDonorsBatch registers a JSON array of donors in one transaction, each item
+// taking CreateDonor's arguments with the organ list and details as JSON values; see
+// DonorInput. The donor_pii transient field holds a JSON object of each donor's PII by
+// donor ID. Donors are validated and reported as in CreatePatientsBatch.
+func (s *SmartContract) CreateDonorsBatch(ctx contractapi.TransactionContextInterface, recordsJSON string) (*BatchResult, error) {
+	inputs, err := parseBatch[DonorInput](recordsJSON)
+	if err != nil {
+		return nil, err
+	}
+	piiByID, err := transientDonorPIIByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &BatchResult{Results: []*BatchItemResult{}}
+	seen, ids := map[string]bool{}, []string{}
+	for i, in := range inputs {
+		if err := repeatedInBatch(seen, docTypeDonor, in.ID); err != nil {
+			result.failed(i, in.ID, err)
+			continue
+		}
+		n, err := s.newDonor(ctx, in, piiByID.reader(in.ID))
+		if err != nil {
+			result.failed(i, in.ID, err)
+			continue
+		}
+		if err := s.writeDonor(ctx, n); err != nil {
+			return nil, err
+		}
+		result.created(i, in.ID)
+		ids = append(ids, in.ID)
+	}
+	if len(ids) > 0 {
+		if err := emitEvent(ctx, EventDonorsBatchCreated, map[string]interface{}{"donorIds": ids}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Clinical score entries are keyed by patient and a zero-padded sequence number, like
+// custody events, so a patient's score history reads back in order.
+const docTypeScore = "clinicalScore"
+
+// Liver patients are scored with MELD (adults) or PELD (children under 12). A higher
+// score means a higher risk of death on the waitlist.
+const (
+	ScoreMELD = "MELD"
+	ScorePELD = "PELD"
+)
+
+// scoreRanges bounds each score type. MELD runs from 6 to 40; PELD has no fixed range,
+// so it is bounded loosely to catch entry errors.
+var scoreRanges = map[string][2]int{ScoreMELD: {6, 40}, ScorePELD: {-10, 99}}
+
+// ClinicalScore is one MELD/PELD reading recorded for a patient.
+type ClinicalScore struct {
+	PatientID     string `json:"patientId"`
+	Sequence      int    `json:"sequence"`
+	ScoreType     string `json:"scoreType"`
+	Score         int    `json:"score"`
+	HospitalID    string `json:"hospitalId"`
+	TxID          string `json:"txId"`
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// LiverCandidate is a waiting liver patient ranked against a donor liver.
+type LiverCandidate struct {
+	Rank          int    `json:"rank"`
+	PatientID     string `json:"patientId"`
+	HospitalID    string `json:"hospitalId"`
+	Urgency       string `json:"urgency"`
+	ScoreType     string `json:"scoreType,omitempty" metadata:",optional"`
+	Score         int    `json:"score"`
+	Scored        bool   `json:"scored"`
+	BloodTypeTier string `json:"bloodTypeTier"`
+	HLAScore      int    `json:"hlaScore"`
+	WaitingSince  string `json:"waitingSince"`
+}
+
+func validateClinicalScore(scoreType string, score int) error {
+	bounds, ok := scoreRanges[scoreType]
+	if !ok {
+		return codedError(CodeInvalidArgument, "", "scoreType", "invalid score type %q: must be %s or %s", scoreType, ScoreMELD, ScorePELD)
+	}
+	if score < bounds[0] || score > bounds[1] {
+		return codedError(CodeInvalidArgument, "", "score", "%s score must be between %d and %d", scoreType, bounds[0], bounds[1])
+	}
+	return nil
+}
+
+// UpdateClinicalScore records a new MELD or PELD score for a waiting liver patient.
+// The patient record carries the current score; every reading is also appended to the
+// patient's score history.
+func (s *SmartContract) UpdateClinicalScore(ctx contractapi.TransactionContextInterface, patientId, scoreType string, score int, expectedVersion int) (*ClinicalScore, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	scoreType = strings.ToUpper(scoreType)
+	if err := validateClinicalScore(scoreType, score); err != nil {
+		return nil, err
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot record score")
+	}
+	if p.OrganNeeded != "Liver" {
+		return nil, codedError(CodeInvalidArgument, docTypePatient, "patientId", "clinical scores apply to liver patients; %s needs a %s", p.ID, p.OrganNeeded)
+	}
+	if p.Status != "WAITING" {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is %s, not waiting", p.ID, p.Status)
+	}
+	history, err := s.GetClinicalScoreHistory(ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ClinicalScore{
+		PatientID: patientId, Sequence: len(history) + 1, ScoreType: scoreType, Score: score,
+		HospitalID: hospitalId, TxID: ctx.GetStub().GetTxID(), DocType: docTypeScore, SchemaVersion: currentSchemaVersion, Timestamp: ts,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(docTypeScore, []string{patientId, fmt.Sprintf("%06d", entry.Sequence)})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, docTypeScore, patientId, key, bytes); err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(key, bytes); err != nil {
+		return nil, err
+	}
+	p.ScoreType = scoreType
+	p.ClinicalScore = score
+	p.ScoreUpdatedAt = ts
+	if err := putState(ctx, patientId, p); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventPatientUpdated, map[string]interface{}{
+		"patientId": patientId, "scoreType": scoreType, "score": score, "hospitalId": hospitalId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetClinicalScoreHistory returns every score recorded for a patient, oldest first.
+func (s *SmartContract) GetClinicalScoreHistory(ctx contractapi.TransactionContextInterface, patientId string) ([]*ClinicalScore, error) {
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docTypeScore, []string{patientId})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	history := []*ClinicalScore{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		var e ClinicalScore
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			return nil, err
+		}
+		history = append(history, &e)
+	}
+	return history, nil
+}
+
+// GetLiverAllocation ranks the compatible waiting patients for a donor's liver the way
+// liver allocation does: STATUS_1A patients first, then highest MELD/PELD score, then
+// longest on the waitlist. Patients without a score rank after every scored patient.
+func (s *SmartContract) GetLiverAllocation(ctx contractapi.TransactionContextInterface, donorId string) ([]*LiverCandidate, error) {
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if d.VerificationStatus != "VERIFIED" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor not verified")
+	}
+	if !containsString(d.OrgansAvailable, "Liver") {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has no liver available", d.ID)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*LiverCandidate{}
+	for _, p := range patients {
+		if p.Status != "WAITING" || p.OrganNeeded != "Liver" || directedElsewhere(d, p.ID) {
+			continue
+		}
+		compat := s.evaluateCompatibility(cfg, p, d, "Liver", *now)
+		if !compat.Compatible {
+			continue
+		}
+		c := &LiverCandidate{
+			PatientID: p.ID, HospitalID: p.HospitalID, Urgency: p.Urgency, ScoreType: p.ScoreType,
+			BloodTypeTier: bloodTypeTier(p.BloodType, d.BloodType), HLAScore: compat.HLAScore, WaitingSince: p.CreatedAt,
+		}
+		if p.ScoreType != "" {
+			c.Score, c.Scored = p.ClinicalScore, true
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a1, b1 := urgencyTier(a.Urgency) == 0, urgencyTier(b.Urgency) == 0; a1 != b1 {
+			return a1
+		}
+		if a.Scored != b.Scored {
+			return a.Scored
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return compareByCreatedAt(a.WaitingSince, b.WaitingSince) < 0
+	})
+	for i, c := range candidates {
+		c.Rank = i + 1
+	}
+	return candidates, nil
+}
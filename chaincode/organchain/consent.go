@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ConsentVersion is one signed version of a donor's consent document. Scope lists the
+// organ types the donor agreed to donate; ExpiresAt is empty for a consent that does
+// not lapse.
+type ConsentVersion struct {
+	Version      int      `json:"version"`
+	DocumentHash string   `json:"documentHash"`
+	SignedAt     string   `json:"signedAt"`
+	ExpiresAt    string   `json:"expiresAt,omitempty" metadata:",optional"`
+	Scope        []string `json:"scope"`
+	RecordedBy   string   `json:"recordedBy"`
+	RecordedAt   string   `json:"recordedAt"`
+	// Signature is the donor's ECDSA signature over DocumentHash, kept once
+	// VerifyConsentSignature has checked it against the donor's registered key.
+	Signature           string `json:"signature,omitempty" metadata:",optional"`
+	SignerKeyID         string `json:"signerKeyId,omitempty" metadata:",optional"`
+	SignatureVerifiedAt string `json:"signatureVerifiedAt,omitempty" metadata:",optional"`
+}
+
+// latestConsent returns the donor's current consent version, or nil for donors
+// registered before consent was versioned, whose ConsentHash is taken to cover every
+// listed organ without expiry.
+func latestConsent(d *Donor) *ConsentVersion {
+	if len(d.Consents) == 0 {
+		return nil
+	}
+	return d.Consents[len(d.Consents)-1]
+}
+
+// initialConsent is the first consent version of a newly registered donor, taken from
+// the ConsentHash they registered with. It covers the organs they listed and does not
+// expire; RecordConsent adds versions with a narrower scope or an expiry.
+func initialConsent(d *Donor, recordedBy, ts string) *ConsentVersion {
+	return &ConsentVersion{
+		Version: 1, DocumentHash: d.ConsentHash, SignedAt: ts,
+		Scope: append([]string{}, d.OrgansAvailable...), RecordedBy: recordedBy, RecordedAt: ts,
+	}
+}
+
+// consentExpired reports whether a consent version had lapsed by now.
+func consentExpired(c *ConsentVersion, now time.Time) bool {
+	if c.ExpiresAt == "" {
+		return false
+	}
+	expires, err := parseTimestamp(c.ExpiresAt)
+	return err != nil || !now.Before(expires)
+}
+
+// consentProblem explains why the donor's latest consent does not allow organType to
+// be allocated at now, or returns "" if it does.
+func consentProblem(d *Donor, organType string, now time.Time) string {
+	c := latestConsent(d)
+	if c == nil {
+		return ""
+	}
+	if consentExpired(c, now) {
+		return fmt.Sprintf("consent of donor %s expired at %s", d.ID, c.ExpiresAt)
+	}
+	if !containsString(c.Scope, organType) {
+		return fmt.Sprintf("consent of donor %s does not cover %s", d.ID, organType)
+	}
+	return ""
+}
+
+// RecordConsent adds a new version of a donor's consent document, signed at signedAt
+// and covering the organs in scopeJSON. expiresAt may be left empty for a consent that
+// does not lapse. The new version replaces the previous one for matching.
+func (s *SmartContract) RecordConsent(ctx contractapi.TransactionContextInterface, donorId, documentHash, signedAt, expiresAt, scopeJSON string) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot record consent")
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if d.VerificationStatus == "WITHDRAWN" {
+		return nil, codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", donorId)
+	}
+	if documentHash == "" {
+		return nil, codedError(CodeInvalidArgument, "", "documentHash", "a consent document hash is required")
+	}
+	scope, err := parseOrganList(scopeJSON)
+	if err != nil {
+		return nil, wrapError(err, "invalid consent scope")
+	}
+	if err := validateDonorOrgans(d.DonorType, scope); err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := parseTimestamp(signedAt)
+	if err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "signedAt", "signedAt must be an RFC3339 timestamp: %v", err)
+	}
+	if signed.After(*now) {
+		return nil, codedError(CodeInvalidArgument, "", "signedAt", "signedAt %s is in the future", signedAt)
+	}
+	if expiresAt != "" {
+		expires, err := parseTimestamp(expiresAt)
+		if err != nil {
+			return nil, codedError(CodeInvalidArgument, "", "expiresAt", "expiresAt must be an RFC3339 timestamp: %v", err)
+		}
+		if !expires.After(*now) {
+			return nil, codedError(CodeInvalidArgument, "", "expiresAt", "consent expiring at %s has already expired", expiresAt)
+		}
+	}
+
+	c := &ConsentVersion{
+		Version: len(d.Consents) + 1, DocumentHash: documentHash, SignedAt: signedAt, ExpiresAt: expiresAt,
+		Scope: scope, RecordedBy: hospitalId, RecordedAt: now.Format(time.RFC3339),
+	}
+	d.Consents = append(d.Consents, c)
+	d.ConsentHash = documentHash
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventConsentRecorded, map[string]interface{}{
+		"donorId": d.ID, "version": c.Version, "documentHash": documentHash, "expiresAt": expiresAt, "scope": scope,
+	})
+}
+
+// SetResearchConsent records whether a donor agrees to their de-identified data being
+// included in research datasets. Donors are left out until they opt in.
+func (s *SmartContract) SetResearchConsent(ctx contractapi.TransactionContextInterface, donorId string, consent bool) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if consent && d.VerificationStatus == "WITHDRAWN" {
+		return nil, codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", donorId)
+	}
+	d.ResearchConsent = consent
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventConsentRecorded, map[string]interface{}{"donorId": d.ID, "researchConsent": consent})
+}
+
+// parseDonorPublicKey reads an ECDSA public key from a PEM "PUBLIC KEY" block or from
+// the certificate in a PEM "CERTIFICATE" block.
+func parseDonorPublicKey(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, codedError(CodeInvalidArgument, "", "publicKey", "public key must be PEM encoded")
+	}
+	var key interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, codedError(CodeInvalidArgument, "", "publicKey", "invalid public key: %v", err)
+		}
+		key = k
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, codedError(CodeInvalidArgument, "", "publicKey", "invalid certificate: %v", err)
+		}
+		key = cert.PublicKey
+	default:
+		return nil, codedError(CodeInvalidArgument, "", "publicKey", "unsupported PEM block %q: expected PUBLIC KEY or CERTIFICATE", block.Type)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, codedError(CodeInvalidArgument, "", "publicKey", "donor keys must be ECDSA keys")
+	}
+	return pub, nil
+}
+
+// publicKeyID identifies a public key by the SHA-256 of its DER encoding.
+func publicKeyID(pub *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// decodeHex decodes a hex string with or without a 0x prefix.
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x"))
+}
+
+// verifyDonorSignature checks an ECDSA P-256/SHA-256 signature over the bytes of a
+// hex document hash, such as a consent document's or a contact change's. The signature may be ASN.1 DER, as produced by most libraries, or
+// the raw r||s form that WebCrypto produces.
+func verifyDonorSignature(pub *ecdsa.PublicKey, documentHash, signatureHex string) error {
+	doc, err := decodeHex(documentHash)
+	if err != nil || len(doc) == 0 {
+		return codedError(CodeInvalidArgument, "", "documentHash", "document hash %q is not hex and cannot be verified", documentHash)
+	}
+	sig, err := decodeHex(signatureHex)
+	if err != nil || len(sig) == 0 {
+		return codedError(CodeInvalidArgument, "", "signature", "signature must be hex encoded")
+	}
+	digest := sha256.Sum256(doc)
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if len(sig) == 2*size {
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if ecdsa.Verify(pub, digest[:], r, s) {
+			return nil
+		}
+	}
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		return codedError(CodeForbidden, docTypeDonor, "signature", "signature does not match the document and donor key")
+	}
+	return nil
+}
+
+// consentRevocation is what a donor signs to revoke their consent through RevokeConsent.
+// It names the donor record version, so a revocation cannot be produced from a
+// signature the donor made over anything else, such as a consent document.
+type consentRevocation struct {
+	DonorID string `json:"donorId"`
+	Action  string `json:"action"`
+	Version int    `json:"version"`
+}
+
+// consentRevocationHash is the hex SHA-256 of a donor's consent revocation, the
+// document hash their signature covers.
+func consentRevocationHash(donorId string, version int) (string, error) {
+	data, err := json.Marshal(consentRevocation{DonorID: donorId, Action: "REVOKE_CONSENT", Version: version})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RegisterDonorPublicKey stores the public key, or a certificate holding it, that the
+// donor signs consent documents with. Replacing the key does not affect signatures
+// already verified, which keep the ID of the key that verified them.
+func (s *SmartContract) RegisterDonorPublicKey(ctx contractapi.TransactionContextInterface, donorId, publicKeyPEM string) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot register donor key")
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	pub, err := parseDonorPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if d.PublicKeyID, err = publicKeyID(pub); err != nil {
+		return nil, err
+	}
+	d.PublicKeyPEM = publicKeyPEM
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventDonorUpdated, map[string]string{
+		"donorId": d.ID, "publicKeyId": d.PublicKeyID, "hospitalId": hospitalId,
+	})
+}
+
+// VerifyConsentSignature checks the donor's signature over the document hash of one of
+// their consent versions against their registered public key, and records it on that
+// version once it verifies. A signature that does not verify fails the transaction.
+func (s *SmartContract) VerifyConsentSignature(ctx contractapi.TransactionContextInterface, donorId string, version int, signatureHex string) (*ConsentVersion, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if d.PublicKeyPEM == "" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has no registered public key", d.ID)
+	}
+	if version < 1 || version > len(d.Consents) {
+		return nil, codedError(CodeInvalidArgument, docTypeDonor, "version", "donor %s has no consent version %d", d.ID, version)
+	}
+	c := d.Consents[version-1]
+	if c.SignatureVerifiedAt != "" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "consent version %d of donor %s is already verified", version, d.ID)
+	}
+	pub, err := parseDonorPublicKey(d.PublicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDonorSignature(pub, c.DocumentHash, signatureHex); err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.Signature, c.SignerKeyID, c.SignatureVerifiedAt = signatureHex, d.PublicKeyID, ts
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return c, emitEvent(ctx, EventConsentVerified, map[string]interface{}{
+		"donorId": d.ID, "version": version, "publicKeyId": d.PublicKeyID,
+	})
+}
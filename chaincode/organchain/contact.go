@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// piiKeyTransientKey is the transient field holding the owning hospital's 32-byte
+// AES-256 key for donor contact details. The key is never written to the ledger.
+const piiKeyTransientKey = "pii_key"
+
+// SealedContact is a donor's email and phone encrypted with AES-256-GCM under the
+// owning hospital's key, so members of the donorPII collection without that key
+// cannot read them from private state. KeyID identifies the key without revealing it.
+type SealedContact struct {
+	KeyID      string `json:"keyId"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type contactDetails struct {
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// transientPIIKey reads the contact encryption key from the transient map, returning
+// nil when the caller sent none.
+func transientPIIKey(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	key, ok := transient[piiKeyTransientKey]
+	if !ok {
+		return nil, nil
+	}
+	if len(key) != 32 {
+		return nil, codedError(CodeInvalidArgument, "", piiKeyTransientKey, "the %q transient field must hold a 32-byte AES-256 key", piiKeyTransientKey)
+	}
+	return key, nil
+}
+
+func piiKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func contactCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealContact moves the email and phone of pii into an encrypted envelope. Every
+// endorsing peer must produce the same ciphertext, so the nonce is derived from the
+// transaction ID and donor ID rather than drawn at random; both are unique per write.
+func sealContact(ctx contractapi.TransactionContextInterface, pii *DonorPrivate, key []byte) error {
+	aead, err := contactCipher(key)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(contactDetails{Email: pii.Email, Phone: pii.Phone})
+	if err != nil {
+		return err
+	}
+	seed := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + "|" + pii.ID))
+	nonce := seed[:aead.NonceSize()]
+	sealed := aead.Seal(nil, nonce, plain, []byte(pii.ID))
+	pii.Contact = &SealedContact{
+		KeyID:      piiKeyID(key),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(sealed),
+	}
+	pii.Email, pii.Phone = "", ""
+	return nil
+}
+
+// openContact restores the email and phone of pii from its envelope.
+func openContact(pii *DonorPrivate, key []byte) error {
+	if piiKeyID(key) != pii.Contact.KeyID {
+		return codedError(CodeForbidden, docTypeDonor, "", "contact details of donor %s were encrypted with a different key", pii.ID)
+	}
+	aead, err := contactCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(pii.Contact.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return fmt.Errorf("corrupt contact envelope for donor %s", pii.ID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(pii.Contact.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("corrupt contact envelope for donor %s", pii.ID)
+	}
+	plain, err := aead.Open(nil, nonce, sealed, []byte(pii.ID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt contact details of donor %s", pii.ID)
+	}
+	var c contactDetails
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return err
+	}
+	pii.Email, pii.Phone, pii.Contact = c.Email, c.Phone, nil
+	return nil
+}
+
+// Who a contact change is recorded as coming from.
+const (
+	ContactUpdatedByDonor    = "DONOR"
+	ContactUpdatedByHospital = "HOSPITAL"
+)
+
+// contactChange is what a donor signs to authorize UpdateDonorContact. It names the
+// record version it applies to, so a signature cannot be replayed once the record
+// has moved on.
+type contactChange struct {
+	DonorID string `json:"donorId"`
+	Version int    `json:"version"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+}
+
+// contactChangeHash is the hex SHA-256 of a contact change, the document hash the
+// donor's signature covers.
+func contactChangeHash(donorId string, version int, email, phone string) (string, error) {
+	data, err := json.Marshal(contactChange{DonorID: donorId, Version: version, Email: email, Phone: phone})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// UpdateDonorContact changes a donor's email or phone, read from the donor_pii
+// transient field; a field left empty is kept. Nothing else on the donor changes, so
+// a verified donor stays verified. Without a signature the change is made on the
+// owning hospital's authority. With one, signatureHex must be the donor's signature,
+// under their registered key, over contactChangeHash of the new details and
+// expectedVersion, and the change is recorded as the donor's own. Either way it is
+// submitted through the owning org, whose peers hold the donor's private data.
+func (s *SmartContract) UpdateDonorContact(ctx contractapi.TransactionContextInterface, donorId, signatureHex string, expectedVersion int) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	update, err := transientDonorPII(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if update == nil || (update.Email == "" && update.Phone == "") {
+		return nil, codedError(CodeInvalidArgument, "", "pii", "an email or phone is required in the %q transient field", donorPIITransientKey)
+	}
+	if update.Name != "" {
+		return nil, codedError(CodeInvalidArgument, "", "name", "only a donor's email and phone may be changed")
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot update donor contact")
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if err := requireDonorPIIPresent(d); err != nil {
+		return nil, err
+	}
+	if err := requireVersion("donor", d.ID, d.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	updatedBy := ContactUpdatedByHospital
+	if signatureHex != "" {
+		if d.PublicKeyPEM == "" {
+			return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has no registered public key", d.ID)
+		}
+		pub, err := parseDonorPublicKey(d.PublicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := contactChangeHash(d.ID, d.Version, update.Email, update.Phone)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyDonorSignature(pub, hash, signatureHex); err != nil {
+			return nil, codedError(CodeForbidden, docTypeDonor, "", "contact change for donor %s is not signed by the donor: %v", d.ID, err)
+		}
+		updatedBy = ContactUpdatedByDonor
+	}
+
+	pii, err := s.GetDonorPrivate(ctx, d.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pii.Contact != nil {
+		return nil, codedError(CodeInvalidArgument, "", piiKeyTransientKey, "donor contact details must be decrypted to change them: supply the hospital key in the %q transient field", piiKeyTransientKey)
+	}
+	fields := []string{}
+	if update.Email != "" && update.Email != pii.Email {
+		pii.Email = update.Email
+		fields = append(fields, "email")
+	}
+	if update.Phone != "" && update.Phone != pii.Phone {
+		pii.Phone = update.Phone
+		fields = append(fields, "phone")
+	}
+	if len(fields) == 0 {
+		return nil, codedError(CodeInvalidArgument, docTypeDonor, "", "nothing to update for donor %s", d.ID)
+	}
+	if d.PIIHash, err = putDonorPII(ctx, d.ID, pii); err != nil {
+		return nil, err
+	}
+	if d.ContactUpdatedAt, err = s.getTimestamp(ctx); err != nil {
+		return nil, err
+	}
+	d.ContactUpdatedBy = updatedBy
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventDonorUpdated, map[string]interface{}{
+		"donorId": d.ID, "fields": fields, "updatedBy": updatedBy, "hospitalId": hospitalId,
+	})
+}
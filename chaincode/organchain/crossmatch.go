@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Crossmatch test types. A virtual crossmatch compares the patient's antibodies with
+// the donor typing on paper; the final crossmatch mixes patient serum with donor
+// cells immediately before surgery and is the one that gates the transplant.
+const (
+	CrossmatchVirtual     = "VIRTUAL"
+	CrossmatchPreliminary = "PRELIMINARY"
+	CrossmatchFinal       = "FINAL"
+)
+
+// CrossmatchTypes are the crossmatch tests that may be recorded against a match.
+var CrossmatchTypes = []string{CrossmatchVirtual, CrossmatchPreliminary, CrossmatchFinal}
+
+// CrossmatchResult is one lab result recorded against a match.
+type CrossmatchResult struct {
+	ResultType string `json:"resultType"`
+	LabID      string `json:"labId"`
+	Positive   bool   `json:"positive"`
+	RecordedBy string `json:"recordedBy"`
+	TxID       string `json:"txId"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// RecordCrossmatchResult appends a lab's crossmatch result to a live match. result is
+// POSITIVE or NEGATIVE. Results are never overwritten; a repeat test is a new entry
+// and the latest final result is the one that counts.
+func (s *SmartContract) RecordCrossmatchResult(ctx contractapi.TransactionContextInterface, matchId, resultType, labId, result string) (*Match, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	resultType = strings.ToUpper(resultType)
+	if !containsString(CrossmatchTypes, resultType) {
+		return nil, codedError(CodeInvalidArgument, "", "resultType", "invalid crossmatch type %q: must be one of %s", resultType, strings.Join(CrossmatchTypes, ", "))
+	}
+	var positive bool
+	switch strings.ToUpper(result) {
+	case "POSITIVE":
+		positive = true
+	case "NEGATIVE":
+	default:
+		return nil, codedError(CodeInvalidArgument, "", "result", "crossmatch result must be POSITIVE or NEGATIVE, got %q", result)
+	}
+	if strings.TrimSpace(labId) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "labId", "a lab ID is required")
+	}
+	m, err := getState[Match](ctx, matchId)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != "PENDING" && m.Status != "APPROVED" {
+		return nil, codedError(CodeInvalidTransition, docTypeMatch, "", "match %s is %s; crossmatches can only be recorded for live matches", m.ID, m.Status)
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Crossmatches = append(m.Crossmatches, &CrossmatchResult{
+		ResultType: resultType, LabID: labId, Positive: positive,
+		RecordedBy: mspID, TxID: ctx.GetStub().GetTxID(), Timestamp: ts,
+	})
+	if err := putState(ctx, m.ID, m); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventCrossmatchRecorded, map[string]interface{}{
+		"matchId": m.ID, "resultType": resultType, "labId": labId, "positive": positive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// requireNegativeCrossmatch fails unless the latest final crossmatch on the match
+// is negative.
+func requireNegativeCrossmatch(m *Match) error {
+	var final *CrossmatchResult
+	for _, c := range m.Crossmatches {
+		if c.ResultType == CrossmatchFinal {
+			final = c
+		}
+	}
+	if final == nil {
+		return codedError(CodeInvalidTransition, docTypeMatch, "", "match %s has no final crossmatch result", m.ID)
+	}
+	if final.Positive {
+		return codedError(CodeInvalidTransition, docTypeMatch, "", "final crossmatch for match %s is positive (lab %s)", m.ID, final.LabID)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Custody events are keyed by organ and a zero-padded sequence number, so a partial-key
+// query returns an organ's trail in order. Only ClearLedger ever removes them.
+const docTypeCustody = "custody"
+
+// CustodyActions are the handling steps that may be logged for an organ.
+var CustodyActions = []string{"RECOVERED", "PACKAGED", "HANDED_OFF", "DISPATCHED", "RECEIVED", "INSPECTED"}
+
+// CustodyEvent is one handoff or handling step in an organ's chain of custody.
+type CustodyEvent struct {
+	OrganID       string `json:"organId"`
+	Sequence      int    `json:"sequence"`
+	Actor         string `json:"actor"`
+	Action        string `json:"action"`
+	Location      string `json:"location"`
+	RecordedBy    string `json:"recordedBy"`
+	TxID          string `json:"txId"`
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// AppendCustodyEvent adds a step to an organ's chain of custody, e.g. the recovery team
+// handing the organ to a courier. Custody starts once a match has reserved the organ.
+func (s *SmartContract) AppendCustodyEvent(ctx contractapi.TransactionContextInterface, organId, actor, action, location string) (*CustodyEvent, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(actor) == "" || strings.TrimSpace(location) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "actor", "actor and location are required")
+	}
+	if !containsString(CustodyActions, action) {
+		return nil, codedError(CodeInvalidArgument, "", "action", "invalid action %q: must be one of %s", action, strings.Join(CustodyActions, ", "))
+	}
+	o, err := getState[Organ](ctx, organId)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status == OrganAvailable {
+		return nil, codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s has not been allocated; custody starts once a match reserves it", organId)
+	}
+	chain, err := s.GetCustodyChain(ctx, organId)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &CustodyEvent{
+		OrganID: organId, Sequence: len(chain) + 1, Actor: actor, Action: action, Location: location,
+		RecordedBy: mspID, TxID: ctx.GetStub().GetTxID(), DocType: docTypeCustody, SchemaVersion: currentSchemaVersion, Timestamp: ts,
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(docTypeCustody, []string{organId, fmt.Sprintf("%06d", e.Sequence)})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, docTypeCustody, organId, key, bytes); err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(key, bytes); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventCustodyRecorded, map[string]interface{}{
+		"organId": organId, "sequence": e.Sequence, "actor": actor, "action": action, "location": location,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetCustodyChain returns an organ's chain of custody, oldest step first.
+func (s *SmartContract) GetCustodyChain(ctx contractapi.TransactionContextInterface, organId string) ([]*CustodyEvent, error) {
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docTypeCustody, []string{organId})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	chain := []*CustodyEvent{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		var e CustodyEvent
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			return nil, err
+		}
+		chain = append(chain, &e)
+	}
+	return chain, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HospitalDashboard is everything a hospital's landing page shows, read in one call.
+type HospitalDashboard struct {
+	HospitalID string `json:"hospitalId"`
+	// WaitingPatients are the hospital's WAITING patients in waitlist order.
+	WaitingPatients []*Patient `json:"waitingPatients"`
+	// PendingVerifications are the donors registered through the hospital's MSP that
+	// still await verification, oldest first.
+	PendingVerifications []*Donor `json:"pendingVerifications"`
+	// ActiveMatches are the matches the hospital created that still hold an organ.
+	ActiveMatches []*Match `json:"activeMatches"`
+	// RecentActivity covers the hospital's patients, matches and transplants and the
+	// donors it verified or rejected, newest first.
+	RecentActivity []*ActivityEntry `json:"recentActivity"`
+	GeneratedAt    string           `json:"generatedAt"`
+}
+
+// GetHospitalDashboard returns a hospital's dashboard. An empty hospitalId means the
+// caller's own hospital. Hospitals and physicians may only read their own; admins,
+// coordinators and regulators may read any.
+func (s *SmartContract) GetHospitalDashboard(ctx contractapi.TransactionContextInterface, hospitalId string) (*HospitalDashboard, error) {
+	scope, err := patientScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hospitalId == "" {
+		hospitalId = scope
+	}
+	if err := validateRequired("hospitalId", hospitalId); err != nil {
+		return nil, err
+	}
+	if scope != "" && hospitalId != scope {
+		return nil, codedError(CodeForbidden, docTypeHospital, "", "hospital %s may not read the dashboard of %s", scope, hospitalId)
+	}
+	hospital, err := getState[Hospital](ctx, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dashboard := &HospitalDashboard{
+		HospitalID: hospitalId, PendingVerifications: []*Donor{}, GeneratedAt: now.Format(time.RFC3339),
+	}
+	feed := &activityFeed{}
+
+	if dashboard.WaitingPatients, err = indexedRecords[Patient](ctx, indexPatientHospital, hospitalId, "WAITING"); err != nil {
+		return nil, err
+	}
+	sortWaitlist(dashboard.WaitingPatients, *now)
+	patients, err := indexedRecords[Patient](ctx, indexPatientHospital, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patients {
+		feed.add("PATIENT_CREATED", p.ID, p.CreatedAt)
+	}
+
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range donors {
+		if d.VerificationStatus == "PENDING_VERIFICATION" && d.OwnerMSP == hospital.OwnerMSP {
+			dashboard.PendingVerifications = append(dashboard.PendingVerifications, d)
+		}
+		if d.VerifiedBy == hospitalId && (d.VerificationStatus == "VERIFIED" || d.VerificationStatus == "REJECTED") {
+			feed.add("DONOR_"+d.VerificationStatus, d.ID, d.VerifiedAt)
+		}
+	}
+	sort.SliceStable(dashboard.PendingVerifications, func(i, j int) bool {
+		return compareByCreatedAt(dashboard.PendingVerifications[i].CreatedAt, dashboard.PendingVerifications[j].CreatedAt) < 0
+	})
+
+	matches, err := matchesByIndex(ctx, indexMatchHospital, hospitalId, func(*Match) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	dashboard.ActiveMatches = []*Match{}
+	for _, m := range matches {
+		feed.add("MATCH_CREATED", m.ID, m.CreatedAt)
+		if !terminalMatchStatuses[m.Status] {
+			dashboard.ActiveMatches = append(dashboard.ActiveMatches, m)
+		}
+	}
+
+	transplants, err := queryPopulate[Transplant](ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transplants {
+		if t.HospitalID == hospitalId {
+			feed.add("TRANSPLANT_COMPLETED", t.ID, t.CreatedAt)
+		}
+	}
+	dashboard.RecentActivity = feed.newest(defaultActivityLimit)
+	return dashboard, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import "github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+// requiredDeathAttestations is how many distinct physicians must attest a death
+// before the donor's organs may be allocated.
+const requiredDeathAttestations = 2
+
+// DeathAttestation is one physician's confirmation of a donor's death.
+type DeathAttestation struct {
+	PhysicianID  string `json:"physicianId"`
+	PhysicianMSP string `json:"physicianMsp"`
+	HospitalID   string `json:"hospitalId"`
+	AttestedAt   string `json:"attestedAt"`
+	TxID         string `json:"txId"`
+}
+
+// DeathDeclaration records the declaration of a deceased donor's death, keyed by
+// donor ID. It is PENDING until two different physicians have attested it.
+type DeathDeclaration struct {
+	DonorID       string              `json:"donorId"`
+	DeathType     string              `json:"deathType"`
+	TimeOfDeath   string              `json:"timeOfDeath"`
+	Attestations  []*DeathAttestation `json:"attestations"`
+	Status        string              `json:"status"`
+	ConfirmedAt   string              `json:"confirmedAt,omitempty" metadata:",optional"`
+	DocType       string              `json:"docType"`
+	SchemaVersion int                 `json:"schemaVersion"`
+	CreatedAt     string              `json:"createdAt"`
+}
+
+// timeOfDeath is the declared time of death recorded on a deceased donor.
+func timeOfDeath(d *Donor) string {
+	if d.DonorType == DonorDCD {
+		return d.CirculatoryDeathAt
+	}
+	return d.BrainDeathAt
+}
+
+// AttestDeath records the calling physician's attestation of a deceased donor's death
+// as recorded on the donor by ClassifyDonor or CreateDonor. The caller must hold the
+// physician role, and the same physician may not attest twice: the second attestation
+// has to come from a different identity. Once it does, the declaration is CONFIRMED
+// and the donor's organs become allocatable.
+func (s *SmartContract) AttestDeath(ctx contractapi.TransactionContextInterface, donorId string) (*DeathDeclaration, error) {
+	if err := s.requirePhysician(ctx); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot attest death")
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if d.DonorType != DonorDBD && d.DonorType != DonorDCD {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is not classified as a deceased donor", d.ID)
+	}
+	decl, err := findState[DeathDeclaration](ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if decl != nil && decl.Status == "CONFIRMED" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "death of donor %s is already confirmed", d.ID)
+	}
+	physician, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	physicianID, mspID := physician.ID, physician.MSPID
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if decl == nil {
+		decl = &DeathDeclaration{
+			DonorID: d.ID, DeathType: d.DonorType, TimeOfDeath: timeOfDeath(d),
+			Attestations: []*DeathAttestation{}, Status: "PENDING", DocType: docTypeDeath, CreatedAt: ts,
+		}
+	}
+	for _, a := range decl.Attestations {
+		if a.PhysicianID == physicianID {
+			return nil, codedError(CodeForbidden, docTypeDonor, "", "this physician has already attested the death of donor %s; a second physician must confirm it", d.ID)
+		}
+	}
+
+	decl.Attestations = append(decl.Attestations, &DeathAttestation{
+		PhysicianID: physicianID, PhysicianMSP: mspID, HospitalID: hospitalId, AttestedAt: ts, TxID: ctx.GetStub().GetTxID(),
+	})
+	if len(decl.Attestations) >= requiredDeathAttestations {
+		decl.Status = "CONFIRMED"
+		decl.ConfirmedAt = ts
+		d.DeathConfirmed = true
+		if err := putState(ctx, d.ID, d); err != nil {
+			return nil, err
+		}
+	}
+	if err := putState(ctx, donorId, decl); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventDeathAttested, map[string]interface{}{
+		"donorId": d.ID, "hospitalId": hospitalId, "attestations": len(decl.Attestations), "status": decl.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
+
+func (s *SmartContract) GetDeathDeclaration(ctx contractapi.TransactionContextInterface, donorId string) (*DeathDeclaration, error) {
+	return getState[DeathDeclaration](ctx, donorId)
+}
+
+// seedDeathDeclaration is the confirmed declaration InitLedger gives each sample donor.
+func seedDeathDeclaration(d *Donor, ts string) *DeathDeclaration {
+	decl := &DeathDeclaration{
+		DonorID: d.ID, DeathType: d.DonorType, TimeOfDeath: timeOfDeath(d), Attestations: []*DeathAttestation{},
+		Status: "CONFIRMED", ConfirmedAt: ts, DocType: docTypeDeath, CreatedAt: ts,
+	}
+	for _, physician := range []string{"SEED-PHYSICIAN-1", "SEED-PHYSICIAN-2"} {
+		decl.Attestations = append(decl.Attestations, &DeathAttestation{PhysicianID: physician, HospitalID: adminHospitalID, AttestedAt: ts})
+	}
+	return decl
+}
@@ -0,0 +1,96 @@
+package main
+
+import "github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+// directedElsewhere reports whether a living donor has been directed to a patient
+// other than patientId. Directed organs skip general allocation and may only be
+// matched to their intended recipient, or swapped through paired exchange.
+func directedElsewhere(d *Donor, patientId string) bool {
+	return d.IntendedRecipientID != "" && d.IntendedRecipientID != patientId
+}
+
+// linkRecipient validates a living donor's intended recipient and stamps who linked
+// them and when. An empty recipient clears the link.
+func (s *SmartContract) linkRecipient(ctx contractapi.TransactionContextInterface, d *Donor, patientId string) error {
+	if patientId != "" {
+		if d.DonorType != DonorLiving {
+			return codedError(CodeInvalidArgument, docTypeDonor, "donorId", "only living donors can be directed to a recipient")
+		}
+		p, err := getState[Patient](ctx, patientId)
+		if err != nil {
+			return wrapError(err, "intended recipient")
+		}
+		if p.Status == "TRANSPLANTED" {
+			return codedError(CodeInvalidTransition, docTypePatient, "", "intended recipient %s has already been transplanted", p.ID)
+		}
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	d.IntendedRecipientID = patientId
+	d.DirectedByMSP, d.DirectedAt = mspID, ts
+	return nil
+}
+
+// DirectDonorToRecipient links a living donor to the patient they are giving to, or
+// unlinks them when patientId is empty. The donor's organs then go only to that
+// patient. The link cannot change while a live match holds one of the donor's organs.
+func (s *SmartContract) DirectDonorToRecipient(ctx contractapi.TransactionContextInterface, donorId, patientId string) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot direct donor")
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if d.DonorType != DonorLiving {
+		return nil, codedError(CodeInvalidArgument, docTypeDonor, "donorId", "only living donors can be directed to a recipient")
+	}
+	blocking, err := s.blockingMatch(ctx, func(m *Match) bool { return m.DonorID == donorId })
+	if err != nil {
+		return nil, err
+	}
+	if blocking != "" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is referenced by match %s", donorId, blocking)
+	}
+	previous := d.IntendedRecipientID
+	if err := s.linkRecipient(ctx, d, patientId); err != nil {
+		return nil, err
+	}
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventDonorUpdated, map[string]string{
+		"donorId": d.ID, "intendedRecipientId": patientId, "previousRecipientId": previous, "hospitalId": hospitalId,
+	})
+}
+
+// GetDirectedDonors lists the living donors directed to a patient.
+func (s *SmartContract) GetDirectedDonors(ctx contractapi.TransactionContextInterface, patientId string) ([]*Donor, error) {
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	directed := []*Donor{}
+	for _, d := range donors {
+		if d.IntendedRecipientID == patientId {
+			directed = append(directed, d)
+		}
+	}
+	return directed, nil
+}
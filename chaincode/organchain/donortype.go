@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Donor types. Living donors give a kidney or part of a liver to a named recipient or
+// through paired exchange. Deceased donors are declared dead either by brain death
+// (DBD) or circulatory death (DCD); DCD organs suffer warm ischemia before recovery.
+const (
+	DonorLiving = "LIVING"
+	DonorDBD    = "DBD"
+	DonorDCD    = "DCD"
+)
+
+// DonorTypes lists the accepted donor types.
+var DonorTypes = []string{DonorLiving, DonorDBD, DonorDCD}
+
+// livingDonorOrgans are the organs a living donor can give.
+var livingDonorOrgans = []string{"Kidney", "Liver"}
+
+// donorDetails carries the type-specific fields CreateDonor accepts as JSON.
+type donorDetails struct {
+	Relationship        string `json:"relationship"`
+	IntendedRecipientID string `json:"intendedRecipientId"`
+	BrainDeathAt        string `json:"brainDeathAt"`
+	CirculatoryDeathAt  string `json:"circulatoryDeathAt"`
+	WarmIschemiaMinutes *int   `json:"warmIschemiaMinutes"`
+}
+
+// applyDonorType validates a donor type, its details and the donor's organs, and
+// copies the details onto the donor:
+//   - LIVING requires the donor's relationship to the recipient and only kidneys or livers;
+//   - DBD requires the time brain death was declared;
+//   - DCD requires the time of circulatory death and the warm ischemia time.
+func applyDonorType(d *Donor, donorType, detailsJSON string, now time.Time) error {
+	donorType = strings.ToUpper(donorType)
+	if !containsString(DonorTypes, donorType) {
+		return codedError(CodeInvalidArgument, "", "donorType", "invalid donor type %q: must be one of %s", donorType, strings.Join(DonorTypes, ", "))
+	}
+	var details donorDetails
+	if strings.TrimSpace(detailsJSON) != "" {
+		if err := json.Unmarshal([]byte(detailsJSON), &details); err != nil {
+			return codedError(CodeInvalidArgument, "", "details", "donor details must be a JSON object: %v", err)
+		}
+	}
+	declaredAt := func(field, ts string) (string, error) {
+		if ts == "" {
+			return "", codedError(CodeInvalidArgument, "", "details", "%s donors require %s", donorType, field)
+		}
+		t, err := parseTimestamp(ts)
+		if err != nil {
+			return "", err
+		}
+		if t.After(now) {
+			return "", codedError(CodeInvalidArgument, "", "details", "%s %s is in the future", field, ts)
+		}
+		return t.Format(time.RFC3339), nil
+	}
+
+	d.BrainDeathAt, d.CirculatoryDeathAt, d.WarmIschemiaMinutes = "", "", 0
+	var err error
+	switch donorType {
+	case DonorLiving:
+		if strings.TrimSpace(details.Relationship) == "" {
+			return codedError(CodeInvalidArgument, "", "details", "living donors require a relationship to the recipient")
+		}
+		if details.BrainDeathAt != "" || details.CirculatoryDeathAt != "" || details.WarmIschemiaMinutes != nil {
+			return codedError(CodeInvalidArgument, "", "details", "death and warm ischemia details do not apply to living donors")
+		}
+	case DonorDBD:
+		if d.BrainDeathAt, err = declaredAt("brainDeathAt", details.BrainDeathAt); err != nil {
+			return err
+		}
+		if details.CirculatoryDeathAt != "" || details.WarmIschemiaMinutes != nil {
+			return codedError(CodeInvalidArgument, "", "details", "circulatory death details do not apply to DBD donors")
+		}
+	case DonorDCD:
+		if d.CirculatoryDeathAt, err = declaredAt("circulatoryDeathAt", details.CirculatoryDeathAt); err != nil {
+			return err
+		}
+		if details.WarmIschemiaMinutes == nil || *details.WarmIschemiaMinutes < 0 {
+			return codedError(CodeInvalidArgument, "", "details", "DCD donors require a non-negative warmIschemiaMinutes")
+		}
+		if details.BrainDeathAt != "" {
+			return codedError(CodeInvalidArgument, "", "details", "brain death details do not apply to DCD donors")
+		}
+		d.WarmIschemiaMinutes = *details.WarmIschemiaMinutes
+	}
+	if donorType != DonorLiving && (details.Relationship != "" || details.IntendedRecipientID != "") {
+		return codedError(CodeInvalidArgument, "", "details", "recipient details apply only to living donors")
+	}
+	d.DonorType = donorType
+	d.Relationship = details.Relationship
+	d.IntendedRecipientID = details.IntendedRecipientID
+	return validateDonorOrgans(d.DonorType, d.OrgansAvailable)
+}
+
+// ClassifyDonor sets or corrects a donor's type, e.g. when a registered pledge becomes
+// a deceased donor. Donors cannot be matched until they are classified, and cannot
+// be reclassified while a live match holds one of their organs. Reclassifying discards
+// any death declaration, since the physicians attested the previous details.
+func (s *SmartContract) ClassifyDonor(ctx contractapi.TransactionContextInterface, id, donorType, donorDetailsJSON string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := s.GetDonor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return wrapError(err, "cannot classify donor")
+	}
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if d.VerificationStatus == "WITHDRAWN" {
+		return codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", id)
+	}
+	blocking, err := s.blockingMatch(ctx, func(m *Match) bool { return m.DonorID == id })
+	if err != nil {
+		return err
+	}
+	if blocking != "" {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is referenced by match %s", id, blocking)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if err := applyDonorType(d, donorType, donorDetailsJSON, *now); err != nil {
+		return err
+	}
+	if d.IntendedRecipientID != "" {
+		if err := s.linkRecipient(ctx, d, d.IntendedRecipientID); err != nil {
+			return err
+		}
+	}
+	d.DeathConfirmed = false
+	if err := delState[DeathDeclaration](ctx, id); err != nil {
+		return err
+	}
+	if err := putState(ctx, id, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorUpdated, map[string]interface{}{
+		"donorId": id, "donorType": d.DonorType, "hospitalId": hospitalId,
+	})
+}
+
+// validateDonorOrgans checks that a donor of the given type can give every organ listed.
+// Donors recorded before donor types existed are not checked.
+func validateDonorOrgans(donorType string, organs []string) error {
+	if donorType != DonorLiving {
+		return nil
+	}
+	for _, o := range organs {
+		if !containsString(livingDonorOrgans, o) {
+			return codedError(CodeInvalidOrgan, "", "organs", "living donors can only give %s, not %s", strings.Join(livingDonorOrgans, " or "), o)
+		}
+	}
+	return nil
+}
+
+// viableDuration shortens an organ's viability window by the warm ischemia a DCD
+// donor's organs suffered before recovery.
+func viableDuration(d *Donor, hours int) time.Duration {
+	window := time.Duration(hours) * time.Hour
+	if d != nil && d.DonorType == DonorDCD {
+		window -= time.Duration(d.WarmIschemiaMinutes) * time.Minute
+	}
+	if window < 0 {
+		return 0
+	}
+	return window
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const epletTableKey = "EPLET-TABLE"
+
+// EpletTable lists the eplets, the small polymorphic surface patches antibodies bind
+// to, carried by each HLA allele. Alleles are keyed by name at whatever resolution
+// the table has, e.g. A*02:01 or A*02; a typing is looked up at its own resolution
+// first and then at antigen level. The table starts empty and is loaded by network
+// admins from a reference such as the HLA Eplet Registry.
+type EpletTable struct {
+	Alleles       map[string][]string `json:"alleles"`
+	DocType       string              `json:"docType"`
+	SchemaVersion int                 `json:"schemaVersion"`
+	UpdatedAt     string              `json:"updatedAt"`
+}
+
+// EpletMismatch is the eplet-level comparison of a donor with a patient. Load counts
+// the donor eplets the patient does not carry, which the patient may make antibodies
+// against. Alleles missing from the eplet table are listed, since their eplets are
+// not counted.
+type EpletMismatch struct {
+	Load               int      `json:"load"`
+	Eplets             []string `json:"eplets"`
+	UntabulatedAlleles []string `json:"untabulatedAlleles"`
+}
+
+func (s *SmartContract) GetEpletTable(ctx contractapi.TransactionContextInterface) (*EpletTable, error) {
+	table, err := findState[EpletTable](ctx, epletTableKey)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return &EpletTable{Alleles: map[string][]string{}, DocType: docTypeEplet}, nil
+	}
+	if table.Alleles == nil {
+		table.Alleles = map[string][]string{}
+	}
+	return table, nil
+}
+
+// SetEpletTable replaces the eplet table with tableJSON, an object mapping allele
+// names to their eplets, such as {"A*02:01":["62GE","142M"],"B*44":["41T"]}.
+func (s *SmartContract) SetEpletTable(ctx contractapi.TransactionContextInterface, tableJSON string) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	var raw map[string][]string
+	if err := json.Unmarshal([]byte(tableJSON), &raw); err != nil {
+		return codedError(CodeInvalidArgument, "", "table", "eplet table must be a JSON object of allele names to eplet lists: %v", err)
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := &EpletTable{Alleles: map[string][]string{}, DocType: docTypeEplet}
+	for _, name := range names {
+		locus, allele, err := parseHLAAllele(name)
+		if err != nil {
+			return codedError(CodeInvalidHLA, "", "table", "eplet table allele %q: %s", name, errorMessage(err))
+		}
+		key := locus + "*" + allele
+		if _, ok := table.Alleles[key]; ok {
+			return codedError(CodeInvalidArgument, "", "table", "allele %s is listed more than once", key)
+		}
+		eplets := []string{}
+		for _, e := range raw[name] {
+			if e = strings.TrimSpace(e); e == "" {
+				return codedError(CodeInvalidArgument, "", "table", "allele %s has an empty eplet name", key)
+			}
+			if !containsString(eplets, e) {
+				eplets = append(eplets, e)
+			}
+		}
+		sort.Strings(eplets)
+		table.Alleles[key] = eplets
+	}
+
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	table.UpdatedAt = ts
+	if err := putState(ctx, epletTableKey, table); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPolicyUpdated, map[string]interface{}{"epletTableAlleles": len(table.Alleles)})
+}
+
+// eplets returns the eplets of an allele, looked up at its own resolution and then at
+// antigen level.
+func (t *EpletTable) eplets(locus, allele string) ([]string, bool) {
+	if e, ok := t.Alleles[locus+"*"+allele]; ok {
+		return e, true
+	}
+	e, ok := t.Alleles[locus+"*"+hlaAntigen(allele)]
+	return e, ok
+}
+
+// mismatch compares the donor's eplets, over every typed locus, with the patient's.
+func (t *EpletTable) mismatch(patient, donor HLATyping) *EpletMismatch {
+	m := &EpletMismatch{Eplets: []string{}, UntabulatedAlleles: []string{}}
+	own := map[string]bool{}
+	for _, locus := range HLALoci {
+		for _, allele := range *patient.alleles(locus) {
+			eplets, ok := t.eplets(locus, allele)
+			if !ok {
+				m.UntabulatedAlleles = append(m.UntabulatedAlleles, locus+"*"+allele)
+			}
+			for _, e := range eplets {
+				own[e] = true
+			}
+		}
+	}
+	for _, locus := range HLALoci {
+		for _, allele := range *donor.alleles(locus) {
+			eplets, ok := t.eplets(locus, allele)
+			if !ok && !containsString(m.UntabulatedAlleles, locus+"*"+allele) {
+				m.UntabulatedAlleles = append(m.UntabulatedAlleles, locus+"*"+allele)
+			}
+			for _, e := range eplets {
+				if !own[e] && !containsString(m.Eplets, e) {
+					m.Eplets = append(m.Eplets, e)
+				}
+			}
+		}
+	}
+	sort.Strings(m.Eplets)
+	m.Load = len(m.Eplets)
+	return m
+}
+
+// epletMismatch loads the eplet table and compares a donor with a patient.
+func (s *SmartContract) epletMismatch(ctx contractapi.TransactionContextInterface, p *Patient, d *Donor) (*EpletMismatch, error) {
+	table, err := s.GetEpletTable(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eplet table: %v", err)
+	}
+	return table.mismatch(p.HLA, d.HLA), nil
+}
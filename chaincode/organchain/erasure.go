@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PIIErased marks a donor whose private data has been purged on request.
+const PIIErased = "ERASED"
+
+// PurgeDonorPII honours a donor's request for erasure. Their name, email and phone are
+// purged from the donorPII collection, including its history on every peer. Nothing
+// derived from them is put on the public record, which keeps only PIIHash and
+// ConsentHash, so matches, transplants and audit trails that reference the donor stay
+// intact.
+func (s *SmartContract) PurgeDonorPII(ctx contractapi.TransactionContextInterface, donorId string) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	if d.PIIStatus == PIIErased {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "PII of donor %s was already erased at %s", d.ID, d.PIIErasedAt)
+	}
+	if err := requireCallerOrgMatchesPeer(ctx); err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PurgePrivateData(donorPIICollection, d.ID); err != nil {
+		return nil, fmt.Errorf("failed to purge donor PII: %v", err)
+	}
+
+	caller, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.PIIErasedAt, err = s.getTimestamp(ctx); err != nil {
+		return nil, err
+	}
+	d.PIIStatus, d.PIIErasedBy = PIIErased, caller
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventDonorPIIErased, map[string]string{
+		"donorId": d.ID, "erasedBy": caller, "piiHash": d.PIIHash,
+	})
+}
+
+// requireDonorPIIPresent rejects writes of PII for a donor whose PII was erased.
+func requireDonorPIIPresent(d *Donor) error {
+	if d.PIIStatus == PIIErased {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "PII of donor %s was erased at %s and cannot be restored", d.ID, d.PIIErasedAt)
+	}
+	return nil
+}
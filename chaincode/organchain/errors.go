@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Error codes carried in the error envelope. Clients map them to their own messages,
+// so they must not change. Lookups of a missing record use <DOCTYPE>_NOT_FOUND, e.g.
+// DONOR_NOT_FOUND; see notFound.
+const (
+	CodeUnauthenticated   = "UNAUTHENTICATED"
+	CodeForbidden         = "FORBIDDEN"
+	CodeInvalidArgument   = "INVALID_ARGUMENT"
+	CodeValidationFailed  = "VALIDATION_FAILED"
+	CodeInvalidID         = "INVALID_ID"
+	CodeInvalidEmail      = "INVALID_EMAIL"
+	CodeInvalidPhone      = "INVALID_PHONE"
+	CodeInvalidHLA        = "INVALID_HLA"
+	CodeInvalidBloodType  = "INVALID_BLOOD_TYPE"
+	CodeInvalidOrgan      = "INVALID_ORGAN"
+	CodeInvalidUrgency    = "INVALID_URGENCY"
+	CodeInvalidReasonCode = "INVALID_REASON_CODE"
+	CodeAlreadyExists     = "ALREADY_EXISTS"
+	CodeVersionConflict   = "VERSION_CONFLICT"
+	CodeInvalidTransition = "INVALID_STATE_TRANSITION"
+	CodeRecordArchived    = "RECORD_ARCHIVED"
+	CodeConsentWithdrawn  = "CONSENT_WITHDRAWN"
+	CodeHospitalInactive  = "HOSPITAL_INACTIVE"
+)
+
+// ChaincodeError is the envelope failures are returned in. Its Error method yields the
+// JSON form, which Fabric hands back to the client as the response message. Entity
+// names the record type involved and Field the offending argument, where they apply.
+// Errors lists each failed field of a VALIDATION_FAILED error; see validateFields.
+type ChaincodeError struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Entity  string        `json:"entity,omitempty"`
+	Field   string        `json:"field,omitempty"`
+	Errors  []*FieldError `json:"errors,omitempty"`
+}
+
+func (e *ChaincodeError) Error() string {
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(bytes)
+}
+
+// codedError builds an envelope with a formatted message.
+func codedError(code, entity, field, format string, args ...interface{}) error {
+	return &ChaincodeError{Code: code, Message: fmt.Sprintf(format, args...), Entity: entity, Field: field}
+}
+
+// notFound reports a missing record of the given docType.
+func notFound(docType, id string) error {
+	return codedError(errorCodeName(docType)+"_NOT_FOUND", docType, "", "%s %s does not exist", docType, id)
+}
+
+// errorCodeName turns a docType such as deathDeclaration into DEATH_DECLARATION.
+func errorCodeName(docType string) string {
+	var b strings.Builder
+	for i, r := range docType {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// wrapError prefixes err with what the caller was trying to do, keeping the code of
+// an enveloped error so the context does not hide it from clients.
+func wrapError(err error, action string) error {
+	var ce *ChaincodeError
+	if errors.As(err, &ce) {
+		wrapped := *ce
+		wrapped.Message = action + ": " + ce.Message
+		return &wrapped
+	}
+	return fmt.Errorf("%s: %v", action, err)
+}
+
+// errorMessage returns the human-readable part of err, for lists of reasons that are
+// returned as data rather than as a failure.
+func errorMessage(err error) string {
+	var ce *ChaincodeError
+	if errors.As(err, &ce) {
+		return ce.Message
+	}
+	return err.Error()
+}
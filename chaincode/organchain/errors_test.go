@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Failures a caller can cause must carry a code, or the backend reports them as
+// server errors.
+func TestUserErrorsAreCoded(t *testing.T) {
+	l := newSeededLedger(t)
+	l.mustInvoke("RegisterHospital", "HOSP-002", "Second Hospital", "hash", "Elsewhere")
+	version := fmt.Sprint(l.patient("PAT-001").Version)
+
+	tests := []struct {
+		name     string
+		hospital string
+		fn       string
+		args     []string
+		code     string
+		field    string
+	}{
+		{"another hospital's patient", "HOSP-002", "SetPatientUrgency", []string{"PAT-001", "STATUS_1A", "ICU", version}, CodeForbidden, ""},
+		{"missing urgency reason", "HOSP-001", "SetPatientUrgency", []string{"PAT-001", "STATUS_1A", "", version}, CodeInvalidArgument, "reason"},
+		{"wrong password", "HOSP-001", "AuthenticateHospital", []string{"HOSP-001", "wrong"}, CodeUnauthenticated, ""},
+		{"offer expiry out of range", "HOSP-001", "OfferOrgan", []string{"DON-101", "Kidney", "0"}, CodeInvalidArgument, "expiryMinutes"},
+		{"organ status outside the allowed set", "HOSP-001", "UpdateOrganStatus", []string{organID("DON-101", "Kidney"), "AVAILABLE"}, CodeInvalidArgument, "status"},
+		{"unknown match", "HOSP-001", "ApproveMatch", []string{"MATCH-404", "1"}, "MATCH_NOT_FOUND", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l.asHospital(tc.hospital)
+			err := l.mustFail(tc.fn, tc.args...)
+			if err.Code != tc.code || err.Field != tc.field {
+				t.Errorf("%s failed with %q on %q (%s), want %s on %q", tc.fn, err.Code, err.Field, err.Message, tc.code, tc.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// escalationPriority marks events that allocation teams must act on at once.
+const escalationPriority = "HIGH"
+
+// PatientEscalation is one emergency escalation of a patient's urgency.
+// JustificationHash references the clinical document that supports it.
+type PatientEscalation struct {
+	FromUrgency       string `json:"fromUrgency"`
+	ToUrgency         string `json:"toUrgency"`
+	JustificationHash string `json:"justificationHash"`
+	HospitalID        string `json:"hospitalId"`
+	EscalatedBy       string `json:"escalatedBy"`
+	EscalatedAt       string `json:"escalatedAt"`
+}
+
+// EscalatePatient raises a waiting patient to a more urgent tier in an emergency, which
+// moves them up the waitlist and allocation rankings at once. Unlike
+// SetPatientUrgency it can only raise urgency, only the hospital that listed the
+// patient may call it, and it must reference a clinical justification document,
+// clinicalJustificationHash. It emits a high-priority PatientEscalated event.
+func (s *SmartContract) EscalatePatient(ctx contractapi.TransactionContextInterface, patientId, newUrgency, clinicalJustificationHash string) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	urgency, err := normalizeUrgency(newUrgency)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(clinicalJustificationHash) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "clinicalJustificationHash", "a clinical justification document is required to escalate a patient")
+	}
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, p.OwnerMSP); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot escalate patient")
+	}
+	if hospitalId != p.HospitalID {
+		return nil, codedError(CodeForbidden, docTypePatient, "", "only hospital %s, which listed patient %s, may escalate them", p.HospitalID, p.ID)
+	}
+	if p.Status != "WAITING" {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "only waiting patients can be escalated; %s is %s", p.ID, p.Status)
+	}
+	previous := p.Urgency
+	if urgencyTier(urgency) >= urgencyTier(previous) {
+		return nil, codedError(CodeInvalidArgument, "", "newUrgency", "%s is not more urgent than patient %s's current %s", urgency, p.ID, previous)
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts := now.Format(time.RFC3339)
+	p.Escalations = append(p.Escalations, &PatientEscalation{
+		FromUrgency: previous, ToUrgency: urgency, JustificationHash: clinicalJustificationHash,
+		HospitalID: hospitalId, EscalatedBy: actor.ID, EscalatedAt: ts,
+	})
+	p.Urgency = urgency
+	p.UrgencyReason = "emergency escalation: " + clinicalJustificationHash
+	p.UrgencyChangedBy = hospitalId
+	p.UrgencyChangedAt = ts
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientEscalated, map[string]string{
+		"patientId": p.ID, "organNeeded": p.OrganNeeded, "urgency": urgency, "previousUrgency": previous,
+		"hospitalId": hospitalId, "justificationHash": clinicalJustificationHash, "priority": escalationPriority,
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Chaincode event names. Clients subscribe to these, so they must not change.
+const (
+	EventPatientCreated           = "PatientCreated"
+	EventPatientUpdated           = "PatientUpdated"
+	EventPatientDeleted           = "PatientDeleted"
+	EventPatientRemoved           = "PatientRemoved"
+	EventPatientEscalated         = "PatientEscalated"
+	EventPatientsBatchCreated     = "PatientsBatchCreated"
+	EventPatientTransferInitiated = "PatientTransferInitiated"
+	EventPatientTransferred       = "PatientTransferred"
+	EventPatientTransferCancelled = "PatientTransferCancelled"
+	EventDonorCreated             = "DonorCreated"
+	EventDonorsBatchCreated       = "DonorsBatchCreated"
+	EventDonorUpdated             = "DonorUpdated"
+	EventDonorVerified            = "DonorVerified"
+	EventDonorWithdrawn           = "DonorWithdrawn"
+	EventDonorDeleted             = "DonorDeleted"
+	EventDonorPIIErased           = "DonorPIIErased"
+	EventRecordArchived           = "RecordArchived"
+	EventRecordsImported          = "RecordsImported"
+	EventConsentWithdrawn         = "ConsentWithdrawn"
+	EventConsentRecorded          = "ConsentRecorded"
+	EventConsentVerified          = "ConsentVerified"
+	EventMatchCreated             = "MatchCreated"
+	EventMatchApproved            = "MatchApproved"
+	EventMatchRejected            = "MatchRejected"
+	EventMatchCancelled           = "MatchCancelled"
+	EventHospitalRegistered       = "HospitalRegistered"
+	EventHospitalStatusChanged    = "HospitalStatusChanged"
+	EventTransplantCompleted      = "TransplantCompleted"
+	EventOrganStatusChanged       = "OrganStatusChanged"
+	EventCustodyRecorded          = "CustodyRecorded"
+	EventCrossmatchRecorded       = "CrossmatchRecorded"
+	EventScreeningRecorded        = "ScreeningRecorded"
+	EventDeathAttested            = "DeathAttested"
+	EventOfferCreated             = "OfferCreated"
+	EventOfferAccepted            = "OfferAccepted"
+	EventOfferDeclined            = "OfferDeclined"
+	EventOfferExpired             = "OfferExpired"
+	EventExchangeChainProposed    = "ExchangeChainProposed"
+	EventExchangeChainApproved    = "ExchangeChainApproved"
+	EventExchangeChainExecuted    = "ExchangeChainExecuted"
+	EventExchangeChainRejected    = "ExchangeChainRejected"
+	EventPolicyUpdated            = "PolicyUpdated"
+	EventRegistrySubmitted        = "RegistrySubmitted"
+	EventLedgerMigrated           = "LedgerMigrated"
+)
+
+// emitEvent attaches a JSON payload to the transaction. Fabric keeps only one event
+// per transaction, so each function emits at most one, after its writes succeed.
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, bytes)
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+// expectEvent checks the name of the last invocation's event and the given fields of
+// its payload.
+func expectEvent(t *testing.T, l *testLedger, name string, fields map[string]string) map[string]interface{} {
+	t.Helper()
+	got, payload := l.lastEvent()
+	if got != name {
+		t.Fatalf("event = %s, want %s", got, name)
+	}
+	for k, want := range fields {
+		if payload[k] != want {
+			t.Errorf("%s %s = %v, want %s", name, k, payload[k], want)
+		}
+	}
+	return payload
+}
+
+func TestDonorAndMatchLifecycleEvents(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+
+	l.Transient = map[string][]byte{donorPIITransientKey: []byte(`{"name":"Donor"}`)}
+	l.mustInvoke("CreateDonor", "DON-100", "O-", "A2, B8, DR15", `["Kidney"]`, "", "consent", "", "", "")
+	l.mustInvoke("VerifyDonor", "DON-100", "VERIFIED")
+	expectEvent(t, l, EventDonorVerified, map[string]string{
+		"donorId": "DON-100", "status": "VERIFIED", "hospitalId": "HOSP-001",
+	})
+
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	expectEvent(t, l, EventMatchCreated, map[string]string{
+		"matchId": "MATCH-1", "patientId": "PAT-001", "donorId": "DON-101", "organType": "Kidney",
+	})
+
+	l.mustInvoke("ApproveMatch", "MATCH-1", "1")
+	approved := expectEvent(t, l, EventMatchApproved, map[string]string{
+		"matchId": "MATCH-1", "patientId": "PAT-001", "donorId": "DON-101", "hospitalId": "HOSP-001",
+	})
+	if approved["hl7"] == "" {
+		t.Error("MatchApproved carries no HL7 message")
+	}
+
+	l.mustInvoke("CreateMatch", "MATCH-2", "PAT-002", "DON-101", "Liver")
+	l.mustInvoke("RejectMatch", "MATCH-2", ReasonOrganQuality, "biopsy findings", "1")
+	expectEvent(t, l, EventMatchRejected, map[string]string{
+		"matchId": "MATCH-2", "patientId": "PAT-002", "donorId": "DON-101", "hospitalId": "HOSP-001",
+		"reasonCode": ReasonOrganQuality, "reason": "biopsy findings",
+	})
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// exchangeOrgan is the organ swapped in paired exchanges: living donors give a kidney.
+const exchangeOrgan = "Kidney"
+
+// ExchangePair is a living donor who is willing to give but incompatible with their
+// own intended recipient. The pair joins the exchange pool to swap kidneys with
+// other pairs.
+type ExchangePair struct {
+	ID            string `json:"id"`
+	PatientID     string `json:"patientId"`
+	DonorID       string `json:"donorId"`
+	HospitalID    string `json:"hospitalId"`
+	Status        string `json:"status"`
+	ChainID       string `json:"chainId,omitempty" metadata:",optional"`
+	OwnerMSP      string `json:"ownerMsp"`
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+// ExchangeChain is a proposed swap in which each pair's donor gives to the next pair's
+// patient and the last donor gives to the first patient. It executes only once every
+// pair's hospital has approved it.
+type ExchangeChain struct {
+	ID            string            `json:"id"`
+	PairIDs       []string          `json:"pairIds"`
+	Approvals     map[string]string `json:"approvals"`
+	Status        string            `json:"status"`
+	MatchIDs      []string          `json:"matchIds"`
+	ProposedBy    string            `json:"proposedBy"`
+	Reason        string            `json:"reason,omitempty" metadata:",optional"`
+	DocType       string            `json:"docType"`
+	SchemaVersion int               `json:"schemaVersion"`
+	CreatedAt     string            `json:"createdAt"`
+	UpdatedAt     string            `json:"updatedAt"`
+}
+
+// ExchangeCycle is a feasible 2- or 3-way swap among the active pairs.
+type ExchangeCycle struct {
+	PairIDs       []string `json:"pairIds"`
+	HLAScores     []int    `json:"hlaScores"`
+	TotalHLAScore int      `json:"totalHlaScore"`
+}
+
+// RegisterExchangePair adds an incompatible donor/recipient pair to the exchange pool.
+// Pairs that are directly compatible should be matched with CreateMatch instead.
+func (s *SmartContract) RegisterExchangePair(ctx contractapi.TransactionContextInterface, id, patientId, donorId string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	if err := validateID("pairId", pairIDPrefix, id); err != nil {
+		return err
+	}
+	if exists, _ := s.RecordExists(ctx, id); exists {
+		return codedError(CodeAlreadyExists, docTypePair, "", "exchange pair %s already exists", id)
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return wrapError(err, "cannot register exchange pair")
+	}
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return err
+	}
+	if p.Status != "WAITING" || p.OrganNeeded != exchangeOrgan {
+		return codedError(CodeInvalidTransition, docTypePatient, "", "patient %s must be waiting for a %s", p.ID, exchangeOrgan)
+	}
+	if p.HospitalID != hospitalId {
+		return codedError(CodeForbidden, docTypePatient, "", "patient %s is registered at hospital %s", p.ID, p.HospitalID)
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return err
+	}
+	if !containsString(d.OrgansAvailable, exchangeOrgan) {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has no %s available", d.ID, exchangeOrgan)
+	}
+	if d.DonorType != DonorLiving {
+		return codedError(CodeInvalidArgument, docTypeDonor, "donorId", "donor %s is not a living donor", d.ID)
+	}
+	if directedElsewhere(d, p.ID) {
+		return codedError(CodeIncompatible, docTypeDonor, "", "donor %s is a directed donor for patient %s", d.ID, d.IntendedRecipientID)
+	}
+	if !d.ScreeningCleared {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has not cleared infectious disease screening", d.ID)
+	}
+	pairs, err := queryPopulate[ExchangePair](ctx)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if pair.Status != "WITHDRAWN" && (pair.PatientID == patientId || pair.DonorID == donorId) {
+			return codedError(CodeAlreadyExists, docTypePair, "", "patient or donor is already in exchange pair %s", pair.ID)
+		}
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if s.evaluateCompatibility(cfg, p, d, exchangeOrgan, *now).Compatible {
+		return codedError(CodeInvalidArgument, docTypePair, "", "donor %s is compatible with patient %s; create a match instead", d.ID, p.ID)
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	return putState(ctx, id, &ExchangePair{
+		ID: id, PatientID: patientId, DonorID: donorId, HospitalID: hospitalId, Status: "ACTIVE",
+		OwnerMSP: owner, DocType: docTypePair, CreatedAt: ts,
+	})
+}
+
+// WithdrawExchangePair takes a pair out of the pool. Pairs in a proposed chain must
+// wait for the chain to be rejected first.
+func (s *SmartContract) WithdrawExchangePair(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	pair, err := getState[ExchangePair](ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, pair.OwnerMSP); err != nil {
+		return err
+	}
+	if pair.Status != "ACTIVE" {
+		return codedError(CodeInvalidTransition, docTypePair, "", "exchange pair %s cannot be withdrawn from status %s", id, pair.Status)
+	}
+	pair.Status = "WITHDRAWN"
+	return putState(ctx, id, pair)
+}
+
+func (s *SmartContract) GetExchangePair(ctx contractapi.TransactionContextInterface, id string) (*ExchangePair, error) {
+	return getState[ExchangePair](ctx, id)
+}
+
+func (s *SmartContract) GetExchangeChain(ctx contractapi.TransactionContextInterface, id string) (*ExchangeChain, error) {
+	return getState[ExchangeChain](ctx, id)
+}
+
+// exchangeGraph scores every donor-to-patient edge between active pairs. An edge
+// from pair a to pair b means a's donor can give to b's patient.
+type exchangeGraph struct {
+	pairs  []*ExchangePair
+	scores map[string]map[string]int
+}
+
+func (g *exchangeGraph) edge(from, to string) (int, bool) {
+	score, ok := g.scores[from][to]
+	return score, ok
+}
+
+func (s *SmartContract) buildExchangeGraph(ctx contractapi.TransactionContextInterface, pairs []*ExchangePair) (*exchangeGraph, error) {
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g := &exchangeGraph{pairs: pairs, scores: map[string]map[string]int{}}
+	patients := map[string]*Patient{}
+	donors := map[string]*Donor{}
+	for _, pair := range pairs {
+		if patients[pair.ID], err = findState[Patient](ctx, pair.PatientID); err != nil {
+			return nil, err
+		}
+		if donors[pair.ID], err = findState[Donor](ctx, pair.DonorID); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range pairs {
+		g.scores[a.ID] = map[string]int{}
+		d := donors[a.ID]
+		if d == nil || d.VerificationStatus != "VERIFIED" {
+			continue
+		}
+		for _, b := range pairs {
+			p := patients[b.ID]
+			if a.ID == b.ID || p == nil || p.Status != "WAITING" {
+				continue
+			}
+			if compat := s.evaluateCompatibility(cfg, p, d, exchangeOrgan, *now); compat.Compatible {
+				g.scores[a.ID][b.ID] = compat.HLAScore
+			}
+		}
+	}
+	return g, nil
+}
+
+// FindExchangeCycles lists the feasible 2-way and 3-way swaps among active pairs,
+// 3-way swaps first since they transplant more patients, then by total HLA score.
+// Each cycle is listed once, starting from its lowest pair ID.
+func (s *SmartContract) FindExchangeCycles(ctx contractapi.TransactionContextInterface) ([]*ExchangeCycle, error) {
+	all, err := queryPopulate[ExchangePair](ctx)
+	if err != nil {
+		return nil, err
+	}
+	pairs := []*ExchangePair{}
+	for _, pair := range all {
+		if pair.Status == "ACTIVE" {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].ID < pairs[j].ID })
+	g, err := s.buildExchangeGraph(ctx, pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	cycles := []*ExchangeCycle{}
+	add := func(ids ...string) {
+		c := &ExchangeCycle{PairIDs: ids, HLAScores: []int{}}
+		for i, from := range ids {
+			score, _ := g.edge(from, ids[(i+1)%len(ids)])
+			c.HLAScores = append(c.HLAScores, score)
+			c.TotalHLAScore += score
+		}
+		cycles = append(cycles, c)
+	}
+	for i, a := range pairs {
+		for j := i + 1; j < len(pairs); j++ {
+			b := pairs[j]
+			_, ab := g.edge(a.ID, b.ID)
+			_, ba := g.edge(b.ID, a.ID)
+			if ab && ba {
+				add(a.ID, b.ID)
+			}
+			for k := i + 1; k < len(pairs); k++ {
+				c := pairs[k]
+				if k == j {
+					continue
+				}
+				_, bc := g.edge(b.ID, c.ID)
+				_, ca := g.edge(c.ID, a.ID)
+				if ab && bc && ca {
+					add(a.ID, b.ID, c.ID)
+				}
+			}
+		}
+	}
+	sort.SliceStable(cycles, func(i, j int) bool {
+		if len(cycles[i].PairIDs) != len(cycles[j].PairIDs) {
+			return len(cycles[i].PairIDs) > len(cycles[j].PairIDs)
+		}
+		return cycles[i].TotalHLAScore > cycles[j].TotalHLAScore
+	})
+	return cycles, nil
+}
+
+// ProposeExchangeChain records a 2- or 3-way swap for approval. pairIdsJSON lists the
+// pairs in giving order and must form a feasible cycle.
+func (s *SmartContract) ProposeExchangeChain(ctx contractapi.TransactionContextInterface, id, pairIdsJSON string) (*ExchangeChain, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if err := validateID("chainId", chainIDPrefix, id); err != nil {
+		return nil, err
+	}
+	if exists, _ := s.RecordExists(ctx, id); exists {
+		return nil, codedError(CodeAlreadyExists, docTypeChain, "", "exchange chain %s already exists", id)
+	}
+	proposedBy, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot propose exchange")
+	}
+	var pairIds []string
+	if err := json.Unmarshal([]byte(pairIdsJSON), &pairIds); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "pairIds", "pair IDs must be a JSON array: %v", err)
+	}
+	if len(pairIds) < 2 || len(pairIds) > 3 {
+		return nil, codedError(CodeInvalidArgument, "", "pairIds", "an exchange must have 2 or 3 pairs")
+	}
+	pairs := []*ExchangePair{}
+	for _, pairId := range pairIds {
+		pair, err := getState[ExchangePair](ctx, pairId)
+		if err != nil {
+			return nil, err
+		}
+		if pair.Status != "ACTIVE" {
+			return nil, codedError(CodeInvalidTransition, docTypePair, "", "exchange pair %s is %s", pairId, pair.Status)
+		}
+		for _, seen := range pairs {
+			if seen.ID == pairId {
+				return nil, codedError(CodeInvalidArgument, "", "pairIds", "exchange pair %s is listed twice", pairId)
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+	g, err := s.buildExchangeGraph(ctx, pairs)
+	if err != nil {
+		return nil, err
+	}
+	for i, pair := range pairs {
+		next := pairs[(i+1)%len(pairs)]
+		if _, ok := g.edge(pair.ID, next.ID); !ok {
+			return nil, codedError(CodeIncompatible, docTypeChain, "", "donor of %s cannot give to the patient of %s", pair.ID, next.ID)
+		}
+	}
+
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chain := &ExchangeChain{
+		ID: id, PairIDs: pairIds, Approvals: map[string]string{}, Status: "PROPOSED", MatchIDs: []string{},
+		ProposedBy: proposedBy, DocType: docTypeChain, CreatedAt: ts, UpdatedAt: ts,
+	}
+	if err := putState(ctx, id, chain); err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		pair.Status, pair.ChainID = "IN_CHAIN", id
+		if err := putState(ctx, pair.ID, pair); err != nil {
+			return nil, err
+		}
+	}
+	if err := emitEvent(ctx, EventExchangeChainProposed, map[string]interface{}{"chainId": id, "pairIds": pairIds}); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// proposedChainPair loads a proposed chain and one of its pairs, checking that the
+// hospital acts for that pair.
+func proposedChainPair(ctx contractapi.TransactionContextInterface, chainId, pairId, hospitalId string) (*ExchangeChain, *ExchangePair, error) {
+	chain, err := getState[ExchangeChain](ctx, chainId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chain.Status != "PROPOSED" {
+		return nil, nil, codedError(CodeInvalidTransition, docTypeChain, "", "exchange chain %s is already %s", chainId, chain.Status)
+	}
+	if !containsString(chain.PairIDs, pairId) {
+		return nil, nil, codedError(CodeInvalidArgument, docTypeChain, "pairId", "exchange pair %s is not part of chain %s", pairId, chainId)
+	}
+	pair, err := getState[ExchangePair](ctx, pairId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pair.HospitalID != hospitalId {
+		return nil, nil, codedError(CodeForbidden, docTypePair, "", "exchange pair %s is managed by hospital %s", pairId, pair.HospitalID)
+	}
+	return chain, pair, nil
+}
+
+// ApproveExchangeChain records one pair's approval. The approval that completes the
+// chain also executes it: every transplant in the swap is matched in the same
+// transaction, or, if any pair can no longer take part, none are.
+func (s *SmartContract) ApproveExchangeChain(ctx contractapi.TransactionContextInterface, chainId, pairId string) (*ExchangeChain, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := proposedChainPair(ctx, chainId, pairId, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	if _, done := chain.Approvals[pairId]; done {
+		return nil, codedError(CodeInvalidTransition, docTypeChain, "", "exchange pair %s has already approved chain %s", pairId, chainId)
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chain.Approvals[pairId] = hospitalId
+	chain.UpdatedAt = ts
+
+	event := EventExchangeChainApproved
+	if len(chain.Approvals) == len(chain.PairIDs) {
+		if err := s.executeExchangeChain(ctx, chain, ts); err != nil {
+			return nil, wrapError(err, "exchange chain "+chainId+" cannot execute")
+		}
+		event = EventExchangeChainExecuted
+	}
+	if err := putState(ctx, chain.ID, chain); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, event, map[string]interface{}{
+		"chainId": chain.ID, "pairId": pairId, "status": chain.Status, "matchIds": chain.MatchIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// executeExchangeChain records an approved match from each pair's donor to the next
+// pair's patient, reserving the kidneys as CreateMatch does.
+func (s *SmartContract) executeExchangeChain(ctx contractapi.TransactionContextInterface, chain *ExchangeChain, ts string) error {
+	pairs := []*ExchangePair{}
+	for _, pairId := range chain.PairIDs {
+		pair, err := getState[ExchangePair](ctx, pairId)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, pair)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, pair := range pairs {
+		next := pairs[(i+1)%len(pairs)]
+		d, err := s.GetDonor(ctx, pair.DonorID)
+		if err != nil {
+			return err
+		}
+		p, err := getState[Patient](ctx, next.PatientID)
+		if err != nil {
+			return err
+		}
+		if d.VerificationStatus != "VERIFIED" {
+			return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is not verified (status %s)", d.ID, d.VerificationStatus)
+		}
+		if p.Status != "WAITING" {
+			return codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is no longer waiting (status %s)", p.ID, p.Status)
+		}
+		compat := s.evaluateCompatibility(cfg, p, d, exchangeOrgan, *now)
+		if !compat.Compatible {
+			return codedError(CodeIncompatible, docTypeChain, "", "%s", strings.Join(compat.Reasons, "; "))
+		}
+		if err := s.requireViableOrgan(ctx, cfg, d.ID, exchangeOrgan); err != nil {
+			return err
+		}
+
+		matchId := "MATCH-" + chain.ID + "-" + strconv.Itoa(i+1)
+		err = putState(ctx, matchId, &Match{
+			ID: matchId, PatientID: p.ID, DonorID: d.ID, OrganType: exchangeOrgan,
+			HLAScore: strconv.Itoa(compat.HLAScore), Status: "APPROVED", DocType: docTypeMatch, CreatedAt: ts,
+			ApprovedBy: next.HospitalID, ApprovedAt: ts, OwnerMSP: owner, OrganID: organID(d.ID, exchangeOrgan),
+			StatusChangedBy: next.HospitalID, StatusChangedAt: ts,
+		})
+		if err != nil {
+			return err
+		}
+		removeOrgan(d, exchangeOrgan)
+		if err := putState(ctx, d.ID, d); err != nil {
+			return err
+		}
+		if err := s.setOrganStatus(ctx, d.ID, exchangeOrgan, OrganReserved, matchId, pair.HospitalID); err != nil {
+			return err
+		}
+		p.Status = "MATCHED"
+		if err := putState(ctx, p.ID, p); err != nil {
+			return err
+		}
+		pair.Status = "EXCHANGED"
+		if err := putState(ctx, pair.ID, pair); err != nil {
+			return err
+		}
+		chain.MatchIDs = append(chain.MatchIDs, matchId)
+	}
+	chain.Status = "EXECUTED"
+	return nil
+}
+
+// RejectExchangeChain lets any pair's hospital turn down a proposed chain. Its pairs
+// return to the pool.
+func (s *SmartContract) RejectExchangeChain(ctx contractapi.TransactionContextInterface, chainId, pairId, reason string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return codedError(CodeInvalidArgument, "", "reason", "a rejection reason is required")
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return err
+	}
+	chain, _, err := proposedChainPair(ctx, chainId, pairId, hospitalId)
+	if err != nil {
+		return err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	chain.Status, chain.Reason, chain.UpdatedAt = "REJECTED", reason, ts
+	if err := putState(ctx, chain.ID, chain); err != nil {
+		return err
+	}
+	for _, id := range chain.PairIDs {
+		pair, err := getState[ExchangePair](ctx, id)
+		if err != nil {
+			return err
+		}
+		pair.Status, pair.ChainID = "ACTIVE", ""
+		if err := putState(ctx, pair.ID, pair); err != nil {
+			return err
+		}
+	}
+	return emitEvent(ctx, EventExchangeChainRejected, map[string]string{
+		"chainId": chain.ID, "pairId": pairId, "hospitalId": hospitalId, "reason": reason,
+	})
+}
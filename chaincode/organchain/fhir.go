@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// FHIR R4 export. Record IDs are carried as identifiers under the systems below, and
+// codes the registry defines itself, such as organs and blood types, use its own code
+// systems rather than a guessed mapping to SNOMED CT. Names and contact details are
+// not on the ledger and are never exported.
+const (
+	fhirPatientSystem    = "urn:organchain:patient"
+	fhirDonorSystem      = "urn:organchain:donor"
+	fhirHospitalSystem   = "urn:organchain:hospital"
+	fhirOrganSystem      = "urn:organchain:organ"
+	fhirBloodTypeURL     = "urn:organchain:fhir:blood-type"
+	fhirRecordTypeSystem = "urn:organchain:record-type"
+)
+
+// fhirPriorities maps urgency tiers to ServiceRequest priorities.
+var fhirPriorities = map[string]string{"STATUS_1A": "stat", "STATUS_1B": "urgent", "ROUTINE": "routine"}
+
+// fhirRequestStatuses maps patient statuses to ServiceRequest statuses.
+var fhirRequestStatuses = map[string]string{
+	"WAITING": "active", "MATCHED": "active", "INACTIVE": "on-hold", "TRANSPLANTED": "completed",
+	StatusRemoved: "revoked", StatusDeceased: "revoked", StatusArchived: "revoked",
+}
+
+type fhirCoding struct {
+	System string `json:"system,omitempty"`
+	Code   string `json:"code"`
+}
+
+type fhirCodeableConcept struct {
+	Coding []*fhirCoding `json:"coding"`
+	Text   string        `json:"text,omitempty"`
+}
+
+type fhirIdentifier struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type fhirReference struct {
+	Reference string `json:"reference"`
+}
+
+type fhirMeta struct {
+	VersionID string        `json:"versionId,omitempty"`
+	Tag       []*fhirCoding `json:"tag,omitempty"`
+}
+
+type fhirExtension struct {
+	URL                  string               `json:"url"`
+	ValueCodeableConcept *fhirCodeableConcept `json:"valueCodeableConcept,omitempty"`
+}
+
+type fhirPatient struct {
+	ResourceType         string            `json:"resourceType"`
+	ID                   string            `json:"id"`
+	Meta                 *fhirMeta         `json:"meta,omitempty"`
+	Extension            []*fhirExtension  `json:"extension,omitempty"`
+	Identifier           []*fhirIdentifier `json:"identifier"`
+	Active               bool              `json:"active"`
+	ManagingOrganization *fhirReference    `json:"managingOrganization,omitempty"`
+}
+
+type fhirAddress struct {
+	Text string `json:"text"`
+}
+
+type fhirOrganization struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id"`
+	Identifier   []*fhirIdentifier `json:"identifier"`
+	Active       bool              `json:"active"`
+	Name         string            `json:"name"`
+	Address      []*fhirAddress    `json:"address,omitempty"`
+}
+
+type fhirServiceRequest struct {
+	ResourceType string               `json:"resourceType"`
+	ID           string               `json:"id"`
+	Identifier   []*fhirIdentifier    `json:"identifier"`
+	Status       string               `json:"status"`
+	Intent       string               `json:"intent"`
+	Priority     string               `json:"priority,omitempty"`
+	Code         *fhirCodeableConcept `json:"code"`
+	Subject      *fhirReference       `json:"subject"`
+	Requester    *fhirReference       `json:"requester,omitempty"`
+	AuthoredOn   string               `json:"authoredOn,omitempty"`
+}
+
+type fhirBundleEntry struct {
+	FullURL  string `json:"fullUrl"`
+	Resource any    `json:"resource"`
+}
+
+type fhirBundle struct {
+	ResourceType string             `json:"resourceType"`
+	Type         string             `json:"type"`
+	Timestamp    string             `json:"timestamp"`
+	Entry        []*fhirBundleEntry `json:"entry"`
+}
+
+// fhirURL names a resource in a bundle. It is not a RESTful URL, so references within
+// the bundle use it verbatim.
+func fhirURL(resourceType, id string) string {
+	return "urn:organchain:" + resourceType + "/" + id
+}
+
+func (b *fhirBundle) add(resourceType, id string, resource any) {
+	b.Entry = append(b.Entry, &fhirBundleEntry{FullURL: fhirURL(resourceType, id), Resource: resource})
+}
+
+func fhirBloodType(bloodType string) []*fhirExtension {
+	return []*fhirExtension{{
+		URL:                  fhirBloodTypeURL,
+		ValueCodeableConcept: &fhirCodeableConcept{Coding: []*fhirCoding{{Code: bloodType}}, Text: bloodType},
+	}}
+}
+
+func fhirRecordTag(docType string) *fhirMeta {
+	return &fhirMeta{Tag: []*fhirCoding{{System: fhirRecordTypeSystem, Code: docType}}}
+}
+
+func fhirHospital(h *Hospital) *fhirOrganization {
+	org := &fhirOrganization{
+		ResourceType: "Organization", ID: h.ID, Identifier: []*fhirIdentifier{{System: fhirHospitalSystem, Value: h.ID}},
+		Active: h.IsActive, Name: h.Name,
+	}
+	if h.Location != "" {
+		org.Address = []*fhirAddress{{Text: h.Location}}
+	}
+	return org
+}
+
+func fhirJSON(resource any) (string, error) {
+	bytes, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// ExportPatientFHIR returns a FHIR R4 collection Bundle for a patient the caller may
+// read. It holds a Patient, the patient's listing as a ServiceRequest for the organ
+// transplant, and the listing hospital as an Organization.
+func (s *SmartContract) ExportPatientFHIR(ctx contractapi.TransactionContextInterface, patientId string) (string, error) {
+	p, err := s.GetPatient(ctx, patientId)
+	if err != nil {
+		return "", err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	bundle := &fhirBundle{ResourceType: "Bundle", Type: "collection", Timestamp: ts, Entry: []*fhirBundleEntry{}}
+	meta := fhirRecordTag(docTypePatient)
+	meta.VersionID = strconv.Itoa(p.Version)
+	bundle.add("Patient", p.ID, &fhirPatient{
+		ResourceType: "Patient", ID: p.ID, Meta: meta, Extension: fhirBloodType(p.BloodType),
+		Identifier: []*fhirIdentifier{{System: fhirPatientSystem, Value: p.ID}},
+		Active:     p.Status != StatusArchived, ManagingOrganization: &fhirReference{Reference: fhirURL("Organization", p.HospitalID)},
+	})
+	status := fhirRequestStatuses[p.Status]
+	if status == "" {
+		status = "unknown"
+	}
+	bundle.add("ServiceRequest", p.ID, &fhirServiceRequest{
+		ResourceType: "ServiceRequest", ID: p.ID, Identifier: []*fhirIdentifier{{System: fhirPatientSystem, Value: p.ID}},
+		Status: status, Intent: "order", Priority: fhirPriorities[p.Urgency],
+		Code: &fhirCodeableConcept{
+			Coding: []*fhirCoding{{System: fhirOrganSystem, Code: p.OrganNeeded}}, Text: p.OrganNeeded + " transplant",
+		},
+		Subject:    &fhirReference{Reference: fhirURL("Patient", p.ID)},
+		Requester:  &fhirReference{Reference: fhirURL("Organization", p.HospitalID)},
+		AuthoredOn: p.CreatedAt,
+	})
+	h, err := findState[Hospital](ctx, p.HospitalID)
+	if err != nil {
+		return "", err
+	}
+	if h != nil {
+		bundle.add("Organization", h.ID, fhirHospital(h))
+	}
+	return fhirJSON(bundle)
+}
+
+// ExportDonorFHIR returns a donor as a FHIR R4 Patient resource, tagged as a donor
+// record.
+func (s *SmartContract) ExportDonorFHIR(ctx contractapi.TransactionContextInterface, donorId string) (string, error) {
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return "", err
+	}
+	meta := fhirRecordTag(docTypeDonor)
+	meta.VersionID = strconv.Itoa(d.Version)
+	return fhirJSON(&fhirPatient{
+		ResourceType: "Patient", ID: d.ID, Meta: meta, Extension: fhirBloodType(d.BloodType),
+		Identifier: []*fhirIdentifier{{System: fhirDonorSystem, Value: d.ID}},
+		Active:     d.VerificationStatus != "WITHDRAWN" && d.VerificationStatus != DonorInactive && d.VerificationStatus != StatusArchived,
+	})
+}
+
+// ExportHospitalFHIR returns a hospital as a FHIR R4 Organization resource.
+func (s *SmartContract) ExportHospitalFHIR(ctx contractapi.TransactionContextInterface, hospitalId string) (string, error) {
+	h, err := s.GetHospital(ctx, hospitalId)
+	if err != nil {
+		return "", err
+	}
+	return fhirJSON(fhirHospital(h))
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testEpoch is the transaction time of the first transaction on a test ledger.
+var testEpoch = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// attrsExtension is the certificate extension Fabric CA writes identity attributes to.
+var attrsExtension = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// testLedger runs the contract against a shimtest mock stub. Transactions see Now as
+// their timestamp, and the stub answers the calls MockStub leaves unimplemented: key
+// history from History, rich queries from QueryResults (recording each query), paged
+// partial-key reads and private data purges.
+type testLedger struct {
+	t    *testing.T
+	stub *shimtest.MockStub
+	txs  int
+
+	Now time.Time
+	// Transient is the transient map of the next invocation only.
+	Transient    map[string][]byte
+	History      map[string][]*queryresult.KeyModification
+	Queries      []string
+	QueryResults []*queryresult.KV
+	// Events holds the events of the last invocation, in the order they were set.
+	Events []*peer.ChaincodeEvent
+}
+
+// contractChaincode builds the chaincode once; generating its metadata is slow, and it
+// keeps no state between invocations.
+var contractChaincode = sync.OnceValues(func() (*contractapi.ContractChaincode, error) {
+	return contractapi.NewChaincode(newSmartContract())
+})
+
+// newTestLedger returns an empty ledger with an admin of Org1MSP as the caller.
+func newTestLedger(t *testing.T) *testLedger {
+	t.Helper()
+	t.Setenv(devNetworkEnv, "true")
+	cc, err := contractChaincode()
+	if err != nil {
+		t.Fatalf("failed to create chaincode: %v", err)
+	}
+	l := &testLedger{t: t, Now: testEpoch, History: map[string][]*queryresult.KeyModification{}}
+	l.stub = shimtest.NewMockStub("organchain", &testChaincode{cc: cc, l: l})
+	l.as("Org1MSP", "role=admin")
+	return l
+}
+
+// newSeededLedger returns a ledger holding the InitLedger sample data.
+func newSeededLedger(t *testing.T) *testLedger {
+	t.Helper()
+	l := newTestLedger(t)
+	l.mustInvoke("InitLedger")
+	return l
+}
+
+// as makes the next invocations come from a new identity of mspID carrying attrs,
+// e.g. "role=hospital,hospitalId=HOSP-001".
+func (l *testLedger) as(mspID, attrs string) {
+	l.t.Helper()
+	l.stub.Creator = testCreator(l.t, mspID, attrs)
+}
+
+// asHospital makes the next invocations come from a hospital identity of Org1MSP.
+func (l *testLedger) asHospital(hospitalID string) {
+	l.as("Org1MSP", "role=hospital,hospitalId="+hospitalID)
+}
+
+// invoke calls a contract function in a new transaction.
+func (l *testLedger) invoke(fn string, args ...string) peer.Response {
+	l.txs++
+	argv := [][]byte{[]byte(fn)}
+	for _, a := range args {
+		argv = append(argv, []byte(a))
+	}
+	l.stub.TransientMap = l.Transient
+	res := l.stub.MockInvoke(fmt.Sprintf("tx%d", l.txs), argv)
+	l.stub.TransientMap, l.Transient = nil, nil
+	l.Events = nil
+	for len(l.stub.ChaincodeEventsChannel) > 0 {
+		l.Events = append(l.Events, <-l.stub.ChaincodeEventsChannel)
+	}
+	return res
+}
+
+// mustInvoke calls a contract function that must succeed and returns its payload.
+func (l *testLedger) mustInvoke(fn string, args ...string) []byte {
+	l.t.Helper()
+	res := l.invoke(fn, args...)
+	if res.Status != shim.OK {
+		l.t.Fatalf("%s(%s) failed: %s", fn, strings.Join(args, ", "), res.Message)
+	}
+	return res.Payload
+}
+
+// mustFail calls a contract function that must fail and returns its error.
+func (l *testLedger) mustFail(fn string, args ...string) *ChaincodeError {
+	l.t.Helper()
+	res := l.invoke(fn, args...)
+	if res.Status == shim.OK {
+		l.t.Fatalf("%s(%s) succeeded, want an error", fn, strings.Join(args, ", "))
+	}
+	ce := &ChaincodeError{}
+	if err := json.Unmarshal([]byte(res.Message), ce); err != nil {
+		ce.Message = res.Message
+	}
+	return ce
+}
+
+// mustInvokeJSON calls a contract function that must succeed and decodes its payload
+// into out.
+func (l *testLedger) mustInvokeJSON(out interface{}, fn string, args ...string) {
+	l.t.Helper()
+	if err := json.Unmarshal(l.mustInvoke(fn, args...), out); err != nil {
+		l.t.Fatalf("%s returned invalid JSON: %v", fn, err)
+	}
+}
+
+// lastEvent returns the event the last invocation left on the transaction, as Fabric
+// keeps only the last one set.
+func (l *testLedger) lastEvent() (string, map[string]interface{}) {
+	l.t.Helper()
+	if len(l.Events) == 0 {
+		l.t.Fatalf("no event was emitted")
+	}
+	ev := l.Events[len(l.Events)-1]
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+		l.t.Fatalf("event %s has an invalid payload: %v", ev.EventName, err)
+	}
+	return ev.EventName, payload
+}
+
+// stateKey returns the world state key of a record.
+func (l *testLedger) stateKey(docType, id string) string {
+	l.t.Helper()
+	key, err := shim.CreateCompositeKey(docType, []string{id})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return key
+}
+
+// record reads a record straight from world state into out; it reports whether the
+// record exists.
+func (l *testLedger) record(docType, id string, out interface{}) bool {
+	l.t.Helper()
+	bytes := l.stub.State[l.stateKey(docType, id)]
+	if bytes == nil {
+		return false
+	}
+	if err := json.Unmarshal(bytes, out); err != nil {
+		l.t.Fatalf("%s %s is not valid JSON: %v", docType, id, err)
+	}
+	return true
+}
+
+// put writes a record straight to world state, outside any contract function, for
+// states that are slow to reach through the contract.
+func (l *testLedger) put(docType, id string, record interface{}) {
+	l.t.Helper()
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.txs++
+	l.stub.MockTransactionStart(fmt.Sprintf("tx%d", l.txs))
+	defer l.stub.MockTransactionEnd(fmt.Sprintf("tx%d", l.txs))
+	if err := l.stub.PutState(l.stateKey(docType, id), bytes); err != nil {
+		l.t.Fatal(err)
+	}
+}
+
+func (l *testLedger) patient(id string) *Patient {
+	l.t.Helper()
+	p := &Patient{}
+	if !l.record(docTypePatient, id, p) {
+		l.t.Fatalf("patient %s does not exist", id)
+	}
+	return p
+}
+
+func (l *testLedger) donor(id string) *Donor {
+	l.t.Helper()
+	d := &Donor{}
+	if !l.record(docTypeDonor, id, d) {
+		l.t.Fatalf("donor %s does not exist", id)
+	}
+	return d
+}
+
+func (l *testLedger) match(id string) *Match {
+	l.t.Helper()
+	m := &Match{}
+	if !l.record(docTypeMatch, id, m) {
+		l.t.Fatalf("match %s does not exist", id)
+	}
+	return m
+}
+
+// testChaincode hands the contract a testStub in place of the bare mock stub.
+type testChaincode struct {
+	cc *contractapi.ContractChaincode
+	l  *testLedger
+}
+
+func (c *testChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return c.cc.Init(stub)
+}
+
+func (c *testChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return c.cc.Invoke(&testStub{MockStub: stub.(*shimtest.MockStub), l: c.l})
+}
+
+type testStub struct {
+	*shimtest.MockStub
+	l *testLedger
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.l.Now), nil
+}
+
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{mods: s.l.History[key]}, nil
+}
+
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	s.l.Queries = append(s.l.Queries, query)
+	return &stateIterator{kvs: s.l.QueryResults}, nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages through the keys in order. The
+// bookmark is the last key of the previous page.
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	it, err := s.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+	page := []*queryresult.KV{}
+	for it.HasNext() && int32(len(page)) < pageSize {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if bookmark == "" || kv.Key > bookmark {
+			page = append(page, kv)
+		}
+	}
+	meta := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(page))}
+	if len(page) > 0 {
+		meta.Bookmark = page[len(page)-1].Key
+	}
+	return &stateIterator{kvs: page}, meta, nil
+}
+
+func (s *testStub) PurgePrivateData(collection, key string) error {
+	delete(s.PvtState[collection], key)
+	return nil
+}
+
+type stateIterator struct {
+	kvs []*queryresult.KV
+	i   int
+}
+
+func (it *stateIterator) HasNext() bool { return it.i < len(it.kvs) }
+func (it *stateIterator) Close() error  { return nil }
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	it.i++
+	return it.kvs[it.i-1], nil
+}
+
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+	i    int
+}
+
+func (it *historyIterator) HasNext() bool { return it.i < len(it.mods) }
+func (it *historyIterator) Close() error  { return nil }
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	it.i++
+	return it.mods[it.i-1], nil
+}
+
+// testCreator returns a serialized identity of mspID whose certificate carries attrs,
+// e.g. "role=admin", as Fabric CA would. A cn entry sets the common name instead.
+func testCreator(t *testing.T, mspID, attrs string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user"},
+		NotBefore: testEpoch.Add(-time.Hour), NotAfter: testEpoch.AddDate(10, 0, 0),
+	}
+	values := map[string]string{}
+	for _, kv := range strings.Split(attrs, ",") {
+		if kv == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(kv, "=")
+		if name == "cn" {
+			tmpl.Subject.CommonName = value
+			continue
+		}
+		values[name] = value
+	}
+	if len(values) > 0 {
+		ext, err := json.Marshal(map[string]interface{}{"attrs": values})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: attrsExtension, Value: ext}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid: mspID, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// sortedKeys returns the keys of a world state, for comparing two ledgers.
+func sortedKeys(state map[string][]byte) []string {
+	keys := make([]string, 0, len(state))
+	for k := range state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PatientHistoryRecord is one committed version of a patient record.
+type PatientHistoryRecord struct {
+	TxID      string   `json:"txId"`
+	Timestamp string   `json:"timestamp"`
+	IsDelete  bool     `json:"isDelete"`
+	Value     *Patient `json:"value,omitempty" metadata:",optional"`
+}
+
+// DonorHistoryRecord is one committed version of a donor record.
+type DonorHistoryRecord struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Value     *Donor `json:"value,omitempty" metadata:",optional"`
+}
+
+// PatientHistoryPage is one page of a patient's history plus the bookmark for the next call.
+type PatientHistoryPage struct {
+	Records      []*PatientHistoryRecord `json:"records"`
+	Bookmark     string                  `json:"bookmark"`
+	FetchedCount int32                   `json:"fetchedCount"`
+}
+
+// DonorHistoryPage is one page of a donor's history plus the bookmark for the next call.
+type DonorHistoryPage struct {
+	Records      []*DonorHistoryRecord `json:"records"`
+	Bookmark     string                `json:"bookmark"`
+	FetchedCount int32                 `json:"fetchedCount"`
+}
+
+// readHistory walks the history of a key oldest first. Deleted versions carry no value.
+func readHistory[T any](ctx contractapi.TransactionContextInterface, id string, visit func(txID, ts string, isDelete bool, val *T)) error {
+	key, err := recordKey[T](ctx, id)
+	if err != nil {
+		return err
+	}
+	it, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to read history for %s: %v", id, err)
+	}
+	defer it.Close()
+
+	type entry struct {
+		txID, ts string
+		isDelete bool
+		val      *T
+	}
+	var entries []entry
+	for it.HasNext() {
+		mod, err := it.Next()
+		if err != nil {
+			return err
+		}
+		e := entry{txID: mod.TxId, isDelete: mod.IsDelete}
+		if mod.Timestamp != nil {
+			e.ts = time.Unix(mod.Timestamp.Seconds, int64(mod.Timestamp.Nanos)).UTC().Format(time.RFC3339)
+		}
+		if !mod.IsDelete && len(mod.Value) > 0 {
+			var val T
+			if err := json.Unmarshal(mod.Value, &val); err != nil {
+				return err
+			}
+			e.val = &val
+		}
+		entries = append(entries, e)
+	}
+
+	// The peer returns the newest version first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		visit(entries[i].txID, entries[i].ts, entries[i].isDelete, entries[i].val)
+	}
+	return nil
+}
+
+func (s *SmartContract) GetPatientHistory(ctx contractapi.TransactionContextInterface, id string) ([]*PatientHistoryRecord, error) {
+	records := []*PatientHistoryRecord{}
+	err := readHistory(ctx, id, func(txID, ts string, isDelete bool, val *Patient) {
+		records = append(records, &PatientHistoryRecord{TxID: txID, Timestamp: ts, IsDelete: isDelete, Value: val})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Hospitals may read the history of the patients they hold now, or last held if
+	// the patient has been deleted.
+	for i := len(records) - 1; i >= 0; i-- {
+		if v := records[i].Value; v != nil {
+			if err := requirePatientVisible(ctx, v); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return records, nil
+}
+
+func (s *SmartContract) GetDonorHistory(ctx contractapi.TransactionContextInterface, id string) ([]*DonorHistoryRecord, error) {
+	records := []*DonorHistoryRecord{}
+	err := readHistory(ctx, id, func(txID, ts string, isDelete bool, val *Donor) {
+		if val != nil && val.OrgansAvailable == nil {
+			val.OrgansAvailable = []string{}
+		}
+		records = append(records, &DonorHistoryRecord{TxID: txID, Timestamp: ts, IsDelete: isDelete, Value: val})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// historyPage cuts one page out of a full, oldest-first history. The peer cannot page
+// key history itself, so the bookmark is simply the offset of the next version.
+func historyPage[R any](records []R, pageSize int32, bookmark string) ([]R, string, int32, error) {
+	if pageSize <= 0 {
+		return nil, "", 0, codedError(CodeInvalidArgument, "", "pageSize", "page size must be positive")
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	start := 0
+	if bookmark != "" {
+		var err error
+		if start, err = strconv.Atoi(bookmark); err != nil || start < 0 || start > len(records) {
+			return nil, "", 0, codedError(CodeInvalidArgument, "", "bookmark", "invalid bookmark %q", bookmark)
+		}
+	}
+	end := start + int(pageSize)
+	next := strconv.Itoa(end)
+	if end >= len(records) {
+		end, next = len(records), ""
+	}
+	return records[start:end], next, int32(end - start), nil
+}
+
+func (s *SmartContract) GetPatientHistoryPaginated(ctx contractapi.TransactionContextInterface, id string, pageSize int32, bookmark string) (*PatientHistoryPage, error) {
+	records, err := s.GetPatientHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	page, next, fetched, err := historyPage(records, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &PatientHistoryPage{Records: page, Bookmark: next, FetchedCount: fetched}, nil
+}
+
+func (s *SmartContract) GetDonorHistoryPaginated(ctx contractapi.TransactionContextInterface, id string, pageSize int32, bookmark string) (*DonorHistoryPage, error) {
+	records, err := s.GetDonorHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	page, next, fetched, err := historyPage(records, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &DonorHistoryPage{Records: page, Bookmark: next, FetchedCount: fetched}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// keyModification is one version of a record as the peer's history database holds it.
+func keyModification(t *testing.T, txID string, at time.Time, record interface{}) *queryresult.KeyModification {
+	t.Helper()
+	mod := &queryresult.KeyModification{TxId: txID, Timestamp: timestamppb.New(at), IsDelete: record == nil}
+	if record != nil {
+		bytes, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod.Value = bytes
+	}
+	return mod
+}
+
+func TestGetPatientHistory(t *testing.T) {
+	l := newTestLedger(t)
+	waiting := &Patient{ID: "PAT-001", Status: "WAITING", HospitalID: "HOSP-001", DocType: docTypePatient}
+	matched := &Patient{ID: "PAT-001", Status: "MATCHED", HospitalID: "HOSP-001", DocType: docTypePatient}
+	// The peer returns the newest version first.
+	l.History[l.stateKey(docTypePatient, "PAT-001")] = []*queryresult.KeyModification{
+		keyModification(t, "tx3", testEpoch.Add(2*time.Hour), nil),
+		keyModification(t, "tx2", testEpoch.Add(time.Hour), matched),
+		keyModification(t, "tx1", testEpoch, waiting),
+	}
+
+	var records []*PatientHistoryRecord
+	l.mustInvokeJSON(&records, "GetPatientHistory", "PAT-001")
+	want := []struct {
+		txID, timestamp, status string
+		isDelete                bool
+	}{
+		{"tx1", "2026-03-01T09:00:00Z", "WAITING", false},
+		{"tx2", "2026-03-01T10:00:00Z", "MATCHED", false},
+		{"tx3", "2026-03-01T11:00:00Z", "", true},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d history records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.TxID != w.txID || r.Timestamp != w.timestamp || r.IsDelete != w.isDelete {
+			t.Errorf("record %d = %s %s delete=%v, want %s %s delete=%v", i, r.TxID, r.Timestamp, r.IsDelete, w.txID, w.timestamp, w.isDelete)
+		}
+		switch {
+		case w.isDelete && r.Value != nil:
+			t.Errorf("record %d is a deletion but carries a value", i)
+		case !w.isDelete && (r.Value == nil || r.Value.Status != w.status):
+			t.Errorf("record %d value = %+v, want status %s", i, r.Value, w.status)
+		}
+	}
+
+	// A deleted patient's history stays with the hospital that last held them.
+	l.asHospital("HOSP-002")
+	if err := l.mustFail("GetPatientHistory", "PAT-001"); err.Code != CodeForbidden {
+		t.Errorf("another hospital's read failed with %s, want %s", err.Code, CodeForbidden)
+	}
+}
+
+func TestGetDonorHistory(t *testing.T) {
+	l := newTestLedger(t)
+	pending := &Donor{ID: "DON-101", VerificationStatus: "PENDING_VERIFICATION", DocType: docTypeDonor}
+	verified := &Donor{ID: "DON-101", VerificationStatus: "VERIFIED", VerifiedBy: "HOSP-001", OrgansAvailable: []string{"Kidney"}, DocType: docTypeDonor}
+	l.History[l.stateKey(docTypeDonor, "DON-101")] = []*queryresult.KeyModification{
+		keyModification(t, "tx3", testEpoch.Add(2*time.Hour), nil),
+		keyModification(t, "tx2", testEpoch.Add(time.Hour), verified),
+		keyModification(t, "tx1", testEpoch, pending),
+	}
+
+	var records []*DonorHistoryRecord
+	l.mustInvokeJSON(&records, "GetDonorHistory", "DON-101")
+	if len(records) != 3 {
+		t.Fatalf("got %d history records, want 3", len(records))
+	}
+	if records[0].TxID != "tx1" || records[0].Value.VerificationStatus != "PENDING_VERIFICATION" {
+		t.Errorf("first record = %s %+v, want the pending donor of tx1", records[0].TxID, records[0].Value)
+	}
+	if records[1].TxID != "tx2" || records[1].Value.VerifiedBy != "HOSP-001" {
+		t.Errorf("second record = %s %+v, want the donor verified by HOSP-001 in tx2", records[1].TxID, records[1].Value)
+	}
+	if !records[2].IsDelete || records[2].Value != nil {
+		t.Errorf("last record = %+v, want a deletion without a value", records[2])
+	}
+}
+
+func TestGetPatientHistoryPaginated(t *testing.T) {
+	l := newTestLedger(t)
+	key := l.stateKey(docTypePatient, "PAT-001")
+	for i := 5; i >= 1; i-- {
+		p := &Patient{ID: "PAT-001", Status: "WAITING", HospitalID: "HOSP-001", Version: i}
+		l.History[key] = append(l.History[key], keyModification(t, fmt.Sprintf("tx%d", i), testEpoch.Add(time.Duration(i)*time.Hour), p))
+	}
+
+	var first, second PatientHistoryPage
+	l.mustInvokeJSON(&first, "GetPatientHistoryPaginated", "PAT-001", "3", "")
+	l.mustInvokeJSON(&second, "GetPatientHistoryPaginated", "PAT-001", "3", first.Bookmark)
+	if len(first.Records) != 3 || first.Records[0].TxID != "tx1" || first.Bookmark == "" {
+		t.Fatalf("first page = %+v, want tx1 to tx3 and a bookmark", first)
+	}
+	if len(second.Records) != 2 || second.Records[0].TxID != "tx4" || second.Bookmark != "" {
+		t.Errorf("second page = %+v, want tx4 and tx5 and no bookmark", second)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// HL7 v2.5 messages for hospital interface engines. They are carried as the "hl7"
+// field of the MatchApproved and TransplantCompleted events, segments separated by
+// carriage returns as on the wire. Record IDs are sent with ORGANCHAIN as their
+// assigning authority and organs in the registry's own coding.
+const (
+	hl7Version   = "2.5"
+	hl7Sender    = "ORGANCHAIN"
+	hl7Authority = "ORGANCHAIN"
+)
+
+// hl7Escaper escapes the delimiters of the default encoding characters in field data.
+var hl7Escaper = strings.NewReplacer(`\`, `\E\`, "|", `\F\`, "^", `\S\`, "&", `\T\`, "~", `\R\`, "\r", " ", "\n", " ")
+
+// hl7Field builds a field from its components, escaping each.
+func hl7Field(components ...string) string {
+	for i, c := range components {
+		components[i] = hl7Escaper.Replace(c)
+	}
+	return strings.TrimRight(strings.Join(components, "^"), "^")
+}
+
+func hl7Time(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "+0000"
+}
+
+// hl7Message joins segments, each given as its segment ID followed by its fields.
+func hl7Message(segments ...[]string) string {
+	lines := make([]string, len(segments))
+	for i, fields := range segments {
+		lines[i] = strings.TrimRight(strings.Join(fields, "|"), "|")
+	}
+	return strings.Join(lines, "\r") + "\r"
+}
+
+// hl7Header is the MSH segment of a message sent on behalf of hospitalID; the
+// transaction ID serves as its control ID.
+func hl7Header(hospitalID, messageType, txID string, at time.Time) []string {
+	return []string{"MSH", `^~\&`, hl7Sender, hl7Field(hospitalID), "", "", hl7Time(at), "", messageType, hl7Field(txID), "P", hl7Version}
+}
+
+func hl7Patient(patientID string) []string {
+	return []string{"PID", "1", "", hl7Field(patientID, "", "", hl7Authority, "PI")}
+}
+
+func hl7Organ(organ string) string {
+	return hl7Field(organ, organ+" transplant", hl7Authority)
+}
+
+// hl7MatchApproved renders an approved match as an ORM^O01 order for the transplant,
+// the match being the placer order and the donor and HLA score noted alongside.
+func hl7MatchApproved(m *Match, hospitalID, txID string, at time.Time) string {
+	return hl7Message(
+		hl7Header(hospitalID, "ORM^O01^ORM_O01", txID, at),
+		hl7Patient(m.PatientID),
+		[]string{"ORC", "NW", hl7Field(m.ID, hl7Authority), "", "", "SC", "", "", "", hl7Time(at)},
+		[]string{"OBR", "1", hl7Field(m.ID, hl7Authority), "", hl7Organ(m.OrganType), "", "", hl7Time(at)},
+		[]string{"NTE", "1", "", hl7Field("Donor " + m.DonorID + "; HLA score " + m.HLAScore)},
+	)
+}
+
+// hl7TransplantCompleted renders a confirmed transplant as an ADT^A08 update whose PR1
+// segment records the procedure, its date and the surgeon.
+func hl7TransplantCompleted(t *Transplant, performed time.Time, txID string, at time.Time) string {
+	pr1 := make([]string, 12)
+	pr1[0], pr1[1], pr1[3], pr1[5], pr1[11] = "PR1", "1", hl7Organ(t.OrganType), hl7Time(performed), hl7Field("", t.Surgeon)
+	return hl7Message(
+		hl7Header(t.HospitalID, "ADT^A08^ADT_A01", txID, at),
+		[]string{"EVN", "A08", hl7Time(at)},
+		hl7Patient(t.PatientID),
+		[]string{"PV1", "1", "I", hl7Field("", "", "", t.HospitalID)},
+		pr1,
+	)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxHLAScore is a full six-antigen match across the A, B and DRB1 loci.
+const maxHLAScore = 6
+
+// CompatibilityScore is the organ-independent compatibility of a patient and donor.
+type CompatibilityScore struct {
+	PatientID       string         `json:"patientId"`
+	DonorID         string         `json:"donorId"`
+	BloodCompatible bool           `json:"bloodCompatible"`
+	BloodTypeTier   string         `json:"bloodTypeTier"`
+	HLAScore        int            `json:"hlaScore"`
+	MaxHLAScore     int            `json:"maxHlaScore"`
+	LocusMatches    map[string]int `json:"locusMatches"`
+	SharedAntigens  []string       `json:"sharedAntigens"`
+	EpletMismatch   *EpletMismatch `json:"epletMismatch"`
+	Errors          []string       `json:"errors"`
+}
+
+// sharedAntigens returns the patient's alleles that the donor also carries, at every
+// locus, as antigen-level names such as A*02.
+func sharedAntigens(patient, donor HLATyping) []string {
+	shared := []string{}
+	for _, locus := range HLALoci {
+		for _, a := range locusSharedAlleles(*patient.alleles(locus), *donor.alleles(locus)) {
+			shared = append(shared, locus+"*"+hlaAntigen(a))
+		}
+	}
+	return shared
+}
+
+// hlaScore counts the antigens shared at the A, B and DRB1 loci, out of 6.
+func hlaScore(patient, donor HLATyping) (int, error) {
+	if patient.isEmpty() {
+		return 0, codedError(CodeInvalidHLA, "", "hla", "patient HLA typing is empty")
+	}
+	if donor.isEmpty() {
+		return 0, codedError(CodeInvalidHLA, "", "hla", "donor HLA typing is empty")
+	}
+	score := 0
+	for _, locus := range scoredLoci {
+		score += len(locusSharedAlleles(*patient.alleles(locus), *donor.alleles(locus)))
+	}
+	return score, nil
+}
+
+// CalculateHLAScore scores two typings, each given as accepted by CreatePatient, by the
+// antigens they share at the A, B and DRB1 loci, out of 6.
+func (s *SmartContract) CalculateHLAScore(patientHLA, donorHLA string) (int, error) {
+	patient, err := parseHLATyping(patientHLA)
+	if err != nil {
+		return 0, wrapError(err, "patient HLA")
+	}
+	donor, err := parseHLATyping(donorHLA)
+	if err != nil {
+		return 0, wrapError(err, "donor HLA")
+	}
+	return hlaScore(patient, donor)
+}
+
+// unacceptableDonorAntigens returns the donor antigens listed as unacceptable for the
+// patient. Any overlap means a likely positive crossmatch.
+func unacceptableDonorAntigens(p *Patient, d *Donor) []string {
+	unacceptable := map[string]bool{}
+	for _, name := range p.UnacceptableAntigens {
+		if locus, allele, err := parseHLAAllele(name); err == nil {
+			unacceptable[locus+"*"+hlaAntigen(allele)] = true
+		}
+	}
+	conflicts := []string{}
+	for _, locus := range HLALoci {
+		for _, a := range *d.HLA.alleles(locus) {
+			if name := locus + "*" + hlaAntigen(a); unacceptable[name] && !containsString(conflicts, name) {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+	return conflicts
+}
+
+// hlaLocusMatches counts shared antigens per locus.
+func hlaLocusMatches(patient, donor HLATyping) map[string]int {
+	breakdown := map[string]int{}
+	for _, locus := range HLALoci {
+		breakdown[locus] = len(locusSharedAlleles(*patient.alleles(locus), *donor.alleles(locus)))
+	}
+	return breakdown
+}
+
+// ComputeCompatibility scores a patient against a donor from their ledger records, so a
+// match's justification can be recomputed by anyone. Organ policy is applied by
+// CheckCompatibility; this reports only the raw blood and HLA comparison. The caller
+// must be able to read the patient.
+func (s *SmartContract) ComputeCompatibility(ctx contractapi.TransactionContextInterface, patientId, donorId string) (*CompatibilityScore, error) {
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePatientVisible(ctx, p); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	eplets, err := s.epletMismatch(ctx, p, d)
+	if err != nil {
+		return nil, err
+	}
+	score := &CompatibilityScore{
+		PatientID: p.ID, DonorID: d.ID, MaxHLAScore: maxHLAScore,
+		LocusMatches:   hlaLocusMatches(p.HLA, d.HLA),
+		SharedAntigens: sharedAntigens(p.HLA, d.HLA),
+		EpletMismatch:  eplets,
+		Errors:         []string{},
+	}
+	if score.HLAScore, err = hlaScore(p.HLA, d.HLA); err != nil {
+		score.Errors = append(score.Errors, errorMessage(err))
+	}
+	if score.BloodCompatible, err = s.IsBloodCompatible(d.BloodType, p.BloodType); err != nil {
+		score.Errors = append(score.Errors, errorMessage(err))
+	}
+	if score.BloodCompatible {
+		score.BloodTypeTier = bloodTypeTier(p.BloodType, d.BloodType)
+	}
+	return score, nil
+}
+
+// UpdatePatientCPRA records a patient's calculated PRA, the percentage of donors the
+// patient is expected to have antibodies against.
+func (s *SmartContract) UpdatePatientCPRA(ctx contractapi.TransactionContextInterface, patientId string, cpra int, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if cpra < 0 || cpra > 100 {
+		return nil, codedError(CodeInvalidArgument, "", "cpra", "cPRA must be between 0 and 100")
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot update cPRA")
+	}
+	p.CPRA = cpra
+	return p, s.putSensitization(ctx, p, hospitalId)
+}
+
+// SetUnacceptableAntigens replaces a patient's unacceptable antigen list, given as a
+// JSON array such as ["A2","B44"]. An empty array clears it.
+func (s *SmartContract) SetUnacceptableAntigens(ctx contractapi.TransactionContextInterface, patientId, antigensJSON string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	var raw []string
+	if err := json.Unmarshal([]byte(antigensJSON), &raw); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "antigens", "antigens must be a JSON array: %v", err)
+	}
+	antigens := []string{}
+	for _, a := range raw {
+		locus, allele, err := parseHLAAllele(a)
+		if err != nil {
+			return nil, codedError(CodeInvalidHLA, "", "antigens", "invalid HLA antigen %q", a)
+		}
+		if name := locus + "*" + hlaAntigen(allele); !containsString(antigens, name) {
+			antigens = append(antigens, name)
+		}
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot update unacceptable antigens")
+	}
+	p.UnacceptableAntigens = antigens
+	return p, s.putSensitization(ctx, p, hospitalId)
+}
+
+func (s *SmartContract) putSensitization(ctx contractapi.TransactionContextInterface, p *Patient, hospitalId string) error {
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	p.SensitizationUpdatedAt = ts
+	if err := putState(ctx, p.ID, p); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPatientUpdated, map[string]interface{}{
+		"patientId": p.ID, "cpra": p.CPRA, "unacceptableAntigens": p.UnacceptableAntigens, "hospitalId": hospitalId,
+	})
+}
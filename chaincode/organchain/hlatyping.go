@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// HLA loci recorded in a typing. A, B and DRB1 make up the six-antigen match score;
+// C and DQB1 are kept and reported but not scored.
+const (
+	LocusA    = "A"
+	LocusB    = "B"
+	LocusC    = "C"
+	LocusDRB1 = "DRB1"
+	LocusDQB1 = "DQB1"
+)
+
+var (
+	HLALoci    = []string{LocusA, LocusB, LocusC, LocusDRB1, LocusDQB1}
+	scoredLoci = []string{LocusA, LocusB, LocusDRB1}
+)
+
+// hlaLocusNames maps the locus prefixes of serological names (A2, Cw7, DR15, DQ7) and
+// molecular names (A*02:01, DRB1*15:01) to the locus they belong to.
+var hlaLocusNames = map[string]string{
+	"A": LocusA, "B": LocusB, "C": LocusC, "CW": LocusC,
+	"DR": LocusDRB1, "DRB1": LocusDRB1, "DQ": LocusDQB1, "DQB1": LocusDQB1,
+}
+
+// hlaAllelePattern matches an allele designation without its locus: up to four
+// colon-separated fields and an optional expression suffix, as in 02, 02:01 or 01:01:01:02N.
+var hlaAllelePattern = regexp.MustCompile(`^[0-9]{1,3}(:[0-9]{2,3}){0,3}[A-Z]?$`)
+
+// HLATyping is a patient's or donor's HLA typing: at most two alleles per locus, held
+// as designations without the locus, e.g. "02:01" for A*02:01 and "02" for the
+// serological A2. A typing with no alleles belongs to a record not yet typed.
+type HLATyping struct {
+	A    []string `json:"A"`
+	B    []string `json:"B"`
+	C    []string `json:"C"`
+	DRB1 []string `json:"DRB1"`
+	DQB1 []string `json:"DQB1"`
+}
+
+// MarshalJSON writes untyped loci as empty lists, since contractapi rejects null.
+func (t HLATyping) MarshalJSON() ([]byte, error) {
+	for _, locus := range HLALoci {
+		if alleles := t.alleles(locus); *alleles == nil {
+			*alleles = []string{}
+		}
+	}
+	type plain HLATyping
+	return json.Marshal(plain(t))
+}
+
+// UnmarshalJSON also reads the comma-separated strings typings were stored as before
+// schema version 3. A legacy string that does not parse reads as untyped.
+func (t *HLATyping) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if json.Unmarshal(data, &legacy) == nil {
+		*t, _ = parseHLATyping(legacy)
+		return nil
+	}
+	type plain HLATyping
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+func (t *HLATyping) alleles(locus string) *[]string {
+	switch locus {
+	case LocusA:
+		return &t.A
+	case LocusB:
+		return &t.B
+	case LocusC:
+		return &t.C
+	case LocusDRB1:
+		return &t.DRB1
+	default:
+		return &t.DQB1
+	}
+}
+
+func (t HLATyping) isEmpty() bool {
+	return len(t.A)+len(t.B)+len(t.C)+len(t.DRB1)+len(t.DQB1) == 0
+}
+
+// parseHLAAllele splits an antigen or allele name such as A2, Cw7, DR15 or DRB1*15:01
+// into its locus and designation, padding the first field to two digits so that A2
+// and A*02 read the same.
+func parseHLAAllele(name string) (string, string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	var prefix, designation string
+	if i := strings.Index(name, "*"); i >= 0 {
+		prefix, designation = name[:i], name[i+1:]
+	} else if i := strings.IndexFunc(name, unicode.IsDigit); i > 0 {
+		prefix, designation = name[:i], name[i:]
+	}
+	locus, ok := hlaLocusNames[prefix]
+	if !ok || !hlaAllelePattern.MatchString(designation) {
+		return "", "", codedError(CodeInvalidHLA, "", "hla", "invalid HLA antigen %q: expected a name such as A2, DR15 or A*02:01 at locus %s", name, strings.Join(HLALoci, ", "))
+	}
+	fields := strings.Split(designation, ":")
+	if len(fields[0]) == 1 {
+		fields[0] = "0" + fields[0]
+	}
+	return locus, strings.Join(fields, ":"), nil
+}
+
+// hlaAntigen reduces an allele designation to antigen level, its first field, which is
+// the level typings are compared at.
+func hlaAntigen(allele string) string {
+	return strings.SplitN(allele, ":", 2)[0]
+}
+
+// add records a named allele, which must belong to locus if one is given.
+func (t *HLATyping) add(locus, name string) error {
+	l, allele, err := parseHLAAllele(name)
+	if err != nil {
+		return err
+	}
+	if locus != "" && l != locus {
+		return codedError(CodeInvalidHLA, "", "hla", "HLA allele %s does not belong to locus %s", name, locus)
+	}
+	alleles := t.alleles(l)
+	if len(*alleles) == 2 {
+		return codedError(CodeInvalidHLA, "", "hla", "HLA locus %s has more than two alleles", l)
+	}
+	*alleles = append(*alleles, allele)
+	return nil
+}
+
+// parseHLATyping reads a typing given either as a JSON object of loci, such as
+// {"A":["02:01","A24"],"DRB1":["15"]}, where alleles may leave out their locus, or as a
+// comma-separated list of names such as "A2, A24, B35, DR1". An empty string is an
+// untyped record.
+func parseHLATyping(s string) (HLATyping, error) {
+	var t HLATyping
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return t, nil
+	}
+	if !strings.HasPrefix(s, "{") {
+		for _, name := range strings.Split(s, ",") {
+			if err := t.add("", name); err != nil {
+				return HLATyping{}, err
+			}
+		}
+		return t, nil
+	}
+
+	var byLocus map[string][]string
+	if err := json.Unmarshal([]byte(s), &byLocus); err != nil {
+		return HLATyping{}, codedError(CodeInvalidHLA, "", "hla", "HLA typing must be a JSON object of loci or a comma-separated list: %v", err)
+	}
+	loci := make([]string, 0, len(byLocus))
+	for locus := range byLocus {
+		loci = append(loci, locus)
+	}
+	sort.Strings(loci)
+	for _, locus := range loci {
+		if !containsString(HLALoci, locus) {
+			return HLATyping{}, codedError(CodeInvalidHLA, "", "hla", "unknown HLA locus %q: must be one of %s", locus, strings.Join(HLALoci, ", "))
+		}
+	}
+	for _, locus := range HLALoci {
+		for _, name := range byLocus[locus] {
+			if strings.IndexFunc(name, unicode.IsLetter) != 0 {
+				name = locus + "*" + name
+			}
+			if err := t.add(locus, name); err != nil {
+				return HLATyping{}, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// locusSharedAlleles returns the patient's alleles at a locus that the donor also
+// carries at antigen level. Each donor allele matches at most one patient allele.
+func locusSharedAlleles(patient, donor []string) []string {
+	remaining := map[string]int{}
+	for _, a := range donor {
+		remaining[hlaAntigen(a)]++
+	}
+	shared := []string{}
+	for _, a := range patient {
+		if remaining[hlaAntigen(a)] > 0 {
+			remaining[hlaAntigen(a)]--
+			shared = append(shared, a)
+		}
+	}
+	return shared
+}
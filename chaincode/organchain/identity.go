@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// inactiveDonorStatuses are the statuses of donor records that no longer stand for
+// the person, so they may register again.
+var inactiveDonorStatuses = map[string]bool{"WITHDRAWN": true, "REJECTED": true, DonorInactive: true, StatusArchived: true}
+
+// requireUniqueNationalID rejects a new donor whose national ID hash belongs to an
+// active donor, including one created earlier in the same transaction.
+func requireUniqueNationalID(ctx contractapi.TransactionContextInterface, hash, donorID string) error {
+	if hash == "" {
+		return nil
+	}
+	tc, _ := ctx.(*TransactionContext)
+	if tc != nil {
+		if other, ok := tc.nationalIDs[hash]; ok {
+			return codedError(CodeAlreadyExists, docTypeDonor, "nationalIdHash", "donor %s has the same national ID as donor %s in this request", donorID, other)
+		}
+	}
+	donors, err := indexedRecords[Donor](ctx, indexDonorNationalID, hash)
+	if err != nil {
+		return err
+	}
+	for _, d := range donors {
+		if !inactiveDonorStatuses[d.VerificationStatus] {
+			return codedError(CodeAlreadyExists, docTypeDonor, "nationalIdHash", "the national ID of donor %s is already registered to active donor %s", donorID, d.ID)
+		}
+	}
+	if tc != nil {
+		if tc.nationalIDs == nil {
+			tc.nationalIDs = map[string]string{}
+		}
+		tc.nationalIDs[hash] = donorID
+	}
+	return nil
+}
+
+// listedPatientStatuses are the statuses of a patient still on an organ's waitlist,
+// including one temporarily inactive.
+var listedPatientStatuses = map[string]bool{"WAITING": true, "MATCHED": true, "INACTIVE": true}
+
+// ListedPatient is one listing of a multi-listed person.
+type ListedPatient struct {
+	PatientID  string `json:"patientId"`
+	HospitalID string `json:"hospitalId"`
+	Status     string `json:"status"`
+	ListedAt   string `json:"listedAt"`
+}
+
+// MultiListing is one person listed for the same organ at more than one hospital.
+type MultiListing struct {
+	OrganType   string           `json:"organType"`
+	HospitalIDs []string         `json:"hospitalIds"`
+	Listings    []*ListedPatient `json:"listings"`
+}
+
+// DetectMultiListings returns the people listed for the same organ at more than one
+// hospital, found by their patients' IdentityHash; an empty organType checks every
+// organ. Only listings still on the waitlist count, and patients without an identity
+// hash cannot be linked. It reads every hospital's patients, so only admins,
+// coordinators and regulators may call it.
+func (s *SmartContract) DetectMultiListings(ctx contractapi.TransactionContextInterface, organType string) ([]*MultiListing, error) {
+	if err := requireRole(ctx, RoleAdmin, RoleCoordinator, RoleRegulator); err != nil {
+		return nil, err
+	}
+	values := []string{}
+	if organType != "" {
+		if err := validateOrgan(organType); err != nil {
+			return nil, err
+		}
+		values = append(values, organType)
+	}
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(indexPatientIdentity, values)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	// Entries for one organ and hash are adjacent in index order.
+	groups := [][]string{}
+	last := ""
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if group := attrs[0] + "/" + attrs[1]; group != last {
+			groups, last = append(groups, []string{}), group
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], attrs[2])
+	}
+
+	found := []*MultiListing{}
+	for _, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		listing := &MultiListing{HospitalIDs: []string{}, Listings: []*ListedPatient{}}
+		for _, id := range ids {
+			p, err := findState[Patient](ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if p == nil || !listedPatientStatuses[p.Status] {
+				continue
+			}
+			listing.OrganType = p.OrganNeeded
+			if !containsString(listing.HospitalIDs, p.HospitalID) {
+				listing.HospitalIDs = append(listing.HospitalIDs, p.HospitalID)
+			}
+			listing.Listings = append(listing.Listings, &ListedPatient{
+				PatientID: p.ID, HospitalID: p.HospitalID, Status: p.Status, ListedAt: p.CreatedAt,
+			})
+		}
+		if len(listing.HospitalIDs) > 1 {
+			found = append(found, listing)
+		}
+	}
+	return found, nil
+}
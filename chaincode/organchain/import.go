@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Import row statuses.
+const (
+	ImportAccepted  = "ACCEPTED"
+	ImportDuplicate = "DUPLICATE"
+	ImportInvalid   = "INVALID"
+)
+
+// importEntry is one row of an ImportRecords bundle: a record of the given docType,
+// with the fields its batch call takes; see PatientInput and DonorInput.
+type importEntry struct {
+	DocType string          `json:"docType"`
+	Record  json.RawMessage `json:"record"`
+}
+
+// ImportRow reports the validation of one row of an import bundle, by its position.
+// A DUPLICATE row's ID is already on the ledger or earlier in the bundle. Code,
+// Message, Field and Errors say why a row was not accepted, as in ChaincodeError.
+type ImportRow struct {
+	Index   int           `json:"index"`
+	DocType string        `json:"docType"`
+	ID      string        `json:"id"`
+	Status  string        `json:"status"`
+	Code    string        `json:"code,omitempty" metadata:",optional"`
+	Message string        `json:"message,omitempty" metadata:",optional"`
+	Field   string        `json:"field,omitempty" metadata:",optional"`
+	Errors  []*FieldError `json:"errors,omitempty" metadata:",optional"`
+}
+
+// ImportReport is the outcome of ImportRecords. Committed is set only when every row
+// was accepted and the call was not a dry run.
+type ImportReport struct {
+	DryRun     bool         `json:"dryRun"`
+	Committed  bool         `json:"committed"`
+	Accepted   int          `json:"accepted"`
+	Duplicates int          `json:"duplicates"`
+	Invalid    int          `json:"invalid"`
+	Rows       []*ImportRow `json:"rows"`
+}
+
+// importPlan holds the validated records of a bundle until they are written.
+type importPlan struct {
+	seen     map[string]bool
+	piiByID  donorPIIByID
+	patients []*Patient
+	donors   []*pendingDonor
+}
+
+// ImportRecords validates a JSON array of patients and donors, each row of the form
+// {"docType": "patient", "record": {...}}, and reports every row as ACCEPTED, DUPLICATE
+// or INVALID. Nothing is written unless every row is accepted; a dry run never writes.
+// Donor PII travels in the donor_pii transient field by donor ID, as for
+// CreateDonorsBatch, and patients are registered at the caller's hospital.
+func (s *SmartContract) ImportRecords(ctx contractapi.TransactionContextInterface, bundleJSON string, dryRun bool) (*ImportReport, error) {
+	entries, err := parseBatch[importEntry](bundleJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.DocType == docTypePatient {
+			if err := s.requireHospitalWriter(ctx); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	piiByID, err := transientDonorPIIByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: dryRun, Rows: []*ImportRow{}}
+	plan := &importPlan{seen: map[string]bool{}, piiByID: piiByID}
+	for i, e := range entries {
+		id, err := s.prepareImport(ctx, e, plan)
+		row := &ImportRow{Index: i, DocType: e.DocType, ID: id, Status: ImportAccepted}
+		if err != nil {
+			row.Code, row.Message, row.Field, row.Errors = errorFields(err)
+			row.Status = ImportInvalid
+			if row.Code == CodeAlreadyExists {
+				row.Status = ImportDuplicate
+			}
+		}
+		switch row.Status {
+		case ImportAccepted:
+			report.Accepted++
+		case ImportDuplicate:
+			report.Duplicates++
+		default:
+			report.Invalid++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	if dryRun || report.Accepted < len(entries) {
+		return report, nil
+	}
+
+	patientIDs, donorIDs := []string{}, []string{}
+	for _, p := range plan.patients {
+		if err := putState(ctx, p.ID, p); err != nil {
+			return nil, err
+		}
+		patientIDs = append(patientIDs, p.ID)
+	}
+	for _, n := range plan.donors {
+		if err := s.writeDonor(ctx, n); err != nil {
+			return nil, err
+		}
+		donorIDs = append(donorIDs, n.donor.ID)
+	}
+	report.Committed = true
+	return report, emitEvent(ctx, EventRecordsImported, map[string]interface{}{"patientIds": patientIDs, "donorIds": donorIDs})
+}
+
+// prepareImport validates one row and adds its record to the plan, returning the
+// row's record ID.
+func (s *SmartContract) prepareImport(ctx contractapi.TransactionContextInterface, e *importEntry, plan *importPlan) (string, error) {
+	switch e.DocType {
+	case docTypePatient:
+		var in PatientInput
+		if err := decodeImportRecord(e.Record, &in); err != nil {
+			return "", err
+		}
+		if err := repeatedInBatch(plan.seen, docTypePatient, in.ID); err != nil {
+			return in.ID, err
+		}
+		p, err := s.newPatient(ctx, &in)
+		if err != nil {
+			return in.ID, err
+		}
+		plan.patients = append(plan.patients, p)
+		return in.ID, nil
+	case docTypeDonor:
+		var in DonorInput
+		if err := decodeImportRecord(e.Record, &in); err != nil {
+			return "", err
+		}
+		if err := repeatedInBatch(plan.seen, docTypeDonor, in.ID); err != nil {
+			return in.ID, err
+		}
+		n, err := s.newDonor(ctx, &in, plan.piiByID.reader(in.ID))
+		if err != nil {
+			return in.ID, err
+		}
+		plan.donors = append(plan.donors, n)
+		return in.ID, nil
+	}
+	return "", codedError(CodeInvalidArgument, "", "docType", "docType %q cannot be imported: must be %s or %s", e.DocType, docTypePatient, docTypeDonor)
+}
+
+func decodeImportRecord(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return codedError(CodeInvalidArgument, "", "record", "record is required")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return codedError(CodeInvalidArgument, "", "record", "record must be a JSON object: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Secondary indexes let a query read only the records it wants without CouchDB. Each
+// entry is an empty composite key of the index name, the indexed values and the
+// record ID, e.g. patient~organ~blood~status / Kidney / A+ / WAITING / PAT-001, kept
+// up to date by putState and delState.
+const (
+	indexPatientOrgan    = "patient~organ~blood~status"
+	indexPatientHospital = "patient~hospital~status"
+	// indexPatientIdentity groups one person's listings for an organ by IdentityHash.
+	indexPatientIdentity = "patient~organ~identity"
+	// indexDonorOrgan has an entry for each organ a donor has available.
+	indexDonorOrgan = "donor~organ~status~blood"
+	// indexDonorNationalID finds the donors registered under a national ID hash.
+	indexDonorNationalID = "donor~nationalId"
+	indexMatchPatient    = "match~patient"
+	indexMatchDonor      = "match~donor"
+	// indexMatchHospital is keyed by the hospital that created the match, its ApprovedBy.
+	indexMatchHospital = "match~hospital"
+	// indexActivity has an entry for each activity feed event, newest first; see
+	// activityIndexEntry.
+	indexActivity = "activity~time"
+)
+
+// indexNames lists every secondary index, for ClearLedger and RebuildIndexes.
+var indexNames = []string{indexPatientOrgan, indexPatientHospital, indexPatientIdentity, indexDonorOrgan, indexDonorNationalID, indexMatchPatient, indexMatchDonor, indexMatchHospital, indexActivity}
+
+// indexMarker is the value of every index entry: Fabric treats an empty value as a delete.
+var indexMarker = []byte{0x00}
+
+// indexEntries returns the index entries of a record, each the index name followed by
+// its attributes. Types without indexes have none.
+func indexEntries(record any) [][]string {
+	switch r := record.(type) {
+	case Patient:
+		return indexEntries(&r)
+	case *Patient:
+		entries := [][]string{
+			{indexPatientOrgan, r.OrganNeeded, r.BloodType, r.Status, r.ID},
+			{indexPatientHospital, r.HospitalID, r.Status, r.ID},
+		}
+		if r.IdentityHash != "" {
+			entries = append(entries, []string{indexPatientIdentity, r.OrganNeeded, r.IdentityHash, r.ID})
+		}
+		return appendActivity(entries, "PATIENT_CREATED", r.ID, r.CreatedAt)
+	case Donor:
+		return indexEntries(&r)
+	case *Donor:
+		entries := [][]string{}
+		for _, organ := range r.OrgansAvailable {
+			entries = append(entries, []string{indexDonorOrgan, organ, r.VerificationStatus, r.BloodType, r.ID})
+		}
+		if r.NationalIDHash != "" {
+			entries = append(entries, []string{indexDonorNationalID, r.NationalIDHash, r.ID})
+		}
+		entries = appendActivity(entries, "DONOR_CREATED", r.ID, r.CreatedAt)
+		if r.VerificationStatus == "VERIFIED" || r.VerificationStatus == "REJECTED" {
+			entries = appendActivity(entries, "DONOR_"+r.VerificationStatus, r.ID, r.VerifiedAt)
+		}
+		return entries
+	case Match:
+		return indexEntries(&r)
+	case *Match:
+		return appendActivity([][]string{
+			{indexMatchPatient, r.PatientID, r.ID},
+			{indexMatchDonor, r.DonorID, r.ID},
+			{indexMatchHospital, r.ApprovedBy, r.ID},
+		}, "MATCH_CREATED", r.ID, r.CreatedAt)
+	case Transplant:
+		return indexEntries(&r)
+	case *Transplant:
+		return appendActivity(nil, "TRANSPLANT_COMPLETED", r.ID, r.CreatedAt)
+	}
+	return nil
+}
+
+func indexKeys(ctx contractapi.TransactionContextInterface, record any) ([]string, error) {
+	keys := []string{}
+	for _, e := range indexEntries(record) {
+		key, err := ctx.GetStub().CreateCompositeKey(e[0], e[1:])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// storedIndexKeys returns the index keys of the record at key as last written. Reads
+// do not see this transaction's writes, so keys written earlier in it are remembered
+// on the transaction context.
+func storedIndexKeys[T any](ctx contractapi.TransactionContextInterface, key string) ([]string, error) {
+	if tc, ok := ctx.(*TransactionContext); ok {
+		if keys, ok := tc.indexed[key]; ok {
+			return keys, nil
+		}
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil || bytes == nil {
+		return nil, err
+	}
+	var old T
+	if err := json.Unmarshal(bytes, &old); err != nil {
+		// A record that no longer decodes has no index entries we can find.
+		return nil, nil
+	}
+	return indexKeys(ctx, old)
+}
+
+// reindex replaces the index entries of the record at key with those of record, which
+// is nil when the record is being deleted.
+func reindex[T any](ctx contractapi.TransactionContextInterface, key string, record any) error {
+	old, err := storedIndexKeys[T](ctx, key)
+	if err != nil {
+		return err
+	}
+	current := []string{}
+	if record != nil {
+		if current, err = indexKeys(ctx, record); err != nil {
+			return err
+		}
+	}
+	for _, k := range old {
+		if !containsString(current, k) {
+			if err := ctx.GetStub().DelState(k); err != nil {
+				return err
+			}
+		}
+	}
+	for _, k := range current {
+		if !containsString(old, k) {
+			if err := ctx.GetStub().PutState(k, indexMarker); err != nil {
+				return err
+			}
+		}
+	}
+	if tc, ok := ctx.(*TransactionContext); ok {
+		if tc.indexed == nil {
+			tc.indexed = map[string][]string{}
+		}
+		tc.indexed[key] = current
+	}
+	return nil
+}
+
+// indexedIDs returns the IDs of the records whose entries in an index start with the
+// given values, in index order.
+func indexedIDs(ctx contractapi.TransactionContextInterface, index string, values ...string) ([]string, error) {
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(index, values)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	ids := []string{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, attrs[len(attrs)-1])
+	}
+	return ids, nil
+}
+
+// indexedRecords loads the records of type T that indexedIDs finds. Callers still check
+// each record against their filters.
+func indexedRecords[T any](ctx contractapi.TransactionContextInterface, index string, values ...string) ([]*T, error) {
+	ids, err := indexedIDs(ctx, index, values...)
+	if err != nil {
+		return nil, err
+	}
+	records := []*T{}
+	for _, id := range ids {
+		r, err := findState[T](ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// RebuildIndexes drops every secondary index entry and writes them again from the
+// stored records. Records written before an index existed, or by migrations that write
+// state directly, are only found through the index after a rebuild. It returns the
+// number of entries written.
+func (s *SmartContract) RebuildIndexes(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return 0, err
+	}
+	for _, index := range indexNames {
+		if err := clearDocType(ctx, index); err != nil {
+			return 0, err
+		}
+	}
+	patients, err := rebuildIndexEntries[Patient](ctx)
+	if err != nil {
+		return 0, err
+	}
+	donors, err := rebuildIndexEntries[Donor](ctx)
+	if err != nil {
+		return 0, err
+	}
+	matches, err := rebuildIndexEntries[Match](ctx)
+	if err != nil {
+		return 0, err
+	}
+	transplants, err := rebuildIndexEntries[Transplant](ctx)
+	if err != nil {
+		return 0, err
+	}
+	return patients + donors + matches + transplants, nil
+}
+
+// rebuildIndexEntries writes the index entries of every record of type T.
+func rebuildIndexEntries[T any](ctx contractapi.TransactionContextInterface) (int, error) {
+	records, err := queryPopulate[T](ctx)
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, r := range records {
+		keys, err := indexKeys(ctx, r)
+		if err != nil {
+			return 0, err
+		}
+		for _, k := range keys {
+			if err := ctx.GetStub().PutState(k, indexMarker); err != nil {
+				return 0, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
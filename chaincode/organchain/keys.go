@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Every record is stored under a composite key of its docType and ID, so each type
+// has its own keyspace and can be listed with a partial-key query instead of a
+// prefix range.
+const (
+	docTypePatient    = "patient"
+	docTypeDonor      = "donor"
+	docTypeMatch      = "match"
+	docTypeHospital   = "hospital"
+	docTypeTransplant = "transplant"
+	docTypePolicy     = "policy"
+	docTypeAccess     = "access"
+	docTypeOrgan      = "organ"
+	docTypeOffer      = "offer"
+	docTypePair       = "exchangePair"
+	docTypeChain      = "exchangeChain"
+	docTypeSerology   = "serology"
+	docTypeDeath      = "deathDeclaration"
+	docTypeEplet      = "eplet"
+	docTypeRegistry   = "registrySubmission"
+)
+
+// compositeKeyNamespace is the leading byte of every composite key. Peers leave these
+// keys out of plain range queries, but not every stub implementation does.
+const compositeKeyNamespace = "\x00"
+
+// recordDocTypes lists every docType with its own keyspace.
+var recordDocTypes = []string{docTypePatient, docTypeDonor, docTypeMatch, docTypeHospital, docTypeTransplant, docTypePolicy, docTypeAccess, docTypeOrgan, docTypeOffer, docTypePair, docTypeChain, docTypeSerology, docTypeDeath, docTypeEplet, docTypeRegistry}
+
+// configDocTypes hold the network's configuration rather than its records, and
+// survive ClearLedger.
+var configDocTypes = map[string]bool{docTypeHospital: true, docTypePolicy: true, docTypeAccess: true, docTypeEplet: true}
+
+// docTypeOf returns the docType a record type is stored under.
+func docTypeOf[T any]() (string, error) {
+	var zero T
+	switch any(zero).(type) {
+	case Patient, *Patient:
+		return docTypePatient, nil
+	case Donor, *Donor:
+		return docTypeDonor, nil
+	case Match, *Match:
+		return docTypeMatch, nil
+	case Hospital, *Hospital:
+		return docTypeHospital, nil
+	case Transplant, *Transplant:
+		return docTypeTransplant, nil
+	case PolicyConfig, *PolicyConfig:
+		return docTypePolicy, nil
+	case AccessConfig, *AccessConfig:
+		return docTypeAccess, nil
+	case Organ, *Organ:
+		return docTypeOrgan, nil
+	case Offer, *Offer:
+		return docTypeOffer, nil
+	case ExchangePair, *ExchangePair:
+		return docTypePair, nil
+	case ExchangeChain, *ExchangeChain:
+		return docTypeChain, nil
+	case SerologyPanel, *SerologyPanel:
+		return docTypeSerology, nil
+	case DeathDeclaration, *DeathDeclaration:
+		return docTypeDeath, nil
+	case EpletTable, *EpletTable:
+		return docTypeEplet, nil
+	case RegistrySubmission, *RegistrySubmission:
+		return docTypeRegistry, nil
+	}
+	return "", fmt.Errorf("no docType registered for %T", zero)
+}
+
+// recordKey is the world state key of a record of type T.
+func recordKey[T any](ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	docType, err := docTypeOf[T]()
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().CreateCompositeKey(docType, []string{id})
+}
+
+func delState[T any](ctx contractapi.TransactionContextInterface, id string) error {
+	key, err := recordKey[T](ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := reindex[T](ctx, key, nil); err != nil {
+		return err
+	}
+	docType, _ := docTypeOf[T]()
+	if err := writeAudit(ctx, docType, id, key, nil); err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// MigrationSummary counts the records changed by a migration, by docType.
+type MigrationSummary struct {
+	Migrated map[string]int `json:"migrated"`
+	Skipped  []string       `json:"skipped"`
+}
+
+// MigrateToCompositeKeys moves records written under the old flat PAT-/DON-/MATCH-/HOSP-
+// keys to their composite keys. Keys without a known docType are left in place and
+// reported as skipped. History recorded under the old keys stays with those keys.
+func (s *SmartContract) MigrateToCompositeKeys(ctx contractapi.TransactionContextInterface) (*MigrationSummary, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := requireAdmin(ctx); err != nil {
+		// Before migration the admin hospital itself is still under its flat key.
+		if legacyErr := requireLegacyAdmin(ctx); legacyErr != nil {
+			return nil, err
+		}
+	}
+
+	known := map[string]bool{}
+	for _, t := range recordDocTypes {
+		known[t] = true
+	}
+	summary := &MigrationSummary{Migrated: map[string]int{}, Skipped: []string{}}
+
+	it, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(kv.Key, compositeKeyNamespace) {
+			continue
+		}
+		var record struct {
+			DocType string `json:"docType"`
+		}
+		if err := json.Unmarshal(kv.Value, &record); err != nil || !known[record.DocType] {
+			summary.Skipped = append(summary.Skipped, kv.Key)
+			continue
+		}
+		key, err := ctx.GetStub().CreateCompositeKey(record.DocType, []string{kv.Key})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().PutState(key, kv.Value); err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().DelState(kv.Key); err != nil {
+			return nil, err
+		}
+		summary.Migrated[record.DocType]++
+	}
+	return summary, nil
+}
+
+func requireLegacyAdmin(ctx contractapi.TransactionContextInterface) error {
+	actor, err := actorOf(ctx)
+	if err != nil || actor.HospitalID != adminHospitalID {
+		return codedError(CodeForbidden, "", "", "operation requires admin privileges")
+	}
+	bytes, err := ctx.GetStub().GetState(adminHospitalID)
+	if err != nil || bytes == nil {
+		return codedError(CodeForbidden, "", "", "operation requires admin privileges")
+	}
+	var h Hospital
+	if err := json.Unmarshal(bytes, &h); err != nil || !h.IsActive {
+		return codedError(CodeForbidden, "", "", "operation requires admin privileges")
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// matchTransitions lists the statuses each match status may move to. A match is
+// created PENDING; COMPLETED is reached only once the transplant is recorded.
+var matchTransitions = map[string][]string{
+	"PENDING":  {"APPROVED", "REJECTED", "CANCELLED"},
+	"APPROVED": {"COMPLETED", "CANCELLED"},
+}
+
+// Reason codes recorded when a match is rejected or cancelled.
+const (
+	ReasonMedicalContraindication = "MEDICAL_CONTRAINDICATION"
+	ReasonOrganQuality            = "ORGAN_QUALITY"
+	ReasonPatientUnavailable      = "PATIENT_UNAVAILABLE"
+	ReasonLogistics               = "LOGISTICS"
+	ReasonConsentWithdrawn        = "CONSENT_WITHDRAWN"
+	ReasonPatientRemoved          = "PATIENT_REMOVED"
+	ReasonDonorWithdrawn          = "DONOR_WITHDRAWN"
+	ReasonOther                   = "OTHER"
+)
+
+// MatchReasonCodes are the reason codes a hospital may give when rejecting or
+// cancelling a match. OTHER must be accompanied by a free-text reason.
+var MatchReasonCodes = []string{
+	ReasonMedicalContraindication, ReasonOrganQuality, ReasonPatientUnavailable,
+	ReasonLogistics, ReasonConsentWithdrawn, ReasonOther,
+}
+
+func validateMatchReason(code, reason string) error {
+	if !containsString(MatchReasonCodes, code) {
+		return codedError(CodeInvalidReasonCode, "", "reasonCode", "unknown reason code %q; expected one of %s", code, strings.Join(MatchReasonCodes, ", "))
+	}
+	if code == ReasonOther && strings.TrimSpace(reason) == "" {
+		return codedError(CodeInvalidArgument, "", "reason", "reason code %s requires a reason", ReasonOther)
+	}
+	return nil
+}
+
+// transitionMatch moves a match to a new status, recording who moved it, when and why.
+func (s *SmartContract) transitionMatch(ctx contractapi.TransactionContextInterface, m *Match, to, hospitalId, reasonCode, reason string) error {
+	if !containsString(matchTransitions[m.Status], to) {
+		return codedError(CodeInvalidTransition, docTypeMatch, "", "match %s cannot move from %s to %s", m.ID, m.Status, to)
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	m.Status = to
+	m.ReasonCode, m.Reason = reasonCode, reason
+	m.StatusChangedBy, m.StatusChangedAt = hospitalId, ts
+	if to == "APPROVED" {
+		m.ApprovedBy, m.ApprovedAt = hospitalId, ts
+	}
+	return putState(ctx, m.ID, m)
+}
+
+// releaseMatch returns the organ held by a closed match to its donor and the patient
+// to the waitlist if they hold no other open match.
+func (s *SmartContract) releaseMatch(ctx contractapi.TransactionContextInterface, m *Match) error {
+	if _, err := s.restoreOrgan(ctx, m.DonorID, m.OrganType); err != nil {
+		return err
+	}
+	return returnToWaitlist(ctx, m.PatientID, m.ID)
+}
+
+// returnToWaitlist puts a MATCHED patient back on the waitlist once none of their
+// matches is still open. closing lists the matches the transaction is closing, which
+// the ledger still shows as open until it commits.
+func returnToWaitlist(ctx contractapi.TransactionContextInterface, patientId string, closing ...string) error {
+	p, err := findState[Patient](ctx, patientId)
+	if err != nil {
+		return err
+	}
+	if p == nil || p.Status != "MATCHED" {
+		return nil
+	}
+	open, err := matchesByIndex(ctx, indexMatchPatient, p.ID, func(m *Match) bool {
+		return !terminalMatchStatuses[m.Status] && !containsString(closing, m.ID)
+	})
+	if err != nil || len(open) > 0 {
+		return err
+	}
+	p.Status = "WAITING"
+	return putState(ctx, p.ID, p)
+}
+
+// matchForHospital loads a match for a hospital to act on and returns it with its
+// patient, which is nil if the patient record is gone, and the caller's hospital. The
+// caller's org must own the match, and the caller's hospital must be the patient's
+// hospital or the admin hospital.
+func (s *SmartContract) matchForHospital(ctx contractapi.TransactionContextInterface, matchId string) (*Match, *Patient, string, error) {
+	m, err := getState[Match](ctx, matchId)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := s.requireOwnerOrg(ctx, m.OwnerMSP); err != nil {
+		return nil, nil, "", err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	p, err := findState[Patient](ctx, m.PatientID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if hospitalId != adminHospitalID && (p == nil || p.HospitalID != hospitalId) {
+		return nil, nil, "", codedError(CodeForbidden, docTypeMatch, "", "match %s is for a patient of another hospital; %s may not act on it", m.ID, hospitalId)
+	}
+	return m, p, hospitalId, nil
+}
+
+// ApproveMatch confirms a pending match on behalf of a hospital. The organ stays
+// reserved and the patient MATCHED until the transplant is recorded. expectedVersion
+// is the match version the caller last read; see requireVersion.
+func (s *SmartContract) ApproveMatch(ctx contractapi.TransactionContextInterface, matchId string, expectedVersion int) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	m, p, hospitalId, err := s.matchForHospital(ctx, matchId)
+	if err != nil {
+		return wrapError(err, "cannot approve match")
+	}
+	if err := requireVersion("match", m.ID, m.Version, expectedVersion); err != nil {
+		return err
+	}
+	if p == nil {
+		return wrapError(notFound(docTypePatient, m.PatientID), "cannot approve match "+matchId)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.requireViableOrgan(ctx, cfg, m.DonorID, m.OrganType); err != nil {
+		return wrapError(err, "cannot approve match "+matchId)
+	}
+
+	if err := s.transitionMatch(ctx, m, "APPROVED", hospitalId, "", ""); err != nil {
+		return err
+	}
+	if p.Status != "MATCHED" {
+		p.Status = "MATCHED"
+		if err := putState(ctx, p.ID, p); err != nil {
+			return err
+		}
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventMatchApproved, map[string]string{
+		"matchId": m.ID, "patientId": m.PatientID, "donorId": m.DonorID, "hospitalId": hospitalId,
+		"hl7": hl7MatchApproved(m, hospitalId, ctx.GetStub().GetTxID(), *now),
+	})
+}
+
+// RejectMatch declines a pending match, returning the organ to the donor and the patient to the waitlist.
+func (s *SmartContract) RejectMatch(ctx contractapi.TransactionContextInterface, matchId, reasonCode, reason string, expectedVersion int) error {
+	return s.closeMatch(ctx, matchId, "REJECTED", reasonCode, reason, EventMatchRejected, expectedVersion)
+}
+
+// CancelMatch withdraws a pending or approved match, e.g. when the patient becomes
+// unavailable after approval. The organ and patient are released as for a rejection.
+func (s *SmartContract) CancelMatch(ctx contractapi.TransactionContextInterface, matchId, reasonCode, reason string, expectedVersion int) error {
+	return s.closeMatch(ctx, matchId, "CANCELLED", reasonCode, reason, EventMatchCancelled, expectedVersion)
+}
+
+func (s *SmartContract) closeMatch(ctx contractapi.TransactionContextInterface, matchId, to, reasonCode, reason, event string, expectedVersion int) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	m, _, hospitalId, err := s.matchForHospital(ctx, matchId)
+	if err != nil {
+		return wrapError(err, "cannot close match")
+	}
+	if err := requireVersion("match", m.ID, m.Version, expectedVersion); err != nil {
+		return err
+	}
+	if err := validateMatchReason(reasonCode, reason); err != nil {
+		return err
+	}
+
+	if err := s.transitionMatch(ctx, m, to, hospitalId, reasonCode, reason); err != nil {
+		return err
+	}
+	if err := s.releaseMatch(ctx, m); err != nil {
+		return err
+	}
+	return emitEvent(ctx, event, map[string]string{
+		"matchId": m.ID, "patientId": m.PatientID, "donorId": m.DonorID, "hospitalId": hospitalId,
+		"reasonCode": reasonCode, "reason": reason,
+	})
+}
+
+// ConfirmTransplant closes an approved match and records the transplant under
+// TRANS-<matchId>. The match, patient and donor are all updated in the same
+// transaction, so either the whole transplant is recorded or none of it is. The
+// latest final crossmatch recorded on the match must be negative.
+func (s *SmartContract) ConfirmTransplant(ctx contractapi.TransactionContextInterface, matchId, surgeon, transplantDate string, coldIschemiaMinutes int) (*Transplant, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	m, p, hospitalId, err := s.matchForHospital(ctx, matchId)
+	if err != nil {
+		return nil, wrapError(err, "cannot confirm transplant")
+	}
+	if strings.TrimSpace(surgeon) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "surgeon", "a surgeon is required")
+	}
+	if err := requireNegativeCrossmatch(m); err != nil {
+		return nil, wrapError(err, "cannot confirm transplant")
+	}
+	if coldIschemiaMinutes < 0 {
+		return nil, codedError(CodeInvalidArgument, "", "coldIschemiaMinutes", "cold ischemia time cannot be negative")
+	}
+	performed, err := parseTimestamp(transplantDate)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if performed.After(*now) {
+		return nil, codedError(CodeInvalidArgument, "", "transplantDate", "transplant date %s is in the future", transplantDate)
+	}
+	if p == nil {
+		return nil, wrapError(notFound(docTypePatient, m.PatientID), "cannot confirm transplant for match "+matchId)
+	}
+	id := "TRANS-" + matchId
+	if exists, _ := s.RecordExists(ctx, id); exists {
+		return nil, codedError(CodeAlreadyExists, docTypeTransplant, "", "transplant %s already exists", id)
+	}
+
+	if err := s.transitionMatch(ctx, m, "COMPLETED", hospitalId, "", ""); err != nil {
+		return nil, err
+	}
+	p.Status = "TRANSPLANTED"
+	p.TransferRequired = false
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	if err := s.setOrganStatus(ctx, m.DonorID, m.OrganType, OrganTransplanted, m.ID, hospitalId); err != nil {
+		return nil, err
+	}
+	// CreateMatch reserves the organ; matches recorded before it did still list it.
+	d, err := findState[Donor](ctx, m.DonorID)
+	if err != nil {
+		return nil, err
+	}
+	if d != nil && removeOrgan(d, m.OrganType) {
+		if err := putState(ctx, d.ID, d); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Transplant{
+		ID: id, MatchID: m.ID, PatientID: m.PatientID, DonorID: m.DonorID, OrganType: m.OrganType,
+		HospitalID: hospitalId, DocType: docTypeTransplant, CreatedAt: m.StatusChangedAt,
+		Surgeon: surgeon, TransplantDate: performed.Format(time.RFC3339), ColdIschemiaMinutes: coldIschemiaMinutes,
+	}
+	if err := putState(ctx, id, t); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventTransplantCompleted, map[string]string{
+		"transplantId": id, "matchId": m.ID, "patientId": m.PatientID, "donorId": m.DonorID,
+		"organType": m.OrganType, "hospitalId": hospitalId,
+		"hl7": hl7TransplantCompleted(t, performed, ctx.GetStub().GetTxID(), *now),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxOfferMinutes caps how long a hospital may hold an organ offer open.
+const maxOfferMinutes = 24 * 60
+
+// Offer is an organ offered to the best-ranked waiting patient's hospital. While it is
+// PENDING the organ is reserved for that patient; a declined or expired offer passes
+// the organ to the next ranked candidate. An offer is CANCELLED, and the organ
+// discarded, if the donor withdraws consent while it is open.
+type Offer struct {
+	ID            string `json:"id"`
+	OrganID       string `json:"organId"`
+	DonorID       string `json:"donorId"`
+	OrganType     string `json:"organType"`
+	PatientID     string `json:"patientId"`
+	HospitalID    string `json:"hospitalId"`
+	Rank          int    `json:"rank"`
+	HLAScore      int    `json:"hlaScore"`
+	Status        string `json:"status"`
+	ExpiresAt     string `json:"expiresAt"`
+	OfferedBy     string `json:"offeredBy"`
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	CreatedAt     string `json:"createdAt"`
+	RespondedBy   string `json:"respondedBy,omitempty" metadata:",optional"`
+	RespondedAt   string `json:"respondedAt,omitempty" metadata:",optional"`
+	ReasonCode    string `json:"reasonCode,omitempty" metadata:",optional"`
+	Reason        string `json:"reason,omitempty" metadata:",optional"`
+	MatchID       string `json:"matchId,omitempty" metadata:",optional"`
+}
+
+// OfferOrgan offers one of a donor's available organs to the hospital of the
+// best-ranked waiting patient. The offer lapses expiryMinutes after it is made.
+func (s *SmartContract) OfferOrgan(ctx contractapi.TransactionContextInterface, donorId, organType string, expiryMinutes int) (*Offer, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	offeredBy, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot offer organ")
+	}
+	if expiryMinutes <= 0 || expiryMinutes > maxOfferMinutes {
+		return nil, codedError(CodeInvalidArgument, "", "expiryMinutes", "offer expiry must be between 1 and %d minutes", maxOfferMinutes)
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if d.VerificationStatus != "VERIFIED" {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is not verified (status %s)", d.ID, d.VerificationStatus)
+	}
+	if !containsString(d.OrgansAvailable, organType) {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "organ %s not available from donor %s", organType, d.ID)
+	}
+	if d.DonorType == DonorLiving {
+		return nil, codedError(CodeInvalidArgument, docTypeDonor, "donorId", "donor %s is a living donor; living donations are matched directly or through paired exchange", d.ID)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireViableOrgan(ctx, cfg, d.ID, organType); err != nil {
+		return nil, err
+	}
+
+	offer, err := s.nextOffer(ctx, cfg, d, organType, offeredBy, time.Duration(expiryMinutes)*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if offer == nil {
+		return nil, codedError(CodeIncompatible, docTypeOffer, "", "no eligible candidate for %s from donor %s", organType, d.ID)
+	}
+	removeOrgan(d, organType)
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	o, err := s.transitionOrgan(ctx, d.ID, organType, OrganReserved, "", offeredBy)
+	if err != nil {
+		return nil, err
+	}
+	o.OfferID = offer.ID
+	if err := putState(ctx, o.ID, o); err != nil {
+		return nil, err
+	}
+	if err := emitEvent(ctx, EventOfferCreated, offer); err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// nextOffer writes an offer to the best-ranked candidate who has not yet been offered
+// this organ, or returns nil if there is none.
+func (s *SmartContract) nextOffer(ctx contractapi.TransactionContextInterface, cfg *PolicyConfig, d *Donor, organType, offeredBy string, expiry time.Duration) (*Offer, error) {
+	offers, err := s.GetOffersForOrgan(ctx, organID(d.ID, organType))
+	if err != nil {
+		return nil, err
+	}
+	offered := map[string]bool{}
+	for _, o := range offers {
+		offered[o.PatientID] = true
+	}
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rank against the organ itself, which has left the donor's available list
+	// while it is under offer.
+	candidateDonor := *d
+	candidateDonor.OrgansAvailable = []string{organType}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range s.rankCandidates(cfg, &candidateDonor, organType, patients, *now) {
+		if offered[c.PatientID] {
+			continue
+		}
+		offer := &Offer{
+			ID: "OFFER-" + ctx.GetStub().GetTxID(), OrganID: organID(d.ID, organType), DonorID: d.ID, OrganType: organType,
+			PatientID: c.PatientID, HospitalID: c.HospitalID, Rank: c.Rank, HLAScore: c.HLAScore,
+			Status: "PENDING", ExpiresAt: now.Add(expiry).Format(time.RFC3339), OfferedBy: offeredBy,
+			DocType: docTypeOffer, CreatedAt: now.Format(time.RFC3339),
+		}
+		return offer, putState(ctx, offer.ID, offer)
+	}
+	return nil, nil
+}
+
+// advanceOffer passes the organ of a declined or expired offer to the next candidate,
+// with the same time to respond. With no candidates left the organ is available again.
+func (s *SmartContract) advanceOffer(ctx contractapi.TransactionContextInterface, prev *Offer) (*Offer, error) {
+	d, err := findState[Donor](ctx, prev.DonorID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expiry := time.Duration(maxOfferMinutes) * time.Minute
+	created, errC := parseTimestamp(prev.CreatedAt)
+	expires, errE := parseTimestamp(prev.ExpiresAt)
+	if errC == nil && errE == nil {
+		expiry = expires.Sub(created)
+	}
+
+	var next *Offer
+	if d.VerificationStatus == "VERIFIED" && s.requireViableOrgan(ctx, cfg, d.ID, prev.OrganType) == nil {
+		if next, err = s.nextOffer(ctx, cfg, d, prev.OrganType, prev.OfferedBy, expiry); err != nil {
+			return nil, err
+		}
+	}
+	if next == nil {
+		_, err := s.restoreOrgan(ctx, d.ID, prev.OrganType)
+		return nil, err
+	}
+	o, err := getState[Organ](ctx, prev.OrganID)
+	if err != nil {
+		return nil, err
+	}
+	o.OfferID = next.ID
+	return next, putState(ctx, o.ID, o)
+}
+
+// pendingOffer loads an offer that is still awaiting a response.
+func pendingOffer(ctx contractapi.TransactionContextInterface, offerId string) (*Offer, error) {
+	offer, err := getState[Offer](ctx, offerId)
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status != "PENDING" {
+		return nil, codedError(CodeInvalidTransition, docTypeOffer, "", "offer %s is already %s", offerId, offer.Status)
+	}
+	return offer, nil
+}
+
+func offerExpired(offer *Offer, now time.Time) bool {
+	expires, err := parseTimestamp(offer.ExpiresAt)
+	return err != nil || now.After(expires)
+}
+
+// AcceptOffer accepts an organ offer on behalf of the patient's hospital and records an
+// approved match for it.
+func (s *SmartContract) AcceptOffer(ctx contractapi.TransactionContextInterface, offerId string) (*Match, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	offer, err := pendingOffer(ctx, offerId)
+	if err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot accept offer")
+	}
+	if hospitalId != offer.HospitalID {
+		return nil, codedError(CodeForbidden, docTypeOffer, "", "offer %s was made to hospital %s", offerId, offer.HospitalID)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if offerExpired(offer, *now) {
+		return nil, codedError(CodeInvalidTransition, docTypeOffer, "", "offer %s expired at %s", offerId, offer.ExpiresAt)
+	}
+	p, err := getState[Patient](ctx, offer.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != "WAITING" {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is no longer waiting (status %s)", p.ID, p.Status)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireViableOrgan(ctx, cfg, offer.DonorID, offer.OrganType); err != nil {
+		return nil, err
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts := now.Format(time.RFC3339)
+
+	m := &Match{
+		ID: "MATCH-" + ctx.GetStub().GetTxID(), PatientID: p.ID, DonorID: offer.DonorID, OrganType: offer.OrganType,
+		HLAScore: strconv.Itoa(offer.HLAScore), Status: "APPROVED", DocType: docTypeMatch, CreatedAt: ts,
+		ApprovedBy: hospitalId, ApprovedAt: ts, OwnerMSP: owner, OrganID: offer.OrganID,
+		StatusChangedBy: hospitalId, StatusChangedAt: ts,
+	}
+	if err := putState(ctx, m.ID, m); err != nil {
+		return nil, err
+	}
+	p.Status = "MATCHED"
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	o, err := getState[Organ](ctx, offer.OrganID)
+	if err != nil {
+		return nil, err
+	}
+	o.MatchID, o.OfferID, o.UpdatedAt, o.UpdatedBy = m.ID, "", ts, hospitalId
+	if err := putState(ctx, o.ID, o); err != nil {
+		return nil, err
+	}
+	offer.Status, offer.RespondedBy, offer.RespondedAt, offer.MatchID = "ACCEPTED", hospitalId, ts, m.ID
+	if err := putState(ctx, offer.ID, offer); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventOfferAccepted, map[string]string{
+		"offerId": offer.ID, "matchId": m.ID, "patientId": p.ID, "donorId": offer.DonorID, "organType": offer.OrganType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DeclineOffer declines an organ offer with a reason code and offers the organ to the
+// next ranked candidate. It returns that next offer, or nil if the organ went back to
+// the donor's available list.
+func (s *SmartContract) DeclineOffer(ctx contractapi.TransactionContextInterface, offerId, reasonCode, reason string) (*Offer, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	offer, err := pendingOffer(ctx, offerId)
+	if err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot decline offer")
+	}
+	if hospitalId != offer.HospitalID {
+		return nil, codedError(CodeForbidden, docTypeOffer, "", "offer %s was made to hospital %s", offerId, offer.HospitalID)
+	}
+	if err := validateMatchReason(reasonCode, reason); err != nil {
+		return nil, err
+	}
+	return s.closeOffer(ctx, offer, "DECLINED", hospitalId, reasonCode, reason, EventOfferDeclined)
+}
+
+// ExpireOffer closes an offer whose response window has passed and moves the organ on.
+// Chaincode has no timers, so any hospital may call it once the offer has expired.
+func (s *SmartContract) ExpireOffer(ctx contractapi.TransactionContextInterface, offerId string) (*Offer, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	offer, err := pendingOffer(ctx, offerId)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !offerExpired(offer, *now) {
+		return nil, codedError(CodeInvalidTransition, docTypeOffer, "", "offer %s does not expire until %s", offerId, offer.ExpiresAt)
+	}
+	return s.closeOffer(ctx, offer, "EXPIRED", "", "", "", EventOfferExpired)
+}
+
+func (s *SmartContract) closeOffer(ctx contractapi.TransactionContextInterface, offer *Offer, status, hospitalId, reasonCode, reason, event string) (*Offer, error) {
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	offer.Status, offer.RespondedBy, offer.RespondedAt = status, hospitalId, ts
+	offer.ReasonCode, offer.Reason = reasonCode, reason
+	if err := putState(ctx, offer.ID, offer); err != nil {
+		return nil, err
+	}
+	next, err := s.advanceOffer(ctx, offer)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]string{"offerId": offer.ID, "organId": offer.OrganID, "patientId": offer.PatientID, "reasonCode": reasonCode}
+	if next != nil {
+		payload["nextOfferId"], payload["nextPatientId"] = next.ID, next.PatientID
+	}
+	if err := emitEvent(ctx, event, payload); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (s *SmartContract) GetOffer(ctx contractapi.TransactionContextInterface, id string) (*Offer, error) {
+	return getState[Offer](ctx, id)
+}
+
+// GetOffersForOrgan returns every offer made for an organ, oldest first.
+func (s *SmartContract) GetOffersForOrgan(ctx contractapi.TransactionContextInterface, organId string) ([]*Offer, error) {
+	all, err := queryPopulate[Offer](ctx)
+	if err != nil {
+		return nil, err
+	}
+	offers := []*Offer{}
+	for _, o := range all {
+		if o.OrganID == organId {
+			offers = append(offers, o)
+		}
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		return compareByCreatedAt(offers[i].CreatedAt, offers[j].CreatedAt) < 0
+	})
+	return offers, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const accessConfigKey = "ACCESS-CONFIG"
+
+// AccessConfig is the on-chain allow-list of organizations. Hospital MSPs may write
+// patient, donor and match records; admin MSPs may also seed, clear and reconfigure
+// the ledger.
+type AccessConfig struct {
+	HospitalMSPs  []string `json:"hospitalMsps"`
+	AdminMSPs     []string `json:"adminMsps"`
+	DocType       string   `json:"docType"`
+	SchemaVersion int      `json:"schemaVersion"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+func defaultAccessConfig() *AccessConfig {
+	return &AccessConfig{
+		HospitalMSPs: []string{"Org1MSP", "Org2MSP"},
+		AdminMSPs:    []string{"Org1MSP"},
+		DocType:      "access",
+	}
+}
+
+func (s *SmartContract) GetAccessConfig(ctx contractapi.TransactionContextInterface) (*AccessConfig, error) {
+	cfg, err := findState[AccessConfig](ctx, accessConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return defaultAccessConfig(), nil
+	}
+	return cfg, nil
+}
+
+// SetAccessConfig replaces both MSP allow-lists. The caller's own org must remain an
+// admin MSP so the network cannot lock itself out.
+func (s *SmartContract) SetAccessConfig(ctx contractapi.TransactionContextInterface, hospitalMSPsJSON, adminMSPsJSON string) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	cfg, err := s.GetAccessConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(hospitalMSPsJSON), &cfg.HospitalMSPs); err != nil {
+		return codedError(CodeInvalidArgument, "", "hospitalMsps", "hospital MSPs must be a JSON array: %v", err)
+	}
+	if err := json.Unmarshal([]byte(adminMSPsJSON), &cfg.AdminMSPs); err != nil {
+		return codedError(CodeInvalidArgument, "", "adminMsps", "admin MSPs must be a JSON array: %v", err)
+	}
+	if cfg.HospitalMSPs == nil {
+		cfg.HospitalMSPs = []string{}
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if !containsString(cfg.AdminMSPs, mspID) {
+		return codedError(CodeInvalidArgument, "", "adminMsps", "admin MSPs must include the caller's org %s", mspID)
+	}
+	if cfg.UpdatedAt, err = s.getTimestamp(ctx); err != nil {
+		return err
+	}
+	return putState(ctx, accessConfigKey, cfg)
+}
+
+func callerMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// requireOrg returns the caller's MSP ID if it is on one of the allow-lists.
+func (s *SmartContract) requireOrg(ctx contractapi.TransactionContextInterface, lists ...func(*AccessConfig) []string) (string, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := s.GetAccessConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, list := range lists {
+		if containsString(list(cfg), mspID) {
+			return mspID, nil
+		}
+	}
+	return "", codedError(CodeForbidden, "", "", "org %s is not permitted to call this function", mspID)
+}
+
+func hospitalMSPs(cfg *AccessConfig) []string { return cfg.HospitalMSPs }
+func adminMSPs(cfg *AccessConfig) []string    { return cfg.AdminMSPs }
+
+// requireNetworkAdmin admits admin-role callers from an admin MSP.
+func (s *SmartContract) requireNetworkAdmin(ctx contractapi.TransactionContextInterface) error {
+	if err := requireRole(ctx, RoleAdmin); err != nil {
+		return err
+	}
+	_, err := s.requireOrg(ctx, adminMSPs)
+	return err
+}
+
+// devNetworkEnv must be "true" in the chaincode's environment for the functions that
+// seed sample data or wipe the ledger to run. Production deployments leave it unset.
+const devNetworkEnv = "ORGANCHAIN_DEV_NETWORK"
+
+// requireDevNetwork fails unless the chaincode runs on a dev or test network.
+func requireDevNetwork() error {
+	if os.Getenv(devNetworkEnv) != "true" {
+		return codedError(CodeForbidden, "", "", "this function is only available on dev/test networks; set %s=true in the chaincode environment", devNetworkEnv)
+	}
+	return nil
+}
+
+// requireHospitalWriter admits hospital- or admin-role callers from a hospital or admin MSP.
+func (s *SmartContract) requireHospitalWriter(ctx contractapi.TransactionContextInterface) error {
+	if err := requireRole(ctx, RoleHospital, RoleAdmin); err != nil {
+		return err
+	}
+	_, err := s.requireOrg(ctx, hospitalMSPs, adminMSPs)
+	return err
+}
+
+// requirePhysician admits physician-role callers from a hospital MSP.
+func (s *SmartContract) requirePhysician(ctx contractapi.TransactionContextInterface) error {
+	if err := requireRole(ctx, RolePhysician); err != nil {
+		return err
+	}
+	_, err := s.requireOrg(ctx, hospitalMSPs)
+	return err
+}
+
+// requireOwnerOrg lets only the org that created a record change it. Admin MSPs may
+// change any record, and records written before ownership was tracked are open.
+func (s *SmartContract) requireOwnerOrg(ctx contractapi.TransactionContextInterface, ownerMSP string) error {
+	if ownerMSP == "" {
+		return nil
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID == ownerMSP {
+		return nil
+	}
+	if _, err := s.requireOrg(ctx, adminMSPs); err != nil {
+		return codedError(CodeForbidden, "", "", "record belongs to org %s; org %s may not change it", ownerMSP, mspID)
+	}
+	return nil
+}
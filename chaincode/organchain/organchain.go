@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -21,89 +26,452 @@ var BloodCompatibilityMap = map[string][]string{
 	"AB+": {"AB+", "AB-", "A+", "A-", "B+", "B-", "O+", "O-"},
 }
 
+// Organs lists the organ names accepted on the ledger.
+var Organs = []string{"Kidney", "Liver", "Heart", "Lung", "Pancreas", "Intestine", "Cornea"}
+
+// UrgencyTiers ranks patient urgency levels; a lower value is allocated first.
+// STATUS_1A patients are in intensive care with a life expectancy of days,
+// STATUS_1B patients are hospitalised or device-dependent, and everyone else is ROUTINE.
+var UrgencyTiers = map[string]int{"STATUS_1A": 0, "STATUS_1B": 1, "ROUTINE": 2}
+
+// legacyUrgency maps the urgency levels used before status tiers to their tier.
+var legacyUrgency = map[string]string{"CRITICAL": "STATUS_1A", "URGENT": "STATUS_1B"}
+
+// BloodTypes lists the eight valid ABO/Rh blood types.
+var BloodTypes = []string{"O-", "O+", "A-", "A+", "B-", "B+", "AB-", "AB+"}
+
 // SmartContract provides functions for managing patients and donors
 type SmartContract struct {
 	contractapi.Contract
 }
 
+const (
+	adminHospitalID = "HOSP-ADMIN"
+
+	// donorPIICollection must match the name in collections_config.json.
+	donorPIICollection   = "donorPII"
+	donorPIITransientKey = "donor_pii"
+)
+
+// terminalMatchStatuses are match states that no longer hold an organ.
+var terminalMatchStatuses = map[string]bool{"REJECTED": true, "CANCELLED": true, "COMPLETED": true}
+
 // --- MODELS ---
 
 type Patient struct {
+	ID       string `json:"id"`
+	NameHash string `json:"nameHash"`
+	// IdentityHash is a keyed hash of the patient's national ID, hashed as a donor's
+	// NationalIDHash is. It links one person's listings at different hospitals; see
+	// DetectMultiListings.
+	IdentityHash  string    `json:"identityHash,omitempty" metadata:",optional"`
+	BloodType     string    `json:"bloodType"`
+	HLA           HLATyping `json:"hla"`
+	OrganNeeded   string    `json:"organNeeded"`
+	IPFSHash      string    `json:"ipfsHash"`
+	Status        string    `json:"status"`
+	Urgency       string    `json:"urgency"`
+	HospitalID    string    `json:"hospitalId"`
+	OwnerMSP      string    `json:"ownerMsp"`
+	DocType       string    `json:"docType"`
+	SchemaVersion int       `json:"schemaVersion"`
+	CreatedAt     string    `json:"createdAt"`
+	// UrgencyReason, UrgencyChangedBy and UrgencyChangedAt record the last SetPatientUrgency call.
+	UrgencyReason    string `json:"urgencyReason,omitempty" metadata:",optional"`
+	UrgencyChangedBy string `json:"urgencyChangedBy,omitempty" metadata:",optional"`
+	UrgencyChangedAt string `json:"urgencyChangedAt,omitempty" metadata:",optional"`
+	// Escalations lists the patient's emergency escalations, oldest first; see
+	// EscalatePatient.
+	Escalations []*PatientEscalation `json:"escalations,omitempty" metadata:",optional"`
+	// ScoreType and ClinicalScore hold a liver patient's current MELD/PELD score.
+	ScoreType      string `json:"scoreType,omitempty" metadata:",optional"`
+	ClinicalScore  int    `json:"clinicalScore"`
+	ScoreUpdatedAt string `json:"scoreUpdatedAt,omitempty" metadata:",optional"`
+	// InactiveSince and InactiveReason are set while the patient is INACTIVE.
+	// InactiveSeconds totals earlier inactive periods, which do not count as waiting time.
+	InactiveSince   string `json:"inactiveSince,omitempty" metadata:",optional"`
+	InactiveReason  string `json:"inactiveReason,omitempty" metadata:",optional"`
+	InactiveSeconds int64  `json:"inactiveSeconds"`
+	// CPRA is the calculated panel-reactive antibody percentage. Donors carrying any of
+	// the UnacceptableAntigens are excluded from matching for this patient.
+	CPRA                   int      `json:"cpra"`
+	UnacceptableAntigens   []string `json:"unacceptableAntigens,omitempty" metadata:",optional"`
+	SensitizationUpdatedAt string   `json:"sensitizationUpdatedAt,omitempty" metadata:",optional"`
+	// TransferRequired marks a waiting patient whose hospital was deactivated.
+	TransferRequired bool `json:"transferRequired"`
+	// PendingTransfer is a transfer awaiting the receiving hospital; Transfers are
+	// the completed ones, oldest first. See InitiateTransfer.
+	PendingTransfer *PatientTransfer   `json:"pendingTransfer,omitempty" metadata:",optional"`
+	Transfers       []*PatientTransfer `json:"transfers,omitempty" metadata:",optional"`
+	// ChangeLog lists the corrections made with UpdatePatient, oldest first.
+	ChangeLog []*PatientChange `json:"changeLog,omitempty" metadata:",optional"`
+	// Removal is set once the patient is taken off the waitlist; see
+	// RemovePatientFromWaitlist.
+	Removal *PatientRemoval `json:"removal,omitempty" metadata:",optional"`
+	// ArchivedAt, ArchivedBy and ArchiveReason are set when the status is ARCHIVED.
+	ArchivedAt    string `json:"archivedAt,omitempty" metadata:",optional"`
+	ArchivedBy    string `json:"archivedBy,omitempty" metadata:",optional"`
+	ArchiveReason string `json:"archiveReason,omitempty" metadata:",optional"`
+	// Version counts writes to the record; see requireVersion.
+	Version int `json:"version"`
+}
+
+// Donor is the public donor record. Name and contact details live in DonorPrivate.
+type Donor struct {
+	ID              string    `json:"id"`
+	BloodType       string    `json:"bloodType"`
+	HLA             HLATyping `json:"hla"`
+	OrgansAvailable []string  `json:"organsAvailable"`
+	IPFSHash        string    `json:"ipfsHash"`
+	ConsentHash     string    `json:"consentHash"`
+	// Consents holds every signed version of the consent document, oldest first;
+	// ConsentHash is the latest version's document hash.
+	Consents []*ConsentVersion `json:"consents,omitempty" metadata:",optional"`
+	// ResearchConsent is set while the donor agrees to their de-identified data being
+	// shared for research; see ExportResearchDataset.
+	ResearchConsent bool   `json:"researchConsent"`
+	PIIHash         string `json:"piiHash"`
+	// ContactUpdatedAt and ContactUpdatedBy record the last UpdateDonorContact call;
+	// ContactUpdatedBy is DONOR for a change the donor signed, HOSPITAL otherwise.
+	ContactUpdatedAt string `json:"contactUpdatedAt,omitempty" metadata:",optional"`
+	ContactUpdatedBy string `json:"contactUpdatedBy,omitempty" metadata:",optional"`
+	// NationalIDHash is a keyed hash of the donor's national ID, never the ID itself. No
+	// two active donors may share one; see requireUniqueNationalID.
+	NationalIDHash     string `json:"nationalIdHash,omitempty" metadata:",optional"`
+	VerificationStatus string `json:"verificationStatus"`
+	VerifiedBy         string `json:"verifiedBy"`
+	VerifiedAt         string `json:"verifiedAt"`
+	OwnerMSP           string `json:"ownerMsp"`
+	DocType            string `json:"docType"`
+	SchemaVersion      int    `json:"schemaVersion"`
+	CreatedAt          string `json:"createdAt"`
+	// ScreeningCleared is set once every mandatory infectious disease screen is
+	// negative or flagged; see SerologyPanel.
+	ScreeningCleared bool `json:"screeningCleared"`
+	// DonorType is LIVING, DBD or DCD; the remaining fields depend on it.
+	DonorType           string `json:"donorType,omitempty" metadata:",optional"`
+	Relationship        string `json:"relationship,omitempty" metadata:",optional"`
+	IntendedRecipientID string `json:"intendedRecipientId,omitempty" metadata:",optional"`
+	DirectedByMSP       string `json:"directedByMsp,omitempty" metadata:",optional"`
+	DirectedAt          string `json:"directedAt,omitempty" metadata:",optional"`
+	BrainDeathAt        string `json:"brainDeathAt,omitempty" metadata:",optional"`
+	CirculatoryDeathAt  string `json:"circulatoryDeathAt,omitempty" metadata:",optional"`
+	WarmIschemiaMinutes int    `json:"warmIschemiaMinutes,omitempty" metadata:",optional"`
+	// DeathConfirmed is set once two physicians have attested a deceased donor's
+	// death; see DeathDeclaration.
+	DeathConfirmed bool `json:"deathConfirmed"`
+	// ConsentWithdrawnAt is set when the donor leaves matching. RevocationSignatureHash,
+	// the consentRevocationHash the donor signed, and RevocationSignature are only
+	// present when the donor signed the revocation themselves.
+	ConsentWithdrawnAt      string `json:"consentWithdrawnAt,omitempty" metadata:",optional"`
+	ConsentWithdrawnBy      string `json:"consentWithdrawnBy,omitempty" metadata:",optional"`
+	RevocationSignatureHash string `json:"revocationSignatureHash,omitempty" metadata:",optional"`
+	RevocationSignature     string `json:"revocationSignature,omitempty" metadata:",optional"`
+	// Withdrawal is set when the donor is made INACTIVE; see WithdrawDonor.
+	Withdrawal *DonorWithdrawal `json:"withdrawal,omitempty" metadata:",optional"`
+	// PublicKeyPEM is the key, or a certificate holding it, that the donor signs consent
+	// documents with; PublicKeyID is the SHA-256 of its DER encoding.
+	PublicKeyPEM string `json:"publicKeyPem,omitempty" metadata:",optional"`
+	PublicKeyID  string `json:"publicKeyId,omitempty" metadata:",optional"`
+	// PIIStatus is ERASED once PurgeDonorPII has removed the donor's private data.
+	PIIStatus   string `json:"piiStatus,omitempty" metadata:",optional"`
+	PIIErasedAt string `json:"piiErasedAt,omitempty" metadata:",optional"`
+	PIIErasedBy string `json:"piiErasedBy,omitempty" metadata:",optional"`
+	// ArchivedAt, ArchivedBy and ArchiveReason are set when the status is ARCHIVED.
+	ArchivedAt    string `json:"archivedAt,omitempty" metadata:",optional"`
+	ArchivedBy    string `json:"archivedBy,omitempty" metadata:",optional"`
+	ArchiveReason string `json:"archiveReason,omitempty" metadata:",optional"`
+	// Version counts writes to the record; see requireVersion.
+	Version int `json:"version"`
+}
+
+// DonorPrivate holds donor PII, stored only in the donorPII private data collection.
+// Email and phone are stored sealed in Contact and only filled in for callers that
+// supply the key; see SealedContact.
+type DonorPrivate struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Email   string         `json:"email"`
+	Phone   string         `json:"phone"`
+	Contact *SealedContact `json:"contact,omitempty" metadata:",optional"`
+	DocType string         `json:"docType"`
+}
+
+type Match struct {
+	ID              string `json:"id"`
+	PatientID       string `json:"patientId"`
+	DonorID         string `json:"donorId"`
+	OrganType       string `json:"organType"`
+	HLAScore        string `json:"hlaScore"`
+	EpletLoad       int    `json:"epletLoad"`
+	Status          string `json:"status"`
+	DocType         string `json:"docType"`
+	SchemaVersion   int    `json:"schemaVersion"`
+	CreatedAt       string `json:"createdAt"`
+	ApprovedBy      string `json:"approvedBy"`
+	Reason          string `json:"reason"`
+	OwnerMSP        string `json:"ownerMsp"`
+	OrganID         string `json:"organId,omitempty" metadata:",optional"`
+	ReasonCode      string `json:"reasonCode,omitempty" metadata:",optional"`
+	ApprovedAt      string `json:"approvedAt,omitempty" metadata:",optional"`
+	StatusChangedBy string `json:"statusChangedBy,omitempty" metadata:",optional"`
+	StatusChangedAt string `json:"statusChangedAt,omitempty" metadata:",optional"`
+	// Crossmatches holds every crossmatch result recorded for the match, oldest first.
+	Crossmatches []*CrossmatchResult `json:"crossmatches,omitempty" metadata:",optional"`
+	// Version counts writes to the record; see requireVersion.
+	Version int `json:"version"`
+}
+
+type Hospital struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	PasswordHash       string `json:"passwordHash"`
+	Location           string `json:"location"`
+	DocType            string `json:"docType"`
+	SchemaVersion      int    `json:"schemaVersion"`
+	CreatedAt          string `json:"createdAt"`
+	IsActive           bool   `json:"isActive"`
+	OwnerMSP           string `json:"ownerMsp"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+	ResetTokenHash     string `json:"resetTokenHash,omitempty" metadata:",optional"`
+	StatusReason       string `json:"statusReason,omitempty" metadata:",optional"`
+	StatusChangedBy    string `json:"statusChangedBy,omitempty" metadata:",optional"`
+	StatusChangedAt    string `json:"statusChangedAt,omitempty" metadata:",optional"`
+}
+
+type Transplant struct {
+	ID                  string `json:"id"`
+	MatchID             string `json:"matchId"`
+	PatientID           string `json:"patientId"`
+	DonorID             string `json:"donorId"`
+	OrganType           string `json:"organType"`
+	HospitalID          string `json:"hospitalId"`
+	DocType             string `json:"docType"`
+	SchemaVersion       int    `json:"schemaVersion"`
+	CreatedAt           string `json:"createdAt"`
+	Surgeon             string `json:"surgeon"`
+	TransplantDate      string `json:"transplantDate"`
+	ColdIschemiaMinutes int    `json:"coldIschemiaMinutes"`
+	// RegistryBatchID is the national registry submission that reported the transplant.
+	RegistryBatchID string `json:"registryBatchId,omitempty" metadata:",optional"`
+}
+
+// --- VIEWS ---
+
+// PatientSummary is a patient record without identifying references, safe to hand to auditors.
+type PatientSummary struct {
 	ID          string `json:"id"`
-	NameHash    string `json:"nameHash"`
 	BloodType   string `json:"bloodType"`
-	HLA         string `json:"hla"`
 	OrganNeeded string `json:"organNeeded"`
-	IPFSHash    string `json:"ipfsHash"`
 	Status      string `json:"status"`
 	HospitalID  string `json:"hospitalId"`
-	DocType     string `json:"docType"`
-	CreatedAt   string `json:"createdAt"`
 }
 
-type Donor struct {
-	ID                 string   `json:"id"`
-	Name               string   `json:"name"`
-	Email              string   `json:"email"`
-	Phone              string   `json:"phone"`
-	BloodType          string   `json:"bloodType"`
-	HLA                string   `json:"hla"`
-	OrgansAvailable    []string `json:"organsAvailable"`
-	IPFSHash           string   `json:"ipfsHash"`
-	ConsentHash        string   `json:"consentHash"`
-	VerificationStatus string   `json:"verificationStatus"`
-	VerifiedBy         string   `json:"verifiedBy"`
-	DocType            string   `json:"docType"`
-	CreatedAt          string   `json:"createdAt"`
+// DonorSummary is a donor record stripped of name and contact details.
+type DonorSummary struct {
+	ID                 string `json:"id"`
+	BloodType          string `json:"bloodType"`
+	VerificationStatus string `json:"verificationStatus"`
+	VerifiedBy         string `json:"verifiedBy"`
 }
 
-type Match struct {
-	ID         string `json:"id"`
-	PatientID  string `json:"patientId"`
-	DonorID    string `json:"donorId"`
-	OrganType  string `json:"organType"`
-	HLAScore   string `json:"hlaScore"`
-	Status     string `json:"status"`
-	DocType    string `json:"docType"`
-	CreatedAt  string `json:"createdAt"`
-	ApprovedBy string `json:"approvedBy"`
+// PatientRemovalSummary reports what a cascading patient delete touched.
+type PatientRemovalSummary struct {
+	PatientID        string   `json:"patientId"`
+	CancelledMatches []string `json:"cancelledMatches"`
+	RestoredOrgans   []string `json:"restoredOrgans"`
 }
 
-type Hospital struct {
-	ID           string `json:"id"`
-	Name         string `json:"name"`
-	PasswordHash string `json:"passwordHash"`
-	Location     string `json:"location"`
-	DocType      string `json:"docType"`
-	CreatedAt    string `json:"createdAt"`
-	IsActive     bool   `json:"isActive"`
+// HospitalStatusSummary reports a hospital status change and the waiting patients
+// whose transfer flag it set or cleared.
+type HospitalStatusSummary struct {
+	HospitalID      string   `json:"hospitalId"`
+	IsActive        bool     `json:"isActive"`
+	Reason          string   `json:"reason"`
+	ChangedBy       string   `json:"changedBy"`
+	ChangedAt       string   `json:"changedAt"`
+	FlaggedPatients []string `json:"flaggedPatients"`
+}
+
+// MatchChain is the provenance of a transplanted organ. Links that no longer
+// resolve are left empty and listed in MissingLinks.
+type MatchChain struct {
+	Transplant   *Transplant     `json:"transplant"`
+	Match        *Match          `json:"match,omitempty" metadata:",optional"`
+	Patient      *PatientSummary `json:"patient,omitempty" metadata:",optional"`
+	Donor        *DonorSummary   `json:"donor,omitempty" metadata:",optional"`
+	ConsentHash  string          `json:"consentHash"`
+	MissingLinks []string        `json:"missingLinks"`
 }
 
 // --- INTERNAL HELPERS (GENERICS) ---
 
+// txTimestamp returns the proposal's timestamp, which is identical on every endorsing
+// peer. Never use time.Now() in chaincode: each peer would write a different value.
+func txTimestamp(ctx contractapi.TransactionContextInterface) (*time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	t := time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+	return &t, nil
+}
+
 func (s *SmartContract) getTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
-	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	t, err := txTimestamp(ctx)
 	if err != nil {
 		return "", err
 	}
-	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).Format(time.RFC3339), nil
+	return t.Format(time.RFC3339), nil
+}
+
+// parseTimestamp parses a stored RFC3339 timestamp into UTC.
+func parseTimestamp(ts string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return time.Time{}, codedError(CodeInvalidArgument, "", "", "invalid timestamp %q: %v", ts, err)
+	}
+	return t.UTC(), nil
+}
+
+// compareByCreatedAt orders two timestamps oldest first. Missing or malformed
+// values sort after every valid one so they never jump the queue.
+func compareByCreatedAt(a, b string) int {
+	ta, errA := parseTimestamp(a)
+	tb, errB := parseTimestamp(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return 1
+	case errB != nil:
+		return -1
+	}
+	return ta.Compare(tb)
 }
 
 func putState[T any](ctx contractapi.TransactionContextInterface, id string, data T) error {
+	key, err := recordKey[T](ctx, id)
+	if err != nil {
+		return err
+	}
+	// Versioned records may be passed by pointer or by value.
+	bumpVersion(data)
+	bumpVersion(&data)
+	stampSchema(data)
+	stampSchema(&data)
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return ctx.GetStub().PutState(id, bytes)
+	if err := reindex[T](ctx, key, data); err != nil {
+		return err
+	}
+	docType, _ := docTypeOf[T]()
+	if err := writeAudit(ctx, docType, id, key, bytes); err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, bytes)
+}
+
+// transientDonorPII reads donor PII from the donor_pii transient field, returning nil
+// when the caller sent none.
+func transientDonorPII(ctx contractapi.TransactionContextInterface) (*DonorPrivate, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	piiJSON, ok := transient[donorPIITransientKey]
+	if !ok {
+		return nil, nil
+	}
+	return parseDonorPII(piiJSON)
+}
+
+// parseDonorPII reads and validates one donor's PII as supplied in transient data.
+func parseDonorPII(piiJSON []byte) (*DonorPrivate, error) {
+	var pii DonorPrivate
+	if err := json.Unmarshal(piiJSON, &pii); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "pii", "invalid donor PII: %v", err)
+	}
+	if err := validateDonorContact(&pii); err != nil {
+		return nil, err
+	}
+	return &pii, nil
+}
+
+// putDonorPII writes a donor's PII to the private collection and returns the SHA-256
+// of what was stored, which the public donor record keeps as PIIHash. Email and phone
+// are encrypted first, so the caller must supply the owning hospital's key with them.
+func putDonorPII(ctx contractapi.TransactionContextInterface, id string, pii *DonorPrivate) (string, error) {
+	pii.ID, pii.DocType = id, "donorPrivate"
+	if pii.Email != "" || pii.Phone != "" {
+		key, err := transientPIIKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		if key == nil {
+			return "", codedError(CodeInvalidArgument, "", piiKeyTransientKey, "donor contact details must be encrypted: supply the hospital key in the %q transient field", piiKeyTransientKey)
+		}
+		if err := sealContact(ctx, pii, key); err != nil {
+			return "", err
+		}
+	}
+	bytes, err := json.Marshal(pii)
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.GetStub().PutPrivateData(donorPIICollection, id, bytes); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// requireCallerOrgMatchesPeer rejects clients from an org other than the endorsing
+// peer's, since a peer only serves private data to its own org's members.
+func requireCallerOrgMatchesPeer(ctx contractapi.TransactionContextInterface) error {
+	clientMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	peerMSP, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read peer MSP ID: %v", err)
+	}
+	if clientMSP != peerMSP {
+		return codedError(CodeForbidden, "", "", "client from org %s is not authorized to read private data from an org %s peer", clientMSP, peerMSP)
+	}
+	return nil
 }
 
 func getState[T any](ctx contractapi.TransactionContextInterface, id string) (*T, error) {
-	bytes, err := ctx.GetStub().GetState(id)
+	val, err := findState[T](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		docType, err := docTypeOf[T]()
+		if err != nil {
+			return nil, err
+		}
+		return nil, notFound(docType, id)
+	}
+	return val, nil
+}
+
+// findState is getState for lookups where a missing record is expected; it returns nil, nil in that case.
+func findState[T any](ctx contractapi.TransactionContextInterface, id string) (*T, error) {
+	key, err := recordKey[T](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from world state: %v", err)
 	}
 	if bytes == nil {
-		return nil, fmt.Errorf("resource %s does not exist", id)
+		return nil, nil
 	}
 	var val T
 	if err := json.Unmarshal(bytes, &val); err != nil {
@@ -112,8 +480,119 @@ func getState[T any](ctx contractapi.TransactionContextInterface, id string) (*T
 	return &val, nil
 }
 
-func queryPopulate[T any](ctx contractapi.TransactionContextInterface, startKey, endKey string) ([]*T, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+// requireAdmin checks that the caller acts for the active admin hospital and returns
+// its ID.
+func requireAdmin(ctx contractapi.TransactionContextInterface) (string, error) {
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if actor.HospitalID != adminHospitalID {
+		return "", codedError(CodeForbidden, "", "", "operation requires admin privileges")
+	}
+	h, err := getState[Hospital](ctx, adminHospitalID)
+	if err != nil || !h.IsActive {
+		return "", codedError(CodeForbidden, "", "", "operation requires admin privileges")
+	}
+	return adminHospitalID, nil
+}
+
+// activeHospital loads a hospital and checks that it may still act on the ledger.
+func activeHospital(ctx contractapi.TransactionContextInterface, hospitalId string) (*Hospital, error) {
+	h, err := getState[Hospital](ctx, hospitalId)
+	if err != nil || h.DocType != "hospital" {
+		return nil, notFound(docTypeHospital, hospitalId)
+	}
+	if !h.IsActive {
+		return nil, codedError(CodeHospitalInactive, docTypeHospital, "", "hospital %s is inactive", hospitalId)
+	}
+	return h, nil
+}
+
+// restoreOrgan returns an organ released by a match to its donor. A donor that has
+// since been removed is skipped and reported as not restored.
+func (s *SmartContract) restoreOrgan(ctx contractapi.TransactionContextInterface, donorId, organ string) (bool, error) {
+	d, err := findState[Donor](ctx, donorId)
+	if err != nil || d == nil {
+		return false, err
+	}
+	if err := s.setOrganStatus(ctx, donorId, organ, OrganAvailable, "", ""); err != nil {
+		return false, err
+	}
+	d.OrgansAvailable = append(d.OrgansAvailable, organ)
+	return true, putState(ctx, d.ID, d)
+}
+
+// normalizeUrgency validates an urgency level, accepting the legacy CRITICAL and
+// URGENT names for STATUS_1A and STATUS_1B.
+func normalizeUrgency(urgency string) (string, error) {
+	if tier, ok := legacyUrgency[urgency]; ok {
+		urgency = tier
+	}
+	if _, ok := UrgencyTiers[urgency]; !ok {
+		return "", codedError(CodeInvalidUrgency, "", "urgency", "invalid urgency %q: must be STATUS_1A, STATUS_1B or ROUTINE", urgency)
+	}
+	return urgency, nil
+}
+
+// urgencyTier returns the sort tier for a patient; records created before urgency
+// existed count as ROUTINE.
+func urgencyTier(urgency string) int {
+	if legacy, ok := legacyUrgency[urgency]; ok {
+		urgency = legacy
+	}
+	if tier, ok := UrgencyTiers[urgency]; ok {
+		return tier
+	}
+	return UrgencyTiers["ROUTINE"]
+}
+
+func validateOrgan(organ string) error {
+	for _, o := range Organs {
+		if o == organ {
+			return nil
+		}
+	}
+	return codedError(CodeInvalidOrgan, "", "organ", "invalid organ %q: must be one of %s", organ, strings.Join(Organs, ", "))
+}
+
+// parseOrganList decodes a JSON array of organs, requiring at least one valid,
+// non-repeated organ.
+func parseOrganList(organsJSON string) ([]string, error) {
+	var organs []string
+	if err := json.Unmarshal([]byte(organsJSON), &organs); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "organs", "organs must be a JSON array of organ names: %v", err)
+	}
+	if len(organs) == 0 {
+		return nil, codedError(CodeInvalidOrgan, "", "organs", "at least one organ is required")
+	}
+	seen := map[string]bool{}
+	for _, o := range organs {
+		if err := validateOrgan(o); err != nil {
+			return nil, err
+		}
+		if seen[o] {
+			return nil, codedError(CodeInvalidOrgan, "", "organs", "organ %s is listed more than once", o)
+		}
+		seen[o] = true
+	}
+	return organs, nil
+}
+
+func validateBloodType(bloodType string) error {
+	if _, ok := BloodCompatibilityMap[bloodType]; !ok {
+		return codedError(CodeInvalidBloodType, "", "bloodType", "invalid blood type %q: must be one of %s", bloodType, strings.Join(BloodTypes, ", "))
+	}
+	return nil
+}
+
+// queryPopulate reads every record of type T.
+func queryPopulate[T any](ctx contractapi.TransactionContextInterface) ([]*T, error) {
+	docType, err := docTypeOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(docType, []string{})
 	if err != nil {
 		return nil, err
 	}
@@ -136,17 +615,33 @@ func queryPopulate[T any](ctx contractapi.TransactionContextInterface, startKey,
 
 // --- SMART CONTRACT FUNCTIONS ---
 
+// InitLedger seeds sample patients and donors. It is only available on dev/test
+// networks; see requireDevNetwork.
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	ts, _ := s.getTimestamp(ctx)
+	if err := requireDevNetwork(); err != nil {
+		return err
+	}
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Seed 4 Patients
 	patients := []Patient{
-		{ID: "PAT-001", NameHash: "hashed_name_1", BloodType: "A+", HLA: "A2, B35, DR1", OrganNeeded: "Kidney", IPFSHash: "ipfs_p_1", Status: "WAITING", HospitalID: "HOS1", DocType: "patient", CreatedAt: ts},
-		{ID: "PAT-002", NameHash: "hashed_name_2", BloodType: "O-", HLA: "A1, B8, DR15", OrganNeeded: "Liver", IPFSHash: "ipfs_p_2", Status: "WAITING", HospitalID: "HOS1", DocType: "patient", CreatedAt: ts},
-		{ID: "PAT-003", NameHash: "hashed_name_3", BloodType: "B+", HLA: "A3, B7, DR4", OrganNeeded: "Heart", IPFSHash: "ipfs_p_3", Status: "WAITING", HospitalID: "ADMIN-HOSP", DocType: "patient", CreatedAt: ts},
-		{ID: "PAT-004", NameHash: "hashed_name_4", BloodType: "AB-", HLA: "A24, B44, DR17", OrganNeeded: "Kidney", IPFSHash: "ipfs_p_4", Status: "WAITING", HospitalID: "ADMIN-HOSP", DocType: "patient", CreatedAt: ts},
+		{ID: "PAT-001", NameHash: "hashed_name_1", BloodType: "A+", HLA: HLATyping{A: []string{"02"}, B: []string{"35"}, DRB1: []string{"01"}}, OrganNeeded: "Kidney", IPFSHash: "ipfs_p_1", Status: "WAITING", Urgency: "ROUTINE", HospitalID: "HOSP-001", DocType: "patient", CreatedAt: ts},
+		{ID: "PAT-002", NameHash: "hashed_name_2", BloodType: "O-", HLA: HLATyping{A: []string{"01"}, B: []string{"08"}, DRB1: []string{"15"}}, OrganNeeded: "Liver", IPFSHash: "ipfs_p_2", Status: "WAITING", Urgency: "STATUS_1B", HospitalID: "HOSP-001", DocType: "patient", CreatedAt: ts},
+		{ID: "PAT-003", NameHash: "hashed_name_3", BloodType: "B+", HLA: HLATyping{A: []string{"03"}, B: []string{"07"}, DRB1: []string{"04"}}, OrganNeeded: "Heart", IPFSHash: "ipfs_p_3", Status: "WAITING", Urgency: "STATUS_1A", HospitalID: "HOSP-ADMIN", DocType: "patient", CreatedAt: ts},
+		{ID: "PAT-004", NameHash: "hashed_name_4", BloodType: "AB-", HLA: HLATyping{A: []string{"24"}, B: []string{"44"}, DRB1: []string{"17"}}, OrganNeeded: "Kidney", IPFSHash: "ipfs_p_4", Status: "WAITING", Urgency: "ROUTINE", HospitalID: "HOSP-ADMIN", DocType: "patient", CreatedAt: ts},
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return err
 	}
 	for _, p := range patients {
+		p.OwnerMSP = owner
 		if err := putState(ctx, p.ID, p); err != nil {
 			return err
 		}
@@ -154,13 +649,29 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 
 	// Seed 4 Donors
 	donors := []Donor{
-		{ID: "DON-101", Name: "Donor One", BloodType: "O-", HLA: "A1, B8, DR15", OrgansAvailable: []string{"Kidney", "Liver"}, IPFSHash: "ipfs_d_1", ConsentHash: "consent_1", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED"},
-		{ID: "DON-102", Name: "Donor Two", BloodType: "AB+", HLA: "A2, B35, DR1", OrgansAvailable: []string{"Heart"}, IPFSHash: "ipfs_d_2", ConsentHash: "consent_2", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED"},
-		{ID: "DON-103", Name: "Donor Three", BloodType: "A+", HLA: "A3, B7, DR4", OrgansAvailable: []string{"Kidney"}, IPFSHash: "ipfs_d_3", ConsentHash: "consent_3", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED"},
-		{ID: "DON-104", Name: "Donor Four", BloodType: "B-", HLA: "A24, B44, DR17", OrgansAvailable: []string{"Liver"}, IPFSHash: "ipfs_d_4", ConsentHash: "consent_4", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED"},
+		{ID: "DON-101", BloodType: "O-", HLA: HLATyping{A: []string{"01"}, B: []string{"08"}, DRB1: []string{"15"}}, OrgansAvailable: []string{"Kidney", "Liver"}, IPFSHash: "ipfs_d_1", ConsentHash: "consent_1", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED", DonorType: DonorDBD, BrainDeathAt: ts},
+		{ID: "DON-102", BloodType: "AB+", HLA: HLATyping{A: []string{"02"}, B: []string{"35"}, DRB1: []string{"01"}}, OrgansAvailable: []string{"Heart"}, IPFSHash: "ipfs_d_2", ConsentHash: "consent_2", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED", DonorType: DonorDBD, BrainDeathAt: ts},
+		{ID: "DON-103", BloodType: "A+", HLA: HLATyping{A: []string{"03"}, B: []string{"07"}, DRB1: []string{"04"}}, OrgansAvailable: []string{"Kidney"}, IPFSHash: "ipfs_d_3", ConsentHash: "consent_3", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED", DonorType: DonorDBD, BrainDeathAt: ts},
+		{ID: "DON-104", BloodType: "B-", HLA: HLATyping{A: []string{"24"}, B: []string{"44"}, DRB1: []string{"17"}}, OrgansAvailable: []string{"Liver"}, IPFSHash: "ipfs_d_4", ConsentHash: "consent_4", DocType: "donor", CreatedAt: ts, VerificationStatus: "VERIFIED", DonorType: DonorDBD, BrainDeathAt: ts},
 	}
-	for _, d := range donors {
-		if err := putState(ctx, d.ID, d); err != nil {
+	for i, name := range []string{"Donor One", "Donor Two", "Donor Three", "Donor Four"} {
+		donors[i].OwnerMSP = owner
+		if donors[i].PIIHash, err = putDonorPII(ctx, donors[i].ID, &DonorPrivate{Name: name}); err != nil {
+			return err
+		}
+		donors[i].Consents = []*ConsentVersion{initialConsent(&donors[i], adminHospitalID, ts)}
+		donors[i].ScreeningCleared = true
+		donors[i].DeathConfirmed = true
+		if err := putState(ctx, donors[i].ID, donors[i]); err != nil {
+			return err
+		}
+		if err := putState(ctx, donors[i].ID, seedSerologyPanel(donors[i].ID, owner, ts)); err != nil {
+			return err
+		}
+		if err := putState(ctx, donors[i].ID, seedDeathDeclaration(&donors[i], ts)); err != nil {
+			return err
+		}
+		if err := s.syncDonorOrgans(ctx, &donors[i]); err != nil {
 			return err
 		}
 	}
@@ -168,13 +679,36 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	return s.InitHospitals(ctx)
 }
 
+// InitHospitals registers the admin hospital and a first hospital with default
+// passwords. Production networks need it once to bootstrap, but outside dev/test
+// networks it refuses to run again, since that would reset both passwords.
 func (s *SmartContract) InitHospitals(ctx contractapi.TransactionContextInterface) error {
-	ts, _ := s.getTimestamp(ctx)
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if requireDevNetwork() != nil {
+		admin, err := findState[Hospital](ctx, adminHospitalID)
+		if err != nil {
+			return err
+		}
+		if admin != nil {
+			return codedError(CodeAlreadyExists, docTypeHospital, "", "hospitals are already initialised")
+		}
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 	hospitals := []Hospital{
-		{ID: "ADMIN-HOSP", Name: "Admin Medical Center", PasswordHash: "240be518fabd2724ddb6f04eeb1da5967448d7e831c08c8fa822809f74c720a9", Location: "Central", DocType: "hospital", CreatedAt: ts, IsActive: true},
-		{ID: "HOS1", Name: "Hospital One", PasswordHash: "2c05de51fe8b3b2d9796704c85b4b215f7c600c10100bbb89f4792e210a8dcc3", Location: "North", DocType: "hospital", CreatedAt: ts, IsActive: true},
+		{ID: "HOSP-ADMIN", Name: "Admin Medical Center", PasswordHash: "240be518fabd2724ddb6f04eeb1da5967448d7e831c08c8fa822809f74c720a9", Location: "Central", DocType: "hospital", CreatedAt: ts, IsActive: true},
+		{ID: "HOSP-001", Name: "Hospital One", PasswordHash: "2c05de51fe8b3b2d9796704c85b4b215f7c600c10100bbb89f4792e210a8dcc3", Location: "North", DocType: "hospital", CreatedAt: ts, IsActive: true},
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return err
 	}
 	for _, h := range hospitals {
+		h.OwnerMSP = owner
 		if err := putState(ctx, h.ID, h); err != nil {
 			return err
 		}
@@ -183,189 +717,1226 @@ func (s *SmartContract) InitHospitals(ctx contractapi.TransactionContextInterfac
 }
 
 func (s *SmartContract) RegisterHospital(ctx contractapi.TransactionContextInterface, id, name, passwordHash, location string) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if err := validateFields(
+		validateID("hospitalId", hospitalIDPrefix, id),
+		validateRequired("name", name),
+	); err != nil {
+		return err
+	}
 	if exists, _ := s.RecordExists(ctx, id); exists {
-		return fmt.Errorf("hospital %s already exists", id)
+		return codedError(CodeAlreadyExists, docTypeHospital, "", "hospital %s already exists", id)
 	}
-	ts, _ := s.getTimestamp(ctx)
-	return putState(ctx, id, Hospital{
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	err = putState(ctx, id, Hospital{
 		ID: id, Name: name, PasswordHash: passwordHash, Location: location,
-		DocType: "hospital", CreatedAt: ts, IsActive: true,
+		DocType: "hospital", CreatedAt: ts, IsActive: true, OwnerMSP: owner,
 	})
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventHospitalRegistered, map[string]string{"hospitalId": id, "name": name, "location": location})
 }
 
-func (s *SmartContract) AuthenticateHospital(ctx contractapi.TransactionContextInterface, id, passwordHash string) (string, error) {
-	h, err := getState[Hospital](ctx, id)
+// DeactivateHospital suspends a hospital; AuthenticateHospital refuses inactive hospitals.
+// With transferPatients set, the hospital's waiting patients are flagged for transfer
+// so they are not left on an inactive hospital's list.
+func (s *SmartContract) DeactivateHospital(ctx contractapi.TransactionContextInterface, id, reason string, transferPatients bool) (*HospitalStatusSummary, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	adminId, err := requireAdmin(ctx)
 	if err != nil {
-		return "", fmt.Errorf("authentication failed: hospital not found")
+		return nil, err
 	}
-	if !h.IsActive || h.PasswordHash != passwordHash {
-		return "", fmt.Errorf("authentication failed: invalid credentials or inactive")
+	if id == adminHospitalID {
+		return nil, codedError(CodeForbidden, docTypeHospital, "", "the admin hospital cannot be deactivated")
 	}
-	res, _ := json.Marshal(map[string]string{"id": h.ID, "name": h.Name, "location": h.Location})
-	return string(res), nil
+	return s.setHospitalActive(ctx, id, adminId, reason, false, transferPatients)
 }
 
-func (s *SmartContract) ClearLedger(ctx contractapi.TransactionContextInterface) error {
-	prefixes := []string{"PAT-", "DON-", "MATCH-"}
-	for _, p := range prefixes {
-		it, _ := ctx.GetStub().GetStateByRange(p, p+"~")
-		for it.HasNext() {
-			res, _ := it.Next()
-			_ = ctx.GetStub().DelState(res.Key)
-		}
-		it.Close()
+// ReactivateHospital restores a suspended hospital and clears the transfer flag on its
+// patients that are still waiting there.
+func (s *SmartContract) ReactivateHospital(ctx contractapi.TransactionContextInterface, id, reason string) (*HospitalStatusSummary, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
 	}
-	return nil
-}
-
-func (s *SmartContract) CreatePatient(ctx contractapi.TransactionContextInterface, id, nameHash, bloodType, hla, organNeeded, ipfsHash, hospitalId string) error {
-	if exists, _ := s.RecordExists(ctx, id); exists {
-		return fmt.Errorf("patient %s already exists", id)
+	adminId, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
 	}
-	ts, _ := s.getTimestamp(ctx)
-	return putState(ctx, id, Patient{
-		ID: id, NameHash: nameHash, BloodType: bloodType, HLA: hla,
-		OrganNeeded: organNeeded, IPFSHash: ipfsHash, Status: "WAITING",
-		HospitalID: hospitalId, DocType: "patient", CreatedAt: ts,
-	})
+	return s.setHospitalActive(ctx, id, adminId, reason, true, true)
 }
 
-func (s *SmartContract) CreateDonor(ctx contractapi.TransactionContextInterface, id, name, email, phone, bloodType, hla, organsAvailableJSON, ipfsHash, consentHash string) error {
-	if exists, _ := s.RecordExists(ctx, id); exists {
-		return fmt.Errorf("donor %s already exists", id)
+func (s *SmartContract) setHospitalActive(ctx contractapi.TransactionContextInterface, id, adminId, reason string, active, flagPatients bool) (*HospitalStatusSummary, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required")
 	}
-	var organs []string
-	_ = json.Unmarshal([]byte(organsAvailableJSON), &organs)
-	ts, _ := s.getTimestamp(ctx)
-	return putState(ctx, id, Donor{
-		ID: id, Name: name, Email: email, Phone: phone, BloodType: bloodType, HLA: hla,
-		OrgansAvailable: organs, IPFSHash: ipfsHash, ConsentHash: consentHash,
-		VerificationStatus: "PENDING_VERIFICATION", DocType: "donor", CreatedAt: ts,
-	})
-}
-
-func (s *SmartContract) VerifyDonor(ctx contractapi.TransactionContextInterface, donorId, hospitalId, status string) error {
-	d, err := getState[Donor](ctx, donorId)
+	h, err := getState[Hospital](ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if status != "VERIFIED" && status != "REJECTED" {
-		return fmt.Errorf("invalid status: must be VERIFIED or REJECTED")
+	if h.IsActive == active {
+		state := "inactive"
+		if active {
+			state = "active"
+		}
+		return nil, codedError(CodeInvalidTransition, docTypeHospital, "", "hospital %s is already %s", id, state)
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.IsActive = active
+	h.StatusReason, h.StatusChangedBy, h.StatusChangedAt = reason, adminId, ts
+	if err := putState(ctx, id, h); err != nil {
+		return nil, err
 	}
-	d.VerificationStatus = status
-	d.VerifiedBy = hospitalId
-	return putState(ctx, donorId, d)
-}
-
-func (s *SmartContract) GetPatient(ctx contractapi.TransactionContextInterface, id string) (*Patient, error) {
-	return getState[Patient](ctx, id)
-}
 
-func (s *SmartContract) GetDonor(ctx contractapi.TransactionContextInterface, id string) (*Donor, error) {
-	d, err := getState[Donor](ctx, id)
-	if err == nil && d.OrgansAvailable == nil {
-		d.OrgansAvailable = []string{}
+	summary := &HospitalStatusSummary{
+		HospitalID: id, IsActive: active, Reason: reason, ChangedBy: adminId, ChangedAt: ts,
+		FlaggedPatients: []string{},
+	}
+	if flagPatients {
+		patients, err := queryPopulate[Patient](ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patients {
+			// Deactivation flags waiting patients; reactivation clears the flag.
+			if p.HospitalID != id || p.Status != "WAITING" || p.TransferRequired == !active {
+				continue
+			}
+			p.TransferRequired = !active
+			if err := putState(ctx, p.ID, p); err != nil {
+				return nil, err
+			}
+			summary.FlaggedPatients = append(summary.FlaggedPatients, p.ID)
+		}
 	}
-	return d, err
-}
 
-func (s *SmartContract) GetHospital(ctx contractapi.TransactionContextInterface, id string) (*Hospital, error) {
-	return getState[Hospital](ctx, id)
+	err = emitEvent(ctx, EventHospitalStatusChanged, map[string]interface{}{
+		"hospitalId": id, "isActive": active, "reason": reason, "changedBy": adminId,
+		"flaggedPatients": summary.FlaggedPatients,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
 }
 
-func (s *SmartContract) UpdateDonorStatus(ctx contractapi.TransactionContextInterface, id, organToRemove string) error {
-	d, err := s.GetDonor(ctx, id)
+func (s *SmartContract) ChangeHospitalPassword(ctx contractapi.TransactionContextInterface, id, oldHash, newHash string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	h, err := getState[Hospital](ctx, id)
 	if err != nil {
 		return err
 	}
-	var updated []string
-	for _, o := range d.OrgansAvailable {
-		if o != organToRemove {
-			updated = append(updated, o)
-		}
+	if err := s.requireOwnerOrg(ctx, h.OwnerMSP); err != nil {
+		return err
 	}
-	d.OrgansAvailable = updated
-	return putState(ctx, id, d)
-}
-
-func (s *SmartContract) CreateMatch(ctx contractapi.TransactionContextInterface, id, patientId, donorId, organType, hlaScore, approvedBy string) error {
-	p, errP := s.GetPatient(ctx, patientId)
-	d, errD := s.GetDonor(ctx, donorId)
-	if errP != nil || errD != nil {
-		return fmt.Errorf("patient or donor not found")
+	if h.MustChangePassword {
+		return codedError(CodeInvalidTransition, docTypeHospital, "", "a password reset is pending; use CompletePasswordReset")
 	}
-
-	if d.VerificationStatus != "VERIFIED" {
-		return fmt.Errorf("donor not verified")
+	if h.PasswordHash != oldHash {
+		return codedError(CodeUnauthenticated, docTypeHospital, "", "current password does not match")
 	}
-
-	if !s.IsBloodCompatible(p.BloodType, d.BloodType) {
-		return fmt.Errorf("blood type mismatch")
+	if newHash == "" || newHash == oldHash {
+		return codedError(CodeInvalidArgument, "", "newHash", "new password must be non-empty and differ from the current one")
 	}
+	h.PasswordHash = newHash
+	return putState(ctx, id, h)
+}
 
-	organFound := false
-	for _, o := range d.OrgansAvailable {
-		if o == organType {
-			organFound = true
-			break
-		}
+// ResetHospitalPassword lets an admin force a password reset. The admin hands the
+// hospital a one-time token out of band and submits only its SHA-256 hex digest; the
+// current password stops working until CompletePasswordReset is called with the token.
+func (s *SmartContract) ResetHospitalPassword(ctx contractapi.TransactionContextInterface, id, resetTokenHash string) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
 	}
-	if !organFound {
-		return fmt.Errorf("organ not available")
+	if resetTokenHash == "" {
+		return codedError(CodeInvalidArgument, "", "resetTokenHash", "a reset token hash is required")
 	}
+	h, err := getState[Hospital](ctx, id)
+	if err != nil {
+		return err
+	}
+	h.PasswordHash = ""
+	h.MustChangePassword = true
+	h.ResetTokenHash = resetTokenHash
+	return putState(ctx, id, h)
+}
 
-	ts, _ := s.getTimestamp(ctx)
-	p.Status = "MATCHED"
-	_ = putState(ctx, p.ID, p)
-
-	return putState(ctx, id, Match{
+// CompletePasswordReset sets a new password using the one-time token from
+// ResetHospitalPassword. The token can be used only once.
+func (s *SmartContract) CompletePasswordReset(ctx contractapi.TransactionContextInterface, id, resetToken, newHash string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	h, err := getState[Hospital](ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, h.OwnerMSP); err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(resetToken))
+	if !h.MustChangePassword || h.ResetTokenHash == "" || hex.EncodeToString(sum[:]) != h.ResetTokenHash {
+		return codedError(CodeUnauthenticated, docTypeHospital, "", "invalid or expired reset token")
+	}
+	if newHash == "" {
+		return codedError(CodeInvalidArgument, "", "newHash", "new password must be non-empty")
+	}
+	h.PasswordHash = newHash
+	h.MustChangePassword = false
+	h.ResetTokenHash = ""
+	return putState(ctx, id, h)
+}
+
+func (s *SmartContract) AuthenticateHospital(ctx contractapi.TransactionContextInterface, id, passwordHash string) (string, error) {
+	h, err := getState[Hospital](ctx, id)
+	if err != nil {
+		return "", codedError(CodeUnauthenticated, docTypeHospital, "", "authentication failed: hospital not found")
+	}
+	if h.MustChangePassword {
+		return "", codedError(CodeUnauthenticated, docTypeHospital, "", "authentication failed: password reset required")
+	}
+	if !h.IsActive || h.PasswordHash != passwordHash {
+		return "", codedError(CodeUnauthenticated, docTypeHospital, "", "authentication failed: invalid credentials or inactive")
+	}
+	res, _ := json.Marshal(map[string]string{"id": h.ID, "name": h.Name, "location": h.Location})
+	return string(res), nil
+}
+
+// ClearLedger deletes every record along with its logs and indexes, keeping only the
+// network configuration: hospitals, policy, access rules and the eplet table. It is
+// only available on dev/test networks, and confirmation must be the channel name so a
+// script pointed at the wrong channel cannot wipe it.
+func (s *SmartContract) ClearLedger(ctx contractapi.TransactionContextInterface, confirmation string) error {
+	if err := requireDevNetwork(); err != nil {
+		return err
+	}
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if confirmation == "" || confirmation != ctx.GetStub().GetChannelID() {
+		return codedError(CodeInvalidArgument, "", "confirmation", "confirmation must be the name of the channel being cleared")
+	}
+	docTypes := []string{docTypeCustody, docTypeScore, docTypeAudit, docTypeAuditHead}
+	for _, docType := range recordDocTypes {
+		if !configDocTypes[docType] {
+			docTypes = append(docTypes, docType)
+		}
+	}
+	for _, docType := range append(docTypes, indexNames...) {
+		if err := clearDocType(ctx, docType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearDocType(ctx contractapi.TransactionContextInterface, docType string) error {
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docType, []string{})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.HasNext() {
+		res, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(res.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePatient lists a patient on the waitlist. An empty urgency defaults to ROUTINE.
+func (s *SmartContract) CreatePatient(ctx contractapi.TransactionContextInterface, id, nameHash, bloodType, hla, organNeeded, ipfsHash, urgency, identityHash string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	p, err := s.newPatient(ctx, &PatientInput{
+		ID: id, NameHash: nameHash, BloodType: bloodType, HLA: hla, OrganNeeded: organNeeded, IPFSHash: ipfsHash, Urgency: urgency,
+		IdentityHash: identityHash,
+	})
+	if err != nil {
+		return err
+	}
+	if err := putState(ctx, id, p); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPatientCreated, map[string]string{
+		"patientId": id, "organNeeded": p.OrganNeeded, "urgency": p.Urgency, "hospitalId": p.HospitalID,
+	})
+}
+
+// PatientInput holds CreatePatient's arguments, one per item of CreatePatientsBatch.
+type PatientInput struct {
+	ID           string `json:"id"`
+	NameHash     string `json:"nameHash"`
+	BloodType    string `json:"bloodType"`
+	HLA          string `json:"hla"`
+	OrganNeeded  string `json:"organNeeded"`
+	IPFSHash     string `json:"ipfsHash"`
+	Urgency      string `json:"urgency"`
+	IdentityHash string `json:"identityHash"`
+}
+
+// newPatient validates a new patient and builds its record at the caller's hospital,
+// without writing it.
+func (s *SmartContract) newPatient(ctx contractapi.TransactionContextInterface, in *PatientInput) (*Patient, error) {
+	urgency := in.Urgency
+	if urgency == "" {
+		urgency = "ROUTINE"
+	}
+	urgency, err := normalizeUrgency(urgency)
+	typing, hlaErr := parseHLATyping(in.HLA)
+	if err := validateFields(
+		validateID("patientId", patientIDPrefix, in.ID),
+		validateBloodType(in.BloodType),
+		hlaErr,
+		validateOrgan(in.OrganNeeded),
+		err,
+		validateIdentityHash("identityHash", in.IdentityHash),
+	); err != nil {
+		return nil, err
+	}
+	if exists, _ := s.RecordExists(ctx, in.ID); exists {
+		return nil, codedError(CodeAlreadyExists, docTypePatient, "", "patient %s already exists", in.ID)
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Patient{
+		ID: in.ID, NameHash: in.NameHash, IdentityHash: in.IdentityHash, BloodType: in.BloodType, HLA: typing,
+		OrganNeeded: in.OrganNeeded, IPFSHash: in.IPFSHash, Status: "WAITING", Urgency: urgency,
+		HospitalID: hospitalId, OwnerMSP: owner, DocType: "patient", CreatedAt: ts,
+	}, nil
+}
+
+// patientForHospital loads a patient for a clinical update and returns it with the
+// caller's hospital. The caller's org must own the record, the caller's hospital must
+// be active and be either the patient's own hospital or the admin hospital, and the
+// record must still be at the version the caller read.
+func (s *SmartContract) patientForHospital(ctx contractapi.TransactionContextInterface, id string, expectedVersion int) (*Patient, string, error) {
+	p, err := getState[Patient](ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.requireOwnerOrg(ctx, p.OwnerMSP); err != nil {
+		return nil, "", err
+	}
+	if err := requirePatientNotArchived(p); err != nil {
+		return nil, "", err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if hospitalId != p.HospitalID && hospitalId != adminHospitalID {
+		return nil, "", codedError(CodeForbidden, docTypePatient, "", "patient %s is registered at hospital %s", p.ID, p.HospitalID)
+	}
+	if err := requireVersion("patient", p.ID, p.Version, expectedVersion); err != nil {
+		return nil, "", err
+	}
+	return p, hospitalId, nil
+}
+
+// SetPatientUrgency moves a waiting patient between urgency tiers. The change must
+// come from the patient's own hospital (or the admin hospital) and give a clinical
+// reason, which is kept on the record alongside who made it and when.
+func (s *SmartContract) SetPatientUrgency(ctx contractapi.TransactionContextInterface, id, urgency, reason string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	urgency, err := normalizeUrgency(urgency)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to change patient urgency")
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, id, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot change urgency")
+	}
+	if p.Status != "WAITING" {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "urgency can only be changed for waiting patients; %s is %s", p.ID, p.Status)
+	}
+	previous := p.Urgency
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.Urgency = urgency
+	p.UrgencyReason = reason
+	p.UrgencyChangedBy = hospitalId
+	p.UrgencyChangedAt = ts
+	if err := putState(ctx, id, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientUpdated, map[string]string{
+		"patientId": id, "urgency": urgency, "previousUrgency": previous, "changedBy": hospitalId, "reason": reason,
+	})
+}
+
+// CreateDonor registers a donor. Name, email and phone are read from the transient
+// field "donor_pii" as JSON so they never appear in the transaction payload, and are
+// written to the donorPII private data collection. donorType and its details may be left
+// empty for a pledge and set later with ClassifyDonor; see applyDonorType.
+func (s *SmartContract) CreateDonor(ctx contractapi.TransactionContextInterface, id, bloodType, hla, organsAvailableJSON, ipfsHash, consentHash, donorType, donorDetailsJSON, nationalIdHash string) error {
+	n, err := s.newDonor(ctx, &DonorInput{
+		ID: id, BloodType: bloodType, HLA: hla, OrgansAvailable: json.RawMessage(organsAvailableJSON),
+		IPFSHash: ipfsHash, ConsentHash: consentHash, DonorType: donorType, Details: json.RawMessage(donorDetailsJSON),
+		NationalIDHash: nationalIdHash,
+	}, func() (*DonorPrivate, error) { return transientDonorPII(ctx) })
+	if err != nil {
+		return err
+	}
+	if err := s.writeDonor(ctx, n); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorCreated, map[string]interface{}{"donorId": id, "organsAvailable": n.donor.OrgansAvailable})
+}
+
+// DonorInput holds CreateDonor's arguments, one per item of CreateDonorsBatch, which
+// takes the organ list and donor details as JSON values rather than strings.
+type DonorInput struct {
+	ID              string          `json:"id"`
+	BloodType       string          `json:"bloodType"`
+	HLA             string          `json:"hla"`
+	OrgansAvailable json.RawMessage `json:"organsAvailable"`
+	IPFSHash        string          `json:"ipfsHash"`
+	ConsentHash     string          `json:"consentHash"`
+	DonorType       string          `json:"donorType"`
+	Details         json.RawMessage `json:"details"`
+	NationalIDHash  string          `json:"nationalIdHash"`
+}
+
+// pendingDonor is a validated donor waiting to be written with its PII.
+type pendingDonor struct {
+	donor *Donor
+	pii   *DonorPrivate
+}
+
+// newDonor validates a new donor and builds its record without writing it. readPII
+// supplies the donor's PII, which is required.
+func (s *SmartContract) newDonor(ctx contractapi.TransactionContextInterface, in *DonorInput, readPII func() (*DonorPrivate, error)) (*pendingDonor, error) {
+	organs, err := parseOrganList(string(in.OrgansAvailable))
+	typing, hlaErr := parseHLATyping(in.HLA)
+	if err := validateFields(
+		validateID("donorId", donorIDPrefix, in.ID),
+		validateBloodType(in.BloodType),
+		hlaErr,
+		err,
+		validateIdentityHash("nationalIdHash", in.NationalIDHash),
+	); err != nil {
+		return nil, err
+	}
+	if exists, _ := s.RecordExists(ctx, in.ID); exists {
+		return nil, codedError(CodeAlreadyExists, docTypeDonor, "", "donor %s already exists", in.ID)
+	}
+	if err := requireUniqueNationalID(ctx, in.NationalIDHash, in.ID); err != nil {
+		return nil, err
+	}
+	pii, err := readPII()
+	if err != nil {
+		return nil, err
+	}
+	if pii == nil {
+		return nil, codedError(CodeInvalidArgument, "", donorPIITransientKey, "donor PII must be supplied in the %q transient field", donorPIITransientKey)
+	}
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d := &Donor{
+		ID: in.ID, BloodType: in.BloodType, HLA: typing,
+		OrgansAvailable: organs, IPFSHash: in.IPFSHash, ConsentHash: in.ConsentHash, NationalIDHash: in.NationalIDHash,
+		VerificationStatus: "PENDING_VERIFICATION", OwnerMSP: owner, DocType: "donor", CreatedAt: now.Format(time.RFC3339),
+	}
+	if in.ConsentHash != "" {
+		d.Consents = []*ConsentVersion{initialConsent(d, "", d.CreatedAt)}
+	}
+	if in.DonorType != "" {
+		if err := applyDonorType(d, in.DonorType, string(in.Details), *now); err != nil {
+			return nil, err
+		}
+		if d.IntendedRecipientID != "" {
+			if err := s.linkRecipient(ctx, d, d.IntendedRecipientID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &pendingDonor{donor: d, pii: pii}, nil
+}
+
+// writeDonor writes a donor built by newDonor, its PII and its organs.
+func (s *SmartContract) writeDonor(ctx contractapi.TransactionContextInterface, n *pendingDonor) error {
+	var err error
+	if n.donor.PIIHash, err = putDonorPII(ctx, n.donor.ID, n.pii); err != nil {
+		return err
+	}
+	if err := putState(ctx, n.donor.ID, n.donor); err != nil {
+		return err
+	}
+	return s.syncDonorOrgans(ctx, n.donor)
+}
+
+func (s *SmartContract) VerifyDonor(ctx contractapi.TransactionContextInterface, donorId, status string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := getState[Donor](ctx, donorId)
+	if err != nil {
+		return err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if d.VerificationStatus == "WITHDRAWN" {
+		return codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", donorId)
+	}
+	if d.VerificationStatus == DonorInactive {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has been withdrawn and is inactive", donorId)
+	}
+	if status != "VERIFIED" && status != "REJECTED" {
+		return codedError(CodeInvalidArgument, "", "status", "invalid status: must be VERIFIED or REJECTED")
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return wrapError(err, "cannot verify donor")
+	}
+	d.VerificationStatus = status
+	d.VerifiedBy = hospitalId
+	if d.VerifiedAt, err = s.getTimestamp(ctx); err != nil {
+		return err
+	}
+	if err := putState(ctx, donorId, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorVerified, map[string]string{
+		"donorId": donorId, "status": status, "hospitalId": hospitalId,
+	})
+}
+
+// UpdateDonor corrects a donor's organ list and contact details. Contact changes arrive
+// in the optional donor_pii transient field (email and phone only) so they never reach
+// the public ledger. Blood type and HLA are clinical identifiers and stay fixed; consent
+// changes go through RecordConsent.
+// Changing the organs of a verified donor sends them back for verification.
+// expectedVersion is the donor version the caller last read; see requireVersion.
+func (s *SmartContract) UpdateDonor(ctx contractapi.TransactionContextInterface, id, organsAvailableJSON string, expectedVersion int) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := s.GetDonor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if err := requireVersion("donor", d.ID, d.Version, expectedVersion); err != nil {
+		return err
+	}
+	if d.VerificationStatus == "WITHDRAWN" {
+		return codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", id)
+	}
+	if d.VerificationStatus == DonorInactive && organsAvailableJSON != "" {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has been withdrawn and cannot list organs", id)
+	}
+	update, err := transientDonorPII(ctx)
+	if err != nil {
+		return err
+	}
+	if organsAvailableJSON == "" && update == nil {
+		return codedError(CodeInvalidArgument, docTypeDonor, "", "nothing to update for donor %s", id)
+	}
+
+	if organsAvailableJSON != "" {
+		organs, err := parseOrganList(organsAvailableJSON)
+		if err != nil {
+			return err
+		}
+		if err := validateDonorOrgans(d.DonorType, organs); err != nil {
+			return err
+		}
+		matches, err := s.GetAllMatches(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if m.DonorID != id || terminalMatchStatuses[m.Status] {
+				continue
+			}
+			for _, o := range organs {
+				if o == m.OrganType {
+					return codedError(CodeInvalidTransition, docTypeDonor, "", "organ %s is already held by match %s", o, m.ID)
+				}
+			}
+		}
+		if !sameOrgans(d.OrgansAvailable, organs) {
+			d.OrgansAvailable = organs
+			if d.VerificationStatus == "VERIFIED" {
+				d.VerificationStatus = "PENDING_VERIFICATION"
+			}
+			if err := s.syncDonorOrgans(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	if update != nil {
+		if err := requireDonorPIIPresent(d); err != nil {
+			return err
+		}
+		pii, err := s.GetDonorPrivate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if update.Email != "" {
+			pii.Email = update.Email
+		}
+		if update.Phone != "" {
+			pii.Phone = update.Phone
+		}
+		if d.PIIHash, err = putDonorPII(ctx, id, pii); err != nil {
+			return err
+		}
+	}
+	if err := putState(ctx, d.ID, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorUpdated, map[string]interface{}{
+		"donorId": id, "organsAvailable": d.OrgansAvailable, "verificationStatus": d.VerificationStatus,
+	})
+}
+
+// sameOrgans reports whether two organ lists hold the same organs in any order.
+func sameOrgans(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, o := range a {
+		seen[o]++
+	}
+	for _, o := range b {
+		if seen[o] == 0 {
+			return false
+		}
+		seen[o]--
+	}
+	return true
+}
+
+// WithdrawDonorConsent records a donor's withdrawal of consent on the owning hospital's
+// authority. See withdrawConsent for what happens to the donor's organs.
+func (s *SmartContract) WithdrawDonorConsent(ctx contractapi.TransactionContextInterface, donorId string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := getState[Donor](ctx, donorId)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return err
+	}
+	return s.withdrawConsent(ctx, d, "")
+}
+
+// RevokeConsent records a revocation signed by the donor themselves. signature must be
+// the donor's signature, under their registered key, over consentRevocationHash for
+// the donor record's current version. A donor may revoke through any hospital, so
+// unlike WithdrawDonorConsent the caller need not belong to the donor's owning org; the
+// signature is what authorizes it.
+func (s *SmartContract) RevokeConsent(ctx contractapi.TransactionContextInterface, donorId, signature string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	if signature == "" {
+		return codedError(CodeInvalidArgument, "", "signature", "a revocation signature is required")
+	}
+	d, err := getState[Donor](ctx, donorId)
+	if err != nil {
+		return err
+	}
+	if d.PublicKeyPEM == "" {
+		return codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s has no registered public key; their owning hospital must use WithdrawDonorConsent", d.ID)
+	}
+	pub, err := parseDonorPublicKey(d.PublicKeyPEM)
+	if err != nil {
+		return err
+	}
+	hash, err := consentRevocationHash(d.ID, d.Version)
+	if err != nil {
+		return err
+	}
+	if err := verifyDonorSignature(pub, hash, signature); err != nil {
+		return codedError(CodeForbidden, docTypeDonor, "", "revocation for donor %s is not signed by the donor: %v", d.ID, err)
+	}
+	d.RevocationSignature = signature
+	return s.withdrawConsent(ctx, d, hash)
+}
+
+// withdrawConsent takes a donor out of matching. The donor offers no further organs,
+// and releaseDonor cancels pending offers on them and rejects any pending match.
+// signatureHash is the hash of the revocation the donor signed, if they signed one.
+func (s *SmartContract) withdrawConsent(ctx contractapi.TransactionContextInterface, d *Donor, signatureHash string) error {
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if d.VerificationStatus == "WITHDRAWN" {
+		return codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has already withdrawn consent", d.ID)
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	caller, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	rejected, cancelled, err := s.releaseDonor(ctx, d, "REJECTED", ReasonConsentWithdrawn, "donor consent withdrawn")
+	if err != nil {
+		return err
+	}
+
+	d.VerificationStatus = "WITHDRAWN"
+	d.OrgansAvailable = []string{}
+	d.ConsentWithdrawnAt, d.ConsentWithdrawnBy = ts, caller
+	d.RevocationSignatureHash = signatureHash
+	if err := putState(ctx, d.ID, d); err != nil {
+		return err
+	}
+	if err := s.syncDonorOrgans(ctx, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventConsentWithdrawn, map[string]interface{}{
+		"donorId": d.ID, "rejectedMatches": rejected, "cancelledOffers": cancelled,
+		"signatureHash": signatureHash, "withdrawnBy": caller,
+	})
+}
+
+// GetPatient returns a patient the caller may read; see patientScope.
+func (s *SmartContract) GetPatient(ctx contractapi.TransactionContextInterface, id string) (*Patient, error) {
+	p, err := getState[Patient](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePatientVisible(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SmartContract) GetDonor(ctx contractapi.TransactionContextInterface, id string) (*Donor, error) {
+	d, err := getState[Donor](ctx, id)
+	if err == nil && d.OrgansAvailable == nil {
+		d.OrgansAvailable = []string{}
+	}
+	return d, err
+}
+
+// CreateDonorPrivate attaches PII to a donor that has none in the private collection,
+// such as one registered before donor PII was kept off the public ledger.
+func (s *SmartContract) CreateDonorPrivate(ctx contractapi.TransactionContextInterface, id string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := s.GetDonor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if err := requireDonorPIIPresent(d); err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetPrivateDataHash(donorPIICollection, id)
+	if err != nil {
+		return fmt.Errorf("failed to read donor PII hash: %v", err)
+	}
+	if existing != nil {
+		return codedError(CodeAlreadyExists, docTypeDonor, "", "donor %s already has private data; use UpdateDonor to change it", id)
+	}
+	pii, err := transientDonorPII(ctx)
+	if err != nil {
+		return err
+	}
+	if pii == nil {
+		return codedError(CodeInvalidArgument, "", donorPIITransientKey, "donor PII must be supplied in the %q transient field", donorPIITransientKey)
+	}
+	if d.PIIHash, err = putDonorPII(ctx, id, pii); err != nil {
+		return err
+	}
+	if err := putState(ctx, d.ID, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorUpdated, map[string]interface{}{
+		"donorId": id, "organsAvailable": d.OrgansAvailable, "verificationStatus": d.VerificationStatus,
+	})
+}
+
+// GetDonorPrivate returns a donor's PII. Only peers of orgs in the donorPII collection
+// hold the data, so the caller must belong to the same org as the endorsing peer.
+// Email and phone stay sealed unless the caller supplies the hospital key in the
+// pii_key transient field.
+func (s *SmartContract) GetDonorPrivate(ctx contractapi.TransactionContextInterface, id string) (*DonorPrivate, error) {
+	if err := requireCallerOrgMatchesPeer(ctx); err != nil {
+		return nil, err
+	}
+	bytes, err := ctx.GetStub().GetPrivateData(donorPIICollection, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read donor PII: %v", err)
+	}
+	if bytes == nil {
+		if d, err := findState[Donor](ctx, id); err == nil && d != nil && d.PIIStatus == PIIErased {
+			return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "PII of donor %s was erased at %s", id, d.PIIErasedAt)
+		}
+		return nil, codedError("DONOR_PII_NOT_FOUND", docTypeDonor, "", "no private data for donor %s", id)
+	}
+	var pii DonorPrivate
+	if err := json.Unmarshal(bytes, &pii); err != nil {
+		return nil, err
+	}
+	if pii.Contact != nil {
+		key, err := transientPIIKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			if err := openContact(&pii, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &pii, nil
+}
+
+func (s *SmartContract) GetHospital(ctx contractapi.TransactionContextInterface, id string) (*Hospital, error) {
+	return getState[Hospital](ctx, id)
+}
+
+func (s *SmartContract) UpdateDonorStatus(ctx contractapi.TransactionContextInterface, id, organToRemove string, expectedVersion int) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	d, err := s.GetDonor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return err
+	}
+	if err := requireVersion("donor", d.ID, d.Version, expectedVersion); err != nil {
+		return err
+	}
+	removeOrgan(d, organToRemove)
+	if err := putState(ctx, id, d); err != nil {
+		return err
+	}
+	if err := s.syncDonorOrgans(ctx, d); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventDonorUpdated, map[string]interface{}{
+		"donorId": id, "organsAvailable": d.OrgansAvailable, "verificationStatus": d.VerificationStatus,
+	})
+}
+
+// removeOrgan takes every listing of organ out of the donor's available list and
+// reports whether there was one.
+func removeOrgan(d *Donor, organ string) bool {
+	kept := make([]string, 0, len(d.OrgansAvailable))
+	for _, o := range d.OrgansAvailable {
+		if o != organ {
+			kept = append(kept, o)
+		}
+	}
+	removed := len(kept) < len(d.OrgansAvailable)
+	d.OrgansAvailable = kept
+	return removed
+}
+
+// CreateMatch records a pending match and returns a JSON summary of what was committed.
+// The HLA score is computed from the HLA typings rather than supplied by the client.
+// An empty id is replaced by one derived from the tx ID.
+func (s *SmartContract) CreateMatch(ctx contractapi.TransactionContextInterface, id, patientId, donorId, organType string) (string, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = matchIDPrefix + ctx.GetStub().GetTxID()
+	} else if err := validateID("matchId", matchIDPrefix, id); err != nil {
+		return "", err
+	}
+	if exists, _ := s.RecordExists(ctx, id); exists {
+		return "", codedError(CodeAlreadyExists, docTypeMatch, "", "match %s already exists", id)
+	}
+	// Patients and donors have their own keyspaces, so swapped IDs would only show as
+	// not found; the prefixes say which argument is wrong.
+	if err := validateFields(validateID("patientId", patientIDPrefix, patientId), validateID("donorId", donorIDPrefix, donorId)); err != nil {
+		return "", err
+	}
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return "", err
+	}
+	if err := requirePatientNotArchived(p); err != nil {
+		return "", err
+	}
+	if p.Status != "WAITING" {
+		return "", codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is not waiting (status %s)", p.ID, p.Status)
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return "", err
+	}
+	if directedElsewhere(d, p.ID) {
+		return "", codedError(CodeIncompatible, docTypeDonor, "", "donor %s is a directed donor for patient %s", d.ID, d.IntendedRecipientID)
+	}
+	approvedBy, err := actingHospital(ctx)
+	if err != nil {
+		return "", wrapError(err, "cannot create match")
+	}
+
+	if d.VerificationStatus == "WITHDRAWN" {
+		return "", codedError(CodeConsentWithdrawn, docTypeDonor, "", "donor %s has withdrawn consent", d.ID)
+	}
+	if d.VerificationStatus != "VERIFIED" {
+		return "", codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is not verified (status %s)", d.ID, d.VerificationStatus)
+	}
+
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	compat := s.evaluateCompatibility(cfg, p, d, organType, *now)
+	if !compat.BloodCompatible {
+		// A malformed blood type on either record is bad data, not an ABO mismatch.
+		if _, err := s.IsBloodCompatible(d.BloodType, p.BloodType); err != nil {
+			return "", codedError(CodeInvalidArgument, docTypeMatch, "bloodType", "cannot match donor %s with patient %s: %s", d.ID, p.ID, errorMessage(err))
+		}
+		return "", codedError(ErrBloodTypeIncompatible, docTypeMatch, "", "donor %s (%s) cannot give to patient %s (%s)", d.ID, d.BloodType, p.ID, p.BloodType)
+	}
+	if !compat.Compatible {
+		return "", codedError(CodeIncompatible, docTypeMatch, "", "%s", strings.Join(compat.Reasons, "; "))
+	}
+	if err := s.requireViableOrgan(ctx, cfg, d.ID, organType); err != nil {
+		return "", err
+	}
+	eplets, err := s.epletMismatch(ctx, p, d)
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	// The organ is reserved in the same transaction as the match, so a second
+	// match for it fails the availability check above.
+	removeOrgan(d, organType)
+	if err := putState(ctx, d.ID, d); err != nil {
+		return "", err
+	}
+	if err := s.setOrganStatus(ctx, d.ID, organType, OrganReserved, id, approvedBy); err != nil {
+		return "", err
+	}
+	p.Status = "MATCHED"
+	if err := putState(ctx, p.ID, p); err != nil {
+		return "", err
+	}
+
+	err = putState(ctx, id, Match{
 		ID: id, PatientID: patientId, DonorID: donorId, OrganType: organType,
-		HLAScore: hlaScore, Status: "PENDING", DocType: "match", CreatedAt: ts, ApprovedBy: approvedBy,
+		HLAScore: strconv.Itoa(compat.HLAScore), EpletLoad: eplets.Load, Status: "PENDING", DocType: "match", CreatedAt: ts, ApprovedBy: approvedBy, OwnerMSP: owner,
+		OrganID: organID(donorId, organType),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = emitEvent(ctx, EventMatchCreated, map[string]string{
+		"matchId": id, "patientId": patientId, "donorId": donorId, "organType": organType,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	flags := []string{}
+	if d.VerifiedBy != "" && d.VerifiedBy == p.HospitalID {
+		flags = append(flags, "SAME_HOSPITAL")
+	}
+	if !compat.HLARequired {
+		flags = append(flags, "HLA_NOT_REQUIRED")
+	}
+	res, _ := json.Marshal(map[string]interface{}{
+		"matchId":       id,
+		"createdAt":     ts,
+		"hlaScore":      compat.HLAScore,
+		"epletLoad":     eplets.Load,
+		"bloodTypeTier": bloodTypeTier(p.BloodType, d.BloodType),
+		"flags":         flags,
+	})
+	return string(res), nil
+}
+
+// blockingMatch returns the first live match that still references a patient or donor.
+func (s *SmartContract) blockingMatch(ctx contractapi.TransactionContextInterface, refersTo func(*Match) bool) (string, error) {
+	matches, err := s.GetAllMatches(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range matches {
+		if m.Status != "REJECTED" && m.Status != "CANCELLED" && refersTo(m) {
+			return m.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// CascadeDeletePatient archives a patient, cancelling their open matches and
+// returning the reserved organs to the donors.
+func (s *SmartContract) CascadeDeletePatient(ctx contractapi.TransactionContextInterface, id string) (*PatientRemovalSummary, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	adminId, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := getState[Patient](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == StatusArchived {
+		return nil, codedError(CodeRecordArchived, docTypePatient, "", "patient %s is already archived", id)
+	}
+	matches, err := s.GetAllMatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &PatientRemovalSummary{PatientID: id, CancelledMatches: []string{}, RestoredOrgans: []string{}}
+	for _, m := range matches {
+		if m.PatientID != id || terminalMatchStatuses[m.Status] {
+			continue
+		}
+		if err := s.transitionMatch(ctx, m, "CANCELLED", adminId, ReasonPatientRemoved, "patient record deleted"); err != nil {
+			return nil, err
+		}
+		summary.CancelledMatches = append(summary.CancelledMatches, m.ID)
+
+		restored, err := s.restoreOrgan(ctx, m.DonorID, m.OrganType)
+		if err != nil {
+			return nil, err
+		}
+		if restored {
+			summary.RestoredOrgans = append(summary.RestoredOrgans, m.DonorID+":"+m.OrganType)
+		}
+	}
+
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.Status, p.ArchivedAt, p.ArchivedBy, p.ArchiveReason = StatusArchived, ts, caller, "patient record deleted"
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventRecordArchived, map[string]interface{}{
+		"id": id, "docType": docTypePatient, "reason": p.ArchiveReason, "cancelledMatches": summary.CancelledMatches,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
 }
 
+func (s *SmartContract) GetMatchChain(ctx contractapi.TransactionContextInterface, transId string) (*MatchChain, error) {
+	t, err := getState[Transplant](ctx, transId)
+	if err != nil {
+		return nil, err
+	}
+	chain := &MatchChain{Transplant: t, MissingLinks: []string{}}
+
+	patientId, donorId := t.PatientID, t.DonorID
+	m, err := findState[Match](ctx, t.MatchID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		chain.MissingLinks = append(chain.MissingLinks, "match:"+t.MatchID)
+	} else {
+		chain.Match = m
+		patientId, donorId = m.PatientID, m.DonorID
+	}
+
+	p, err := findState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		chain.MissingLinks = append(chain.MissingLinks, "patient:"+patientId)
+	} else {
+		if err := requirePatientVisible(ctx, p); err != nil {
+			return nil, err
+		}
+		chain.Patient = &PatientSummary{ID: p.ID, BloodType: p.BloodType, OrganNeeded: p.OrganNeeded, Status: p.Status, HospitalID: p.HospitalID}
+	}
+
+	d, err := findState[Donor](ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		chain.MissingLinks = append(chain.MissingLinks, "donor:"+donorId)
+	} else {
+		chain.Donor = &DonorSummary{ID: d.ID, BloodType: d.BloodType, VerificationStatus: d.VerificationStatus, VerifiedBy: d.VerifiedBy}
+		chain.ConsentHash = d.ConsentHash
+	}
+	return chain, nil
+}
+
+// GetAllPatients returns the patients the caller may read that have not been archived.
 func (s *SmartContract) GetAllPatients(ctx contractapi.TransactionContextInterface) ([]*Patient, error) {
-	return queryPopulate[Patient](ctx, "PAT-", "PAT-~")
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return visiblePatients(ctx, patients)
 }
 
+// allPatients returns every patient that has not been archived, whichever hospital
+// holds them.
+func allPatients(ctx contractapi.TransactionContextInterface) ([]*Patient, error) {
+	all, err := queryPopulate[Patient](ctx)
+	if err != nil {
+		return nil, err
+	}
+	patients := []*Patient{}
+	for _, p := range all {
+		if p.Status != StatusArchived {
+			patients = append(patients, p)
+		}
+	}
+	return patients, nil
+}
+
+// GetAllDonors returns every donor that has not been archived.
 func (s *SmartContract) GetAllDonors(ctx contractapi.TransactionContextInterface) ([]*Donor, error) {
-	donors, err := queryPopulate[Donor](ctx, "DON-", "DON-~")
-	for _, d := range donors {
+	all, err := queryPopulate[Donor](ctx)
+	if err != nil {
+		return nil, err
+	}
+	donors := []*Donor{}
+	for _, d := range all {
+		if d.VerificationStatus == StatusArchived {
+			continue
+		}
 		if d.OrgansAvailable == nil {
 			d.OrgansAvailable = []string{}
 		}
+		donors = append(donors, d)
 	}
-	return donors, err
+	return donors, nil
 }
 
 func (s *SmartContract) GetAllMatches(ctx contractapi.TransactionContextInterface) ([]*Match, error) {
-	return queryPopulate[Match](ctx, "MATCH-", "MATCH-~")
+	return queryPopulate[Match](ctx)
 }
 
 func (s *SmartContract) GetAllHospitals(ctx contractapi.TransactionContextInterface) ([]*Hospital, error) {
-	return queryPopulate[Hospital](ctx, "HOS", "HOS~") // Matches HOS1 and ADMIN-HOSP (both start with HOS/ADM, queryRange might need care)
+	return queryPopulate[Hospital](ctx)
 }
 
+// RecordExists reports whether any record, of any docType, uses the ID.
 func (s *SmartContract) RecordExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	res, err := ctx.GetStub().GetState(id)
-	return res != nil, err
+	for _, docType := range recordDocTypes {
+		key, err := ctx.GetStub().CreateCompositeKey(docType, []string{id})
+		if err != nil {
+			return false, err
+		}
+		res, err := ctx.GetStub().GetState(key)
+		if err != nil || res != nil {
+			return res != nil, err
+		}
+	}
+	return false, nil
 }
 
-func (s *SmartContract) IsBloodCompatible(recipient, donor string) bool {
-	compatible, exists := BloodCompatibilityMap[recipient]
-	if !exists {
-		return false
+// IsBloodCompatible reports whether an organ from donorType may go to recipientType
+// under ABO/Rh rules. Both must be one of the eight standard blood types.
+func (s *SmartContract) IsBloodCompatible(donorType, recipientType string) (bool, error) {
+	if err := validateBloodType(donorType); err != nil {
+		return false, err
+	}
+	if err := validateBloodType(recipientType); err != nil {
+		return false, err
 	}
-	for _, t := range compatible {
-		if t == donor {
-			return true
+	for _, t := range BloodCompatibilityMap[recipientType] {
+		if t == donorType {
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 func main() {
-	cc, err := contractapi.NewChaincode(&SmartContract{})
+	cc, err := contractapi.NewChaincode(newSmartContract())
 	if err != nil {
 		log.Panicf("Error creating chaincode: %v", err)
 	}
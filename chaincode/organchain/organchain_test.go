@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Two peers endorsing the same proposal must write byte-identical records even when
+// their clocks disagree, so every timestamp has to come from the transaction.
+func TestEndorsersWriteIdenticalRecords(t *testing.T) {
+	peers := []*testLedger{newTestLedger(t), newTestLedger(t)}
+	admin := testCreator(t, "Org1MSP", "role=admin")
+	hospital := testCreator(t, "Org1MSP", "role=hospital,hospitalId=HOSP-001")
+	steps := []struct {
+		creator   []byte
+		transient map[string][]byte
+		args      []string
+	}{
+		{admin, nil, []string{"InitLedger"}},
+		{hospital, nil, []string{"CreatePatient", "PAT-100", "h", "O+", "A2, B8, DR15", "Kidney", "", "URGENT", ""}},
+		{hospital, map[string][]byte{donorPIITransientKey: []byte(`{"name":"Donor"}`)}, []string{"CreateDonor", "DON-100", "O-", "A2, B8, DR15", `["Kidney"]`, "", "consent", "", "", ""}},
+		{hospital, nil, []string{"VerifyDonor", "DON-100", "VERIFIED"}},
+		{hospital, nil, []string{"CreateMatch", "MATCH-100", "PAT-100", "DON-101", "Kidney"}},
+	}
+	for _, step := range steps {
+		for _, l := range peers {
+			l.stub.Creator, l.Transient = step.creator, step.transient
+			l.mustInvoke(step.args[0], step.args[1:]...)
+		}
+	}
+
+	a, b := peers[0].stub, peers[1].stub
+	keys := sortedKeys(a.State)
+	if len(keys) != len(b.State) {
+		t.Fatalf("endorsers wrote %d and %d keys", len(a.State), len(b.State))
+	}
+	for _, key := range keys {
+		if !bytes.Equal(a.State[key], b.State[key]) {
+			t.Errorf("endorsers disagree on %q:\n%s\n%s", key, a.State[key], b.State[key])
+		}
+	}
+	for collection, values := range a.PvtState {
+		for key, value := range values {
+			if !bytes.Equal(value, b.PvtState[collection][key]) {
+				t.Errorf("endorsers disagree on private %s/%s", collection, key)
+			}
+		}
+	}
+
+	// The test clock is months behind the wall clock, so a record stamped with
+	// time.Now() would show here even if both endorsers agreed on it.
+	want := testEpoch.Format(time.RFC3339)
+	if got := peers[0].patient("PAT-100").CreatedAt; got != want {
+		t.Errorf("patient CreatedAt = %s, want the transaction time %s", got, want)
+	}
+	if got := peers[0].match("MATCH-100").CreatedAt; got != want {
+		t.Errorf("match CreatedAt = %s, want the transaction time %s", got, want)
+	}
+}
+
+func TestIsBloodCompatible(t *testing.T) {
+	// compatible[recipient] lists the donor types a recipient may receive from.
+	compatible := map[string]string{
+		"O-":  "O-",
+		"O+":  "O- O+",
+		"A-":  "O- A-",
+		"A+":  "O- O+ A- A+",
+		"B-":  "O- B-",
+		"B+":  "O- O+ B- B+",
+		"AB-": "O- A- B- AB-",
+		"AB+": "O- O+ A- A+ B- B+ AB- AB+",
+	}
+	s := &SmartContract{}
+	for _, recipient := range BloodTypes {
+		allowed := map[string]bool{}
+		for _, donor := range strings.Fields(compatible[recipient]) {
+			allowed[donor] = true
+		}
+		for _, donor := range BloodTypes {
+			got, err := s.IsBloodCompatible(donor, recipient)
+			if err != nil {
+				t.Errorf("IsBloodCompatible(%s, %s) failed: %v", donor, recipient, err)
+			} else if got != allowed[donor] {
+				t.Errorf("IsBloodCompatible(%s, %s) = %v, want %v", donor, recipient, got, allowed[donor])
+			}
+		}
+	}
+}
+
+func TestIsBloodCompatibleRejectsMalformedTypes(t *testing.T) {
+	s := &SmartContract{}
+	for _, tc := range []struct{ donor, recipient string }{
+		{"AB", "A+"},
+		{"O-", "positive"},
+		{"", "O+"},
+		{"o-", "O+"},
+		{"A+ ", "A+"},
+		{"B++", "B+"},
+	} {
+		ok, err := s.IsBloodCompatible(tc.donor, tc.recipient)
+		if err == nil {
+			t.Errorf("IsBloodCompatible(%q, %q) = %v, want an error", tc.donor, tc.recipient, ok)
+			continue
+		}
+		if ce, isCoded := err.(*ChaincodeError); !isCoded || ce.Code != CodeInvalidBloodType {
+			t.Errorf("IsBloodCompatible(%q, %q) error = %v, want %s", tc.donor, tc.recipient, err, CodeInvalidBloodType)
+		}
+	}
+}
+
+func TestCreateMatchRejectsIncompatibleBloodType(t *testing.T) {
+	l := newSeededLedger(t)
+	// DON-102 is AB+ and PAT-003, who needs a heart, is B+.
+	err := l.mustFail("CreateMatch", "MATCH-1", "PAT-003", "DON-102", "Heart")
+	if err.Code != ErrBloodTypeIncompatible {
+		t.Errorf("CreateMatch error = %s %s, want %s", err.Code, err.Message, ErrBloodTypeIncompatible)
+	}
+	if p := l.patient("PAT-003"); p.Status != "WAITING" {
+		t.Errorf("patient status = %s, want WAITING", p.Status)
+	}
+}
+
+func TestCreateMatchReservesTheOrgan(t *testing.T) {
+	l := newSeededLedger(t)
+	// DON-101 (O-) has one kidney to give; PAT-001 and PAT-004 both need one.
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	if d := l.donor("DON-101"); containsString(d.OrgansAvailable, "Kidney") {
+		t.Errorf("kidney still available after the match: %v", d.OrgansAvailable)
+	}
+
+	l.mustFail("CreateMatch", "MATCH-2", "PAT-001", "DON-101", "Kidney")
+	l.mustFail("CreateMatch", "MATCH-3", "PAT-004", "DON-101", "Kidney")
+	if p := l.patient("PAT-004"); p.Status != "WAITING" {
+		t.Errorf("second patient status = %s, want WAITING", p.Status)
+	}
+	for _, id := range []string{"MATCH-2", "MATCH-3"} {
+		if l.record(docTypeMatch, id, &Match{}) {
+			t.Errorf("match %s was written for a reserved organ", id)
+		}
+	}
+	if m := l.match("MATCH-1"); m.Status != "PENDING" {
+		t.Errorf("first match status = %s, want PENDING", m.Status)
+	}
+}
+
+func TestWithdrawDonorConsentReleasesPendingMatches(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+
+	l.mustInvoke("WithdrawDonorConsent", "DON-101")
+	ev := expectEvent(t, l, EventConsentWithdrawn, map[string]string{"donorId": "DON-101"})
+	if rejected, _ := ev["rejectedMatches"].([]interface{}); len(rejected) != 1 || rejected[0] != "MATCH-1" {
+		t.Errorf("ConsentWithdrawn rejectedMatches = %v, want [MATCH-1]", ev["rejectedMatches"])
+	}
+
+	if d := l.donor("DON-101"); d.VerificationStatus != "WITHDRAWN" || len(d.OrgansAvailable) != 0 {
+		t.Errorf("donor = %s %v, want WITHDRAWN with no organs", d.VerificationStatus, d.OrgansAvailable)
+	}
+	if m := l.match("MATCH-1"); m.Status != "REJECTED" || m.ReasonCode != ReasonConsentWithdrawn {
+		t.Errorf("match = %s %s, want REJECTED for %s", m.Status, m.ReasonCode, ReasonConsentWithdrawn)
+	}
+	if p := l.patient("PAT-001"); p.Status != "WAITING" {
+		t.Errorf("patient status = %s, want WAITING", p.Status)
+	}
+
+	l.mustFail("WithdrawDonorConsent", "DON-101")
+	l.mustFail("CreateMatch", "MATCH-2", "PAT-002", "DON-101", "Liver")
+}
+
+func TestCreateMatchChecksReferences(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+
+	// A donor ID where the patient belongs, and the other way round.
+	err := l.mustFail("CreateMatch", "MATCH-1", "DON-101", "PAT-001", "Kidney")
+	if err.Code != CodeValidationFailed || len(err.Errors) != 2 {
+		t.Fatalf("swapped IDs failed with %s %s, want %s on both IDs", err.Code, err.Message, CodeValidationFailed)
+	}
+	for i, field := range []string{"patientId", "donorId"} {
+		if err.Errors[i].Field != field || err.Errors[i].Code != CodeInvalidID {
+			t.Errorf("field error %d = %s %s, want %s on %s", i, err.Errors[i].Code, err.Errors[i].Field, CodeInvalidID, field)
+		}
+	}
+	if err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "PAT-002", "Kidney"); err.Code != CodeInvalidID || err.Field != "donorId" {
+		t.Errorf("a patient as donor failed with %s on %q, want %s on donorId", err.Code, err.Field, CodeInvalidID)
+	}
+
+	// The caller acts for a hospital the ledger does not know.
+	l.asHospital("HOSP-999")
+	if err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney"); err.Code != "HOSPITAL_NOT_FOUND" {
+		t.Errorf("an unknown hospital failed with %s %s, want HOSPITAL_NOT_FOUND", err.Code, err.Message)
+	}
+	if l.record(docTypeMatch, "MATCH-1", &Match{}) {
+		t.Fatal("a rejected CreateMatch wrote MATCH-1")
+	}
+
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	m := l.match("MATCH-1")
+	if m.PatientID != "PAT-001" || m.DonorID != "DON-101" || m.ApprovedBy != "HOSP-001" || m.Status != "PENDING" {
+		t.Errorf("match = %s %s by %s %s, want PAT-001 DON-101 by HOSP-001 PENDING", m.PatientID, m.DonorID, m.ApprovedBy, m.Status)
+	}
+	if p := l.patient("PAT-001"); p.Status != "MATCHED" {
+		t.Errorf("patient status = %s, want MATCHED", p.Status)
+	}
+}
+
+func TestUpdateDonorOrgansRequiresReverification(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	version := fmt.Sprint(l.donor("DON-103").Version)
+
+	l.mustInvoke("UpdateDonor", "DON-103", `["Kidney","Liver"]`, version)
+	d := l.donor("DON-103")
+	if d.VerificationStatus != "PENDING_VERIFICATION" || strings.Join(d.OrgansAvailable, " ") != "Kidney Liver" {
+		t.Fatalf("donor = %s %v, want PENDING_VERIFICATION with a kidney and a liver", d.VerificationStatus, d.OrgansAvailable)
+	}
+	// Until the donor is verified again none of their organs can be matched.
+	l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-103", "Kidney")
+	l.mustFail("UpdateDonor", "DON-103", `["Kidney"]`, version)
+
+	l.mustInvoke("VerifyDonor", "DON-103", "VERIFIED")
+	// Listing the same organs again is not a change.
+	l.mustInvoke("UpdateDonor", "DON-103", `["Liver","Kidney"]`, fmt.Sprint(l.donor("DON-103").Version))
+	if d := l.donor("DON-103"); d.VerificationStatus != "VERIFIED" {
+		t.Errorf("donor status after an unchanged organ list = %s, want VERIFIED", d.VerificationStatus)
+	}
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-103", "Kidney")
+}
+
+func TestCreateMatchRequiresAWaitingPatient(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("RemovePatientFromWaitlist", "PAT-001", RemovalDeceased, "", "", fmt.Sprint(l.patient("PAT-001").Version))
+
+	err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	if err.Code != CodeInvalidTransition {
+		t.Errorf("matching a deceased patient failed with %s %s, want %s", err.Code, err.Message, CodeInvalidTransition)
+	}
+	if p := l.patient("PAT-001"); p.Status != StatusDeceased {
+		t.Errorf("patient status = %s, want %s", p.Status, StatusDeceased)
+	}
+	if d := l.donor("DON-101"); !containsString(d.OrgansAvailable, "Kidney") {
+		t.Errorf("kidney was reserved for a deceased patient: %v", d.OrgansAvailable)
+	}
+}
+
+func TestClosingOneMatchKeepsAPatientWithAnotherOpen(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	if err := l.mustFail("CreateMatch", "MATCH-2", "PAT-001", "DON-103", "Kidney"); err.Code != CodeInvalidTransition {
+		t.Errorf("a second match for a MATCHED patient failed with %s %s, want %s", err.Code, err.Message, CodeInvalidTransition)
+	}
+
+	// A patient matched twice before CreateMatch required WAITING.
+	p := l.patient("PAT-001")
+	p.Status = "WAITING"
+	l.put(docTypePatient, p.ID, p)
+	l.mustInvoke("CreateMatch", "MATCH-2", "PAT-001", "DON-103", "Kidney")
+
+	l.mustInvoke("RejectMatch", "MATCH-1", ReasonOrganQuality, "biopsy findings", "1")
+	if p := l.patient("PAT-001"); p.Status != "MATCHED" {
+		t.Errorf("patient status after one of two matches closed = %s, want MATCHED", p.Status)
+	}
+	l.mustInvoke("WithdrawDonorConsent", "DON-103")
+	if p := l.patient("PAT-001"); p.Status != "WAITING" {
+		t.Errorf("patient status after both matches closed = %s, want WAITING", p.Status)
+	}
+}
+
+func TestClearLedgerKeepsOnlyConfiguration(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	l.put(docTypeTransplant, "TRANS-MATCH-0", &Transplant{ID: "TRANS-MATCH-0", DocType: docTypeTransplant})
+	l.put(docTypePair, "PAIR-1", map[string]string{"id": "PAIR-1", "docType": docTypePair})
+	l.put(docTypeChain, "KPE-1", map[string]string{"id": "KPE-1", "docType": docTypeChain})
+	l.put(docTypeRegistry, "REG-1", map[string]string{"id": "REG-1", "docType": docTypeRegistry})
+
+	l.stub.ChannelID = "organchannel"
+	l.as("Org1MSP", "role=admin")
+	l.mustFail("ClearLedger", "otherchannel")
+	l.mustInvoke("ClearLedger", "organchannel")
+
+	left := map[string]int{}
+	for key := range l.stub.State {
+		docType, _, err := l.stub.SplitCompositeKey(key)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		left[docType]++
+	}
+	for docType, n := range left {
+		if !configDocTypes[docType] {
+			t.Errorf("ClearLedger left %d %s keys", n, docType)
+		}
+	}
+	if left[docTypeHospital] != 2 {
+		t.Errorf("ClearLedger left %d hospitals, want the 2 seeded", left[docTypeHospital])
+	}
+}
+
+func TestUpdateDonorStatusRemovesEveryListing(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	// A donor listed before organ lists were checked for repeats.
+	d := l.donor("DON-101")
+	d.OrgansAvailable = []string{"Kidney", "Liver", "Kidney"}
+	l.put(docTypeDonor, d.ID, d)
+
+	l.mustInvoke("UpdateDonorStatus", "DON-101", "Kidney", fmt.Sprint(d.Version))
+	if got := l.donor("DON-101").OrgansAvailable; strings.Join(got, " ") != "Liver" {
+		t.Errorf("organs = %v, want only the liver", got)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Organ statuses. An organ is AVAILABLE while it is listed on its donor, RESERVED once
+// a match holds it, and then follows recovery and transport until it is TRANSPLANTED
+// or DISCARDED.
+const (
+	OrganAvailable    = "AVAILABLE"
+	OrganReserved     = "RESERVED"
+	OrganRecovered    = "RECOVERED"
+	OrganInTransit    = "IN_TRANSIT"
+	OrganTransplanted = "TRANSPLANTED"
+	OrganDiscarded    = "DISCARDED"
+)
+
+// organTransitions lists the statuses each organ status may move to. An organ goes back
+// to AVAILABLE when the match holding it is rejected or cancelled.
+var organTransitions = map[string][]string{
+	OrganAvailable: {OrganReserved, OrganDiscarded},
+	OrganReserved:  {OrganAvailable, OrganRecovered, OrganTransplanted, OrganDiscarded},
+	OrganRecovered: {OrganAvailable, OrganInTransit, OrganTransplanted, OrganDiscarded},
+	OrganInTransit: {OrganAvailable, OrganTransplanted, OrganDiscarded},
+}
+
+// Organ tracks one donated organ through allocation, recovery and transport. The
+// donor's OrgansAvailable lists the organ types whose records are still AVAILABLE.
+type Organ struct {
+	ID            string `json:"id"`
+	DonorID       string `json:"donorId"`
+	OrganType     string `json:"organType"`
+	Status        string `json:"status"`
+	MatchID       string `json:"matchId"`
+	OfferID       string `json:"offerId,omitempty" metadata:",optional"`
+	DocType       string `json:"docType"`
+	SchemaVersion int    `json:"schemaVersion"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+	UpdatedBy     string `json:"updatedBy"`
+	// RecoveredAt starts the cold ischemia clock; it is kept if the organ is released
+	// and matched again.
+	RecoveredAt string `json:"recoveredAt,omitempty" metadata:",optional"`
+	ViableUntil string `json:"viableUntil,omitempty" metadata:",optional"`
+}
+
+// OrganViability reports how much of an organ's viability window is left. Organs not
+// yet recovered have the full window of the current policy remaining.
+type OrganViability struct {
+	OrganID          string `json:"organId"`
+	OrganType        string `json:"organType"`
+	Status           string `json:"status"`
+	Recovered        bool   `json:"recovered"`
+	RecoveredAt      string `json:"recoveredAt"`
+	ViableUntil      string `json:"viableUntil"`
+	ViabilityHours   int    `json:"viabilityHours"`
+	RemainingMinutes int    `json:"remainingMinutes"`
+	Expired          bool   `json:"expired"`
+}
+
+// organID is the ORG- key of a donor's organ; a donor lists each organ type once.
+func organID(donorId, organType string) string {
+	return "ORG-" + donorId + "-" + organType
+}
+
+// syncDonorOrgans brings a donor's organ records in line with OrgansAvailable: listed
+// organs without a record get an AVAILABLE one, and AVAILABLE records no longer listed
+// are removed. Organs held by a match or already used cannot be listed again.
+func (s *SmartContract) syncDonorOrgans(ctx contractapi.TransactionContextInterface, d *Donor) error {
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	for _, organType := range Organs {
+		id := organID(d.ID, organType)
+		o, err := findState[Organ](ctx, id)
+		if err != nil {
+			return err
+		}
+		listed := containsString(d.OrgansAvailable, organType)
+		switch {
+		case o == nil && listed:
+			err = putState(ctx, id, &Organ{
+				ID: id, DonorID: d.ID, OrganType: organType, Status: OrganAvailable,
+				DocType: docTypeOrgan, CreatedAt: ts, UpdatedAt: ts,
+			})
+		case o != nil && listed && o.Status != OrganAvailable:
+			err = codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s is %s and cannot be listed as available", id, o.Status)
+		case o != nil && !listed && o.Status == OrganAvailable:
+			err = delState[Organ](ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOrganStatus moves a donor's organ to a new status and saves it.
+func (s *SmartContract) setOrganStatus(ctx contractapi.TransactionContextInterface, donorId, organType, to, matchId, actor string) error {
+	o, err := s.transitionOrgan(ctx, donorId, organType, to, matchId, actor)
+	if err != nil {
+		return err
+	}
+	return putState(ctx, o.ID, o)
+}
+
+// transitionOrgan returns a donor's organ moved to a new status, leaving the caller to
+// save it. Organs listed before organ records existed get a record directly in the new
+// status.
+func (s *SmartContract) transitionOrgan(ctx contractapi.TransactionContextInterface, donorId, organType, to, matchId, actor string) (*Organ, error) {
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := organID(donorId, organType)
+	o, err := findState[Organ](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		o = &Organ{ID: id, DonorID: donorId, OrganType: organType, Status: to, DocType: docTypeOrgan, CreatedAt: ts}
+	} else if !containsString(organTransitions[o.Status], to) {
+		return nil, codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s cannot move from %s to %s", id, o.Status, to)
+	}
+	o.Status, o.UpdatedAt, o.UpdatedBy = to, ts, actor
+	if to == OrganAvailable {
+		o.MatchID, o.OfferID = "", ""
+	} else if matchId != "" {
+		o.MatchID = matchId
+	}
+	return o, nil
+}
+
+// deleteDonorOrgans removes every organ record of a donor that is being deleted.
+func deleteDonorOrgans(ctx contractapi.TransactionContextInterface, donorId string) error {
+	for _, organType := range Organs {
+		if err := delState[Organ](ctx, organID(donorId, organType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SmartContract) GetOrgan(ctx contractapi.TransactionContextInterface, id string) (*Organ, error) {
+	return getState[Organ](ctx, id)
+}
+
+// GetDonorOrgans returns every tracked organ of a donor, whatever its status.
+func (s *SmartContract) GetDonorOrgans(ctx contractapi.TransactionContextInterface, donorId string) ([]*Organ, error) {
+	organs := []*Organ{}
+	for _, organType := range Organs {
+		o, err := findState[Organ](ctx, organID(donorId, organType))
+		if err != nil {
+			return nil, err
+		}
+		if o != nil {
+			organs = append(organs, o)
+		}
+	}
+	return organs, nil
+}
+
+// UpdateOrganStatus records transport or disposal of an organ. Recovery is recorded with
+// RecordOrganRecovery, and reservation, release and transplant follow the match. An
+// organ held by a live match can be discarded only once that match is cancelled.
+func (s *SmartContract) UpdateOrganStatus(ctx contractapi.TransactionContextInterface, organId, status string) error {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return err
+	}
+	if status != OrganInTransit && status != OrganDiscarded {
+		return codedError(CodeInvalidArgument, "", "status", "invalid status %q: must be %s", status, strings.Join([]string{OrganInTransit, OrganDiscarded}, ", "))
+	}
+	o, err := getState[Organ](ctx, organId)
+	if err != nil {
+		return err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return wrapError(err, "cannot update organ")
+	}
+	if status == OrganDiscarded && o.MatchID != "" {
+		m, err := findState[Match](ctx, o.MatchID)
+		if err != nil {
+			return err
+		}
+		if m != nil && !terminalMatchStatuses[m.Status] {
+			return codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s is held by match %s; cancel the match first", organId, m.ID)
+		}
+	}
+	if status == OrganDiscarded && o.OfferID != "" {
+		return codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s is under offer %s; decline or expire the offer first", organId, o.OfferID)
+	}
+	wasAvailable := o.Status == OrganAvailable
+
+	if err := s.setOrganStatus(ctx, o.DonorID, o.OrganType, status, "", hospitalId); err != nil {
+		return err
+	}
+	if wasAvailable {
+		d, err := findState[Donor](ctx, o.DonorID)
+		if err != nil {
+			return err
+		}
+		if d != nil && removeOrgan(d, o.OrganType) {
+			if err := putState(ctx, d.ID, d); err != nil {
+				return err
+			}
+		}
+	}
+	return emitEvent(ctx, EventOrganStatusChanged, map[string]string{
+		"organId": organId, "donorId": o.DonorID, "organType": o.OrganType, "status": status, "hospitalId": hospitalId,
+	})
+}
+
+// RecordOrganRecovery marks a reserved organ as recovered at recoveredAt (RFC3339) and
+// starts its viability window from the organ policy.
+func (s *SmartContract) RecordOrganRecovery(ctx contractapi.TransactionContextInterface, organId, recoveredAt string) (*Organ, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	o, err := getState[Organ](ctx, organId)
+	if err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot record recovery")
+	}
+	recovered, err := parseTimestamp(recoveredAt)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if recovered.After(*now) {
+		return nil, codedError(CodeInvalidArgument, "", "recoveredAt", "recovery time %s is in the future", recoveredAt)
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if o, err = s.transitionOrgan(ctx, o.DonorID, o.OrganType, OrganRecovered, "", hospitalId); err != nil {
+		return nil, err
+	}
+	d, err := findState[Donor](ctx, o.DonorID)
+	if err != nil {
+		return nil, err
+	}
+	o.RecoveredAt = recovered.Format(time.RFC3339)
+	o.ViableUntil = recovered.Add(viableDuration(d, cfg.organPolicy(o.OrganType).ViabilityHours)).Format(time.RFC3339)
+	if err := putState(ctx, organId, o); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventOrganStatusChanged, map[string]string{
+		"organId": organId, "donorId": o.DonorID, "organType": o.OrganType, "status": OrganRecovered,
+		"hospitalId": hospitalId, "viableUntil": o.ViableUntil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetOrganViability reports an organ's remaining viability as of the transaction time.
+func (s *SmartContract) GetOrganViability(ctx contractapi.TransactionContextInterface, organId string) (*OrganViability, error) {
+	o, err := getState[Organ](ctx, organId)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return organViability(cfg, o, *now), nil
+}
+
+func organViability(cfg *PolicyConfig, o *Organ, now time.Time) *OrganViability {
+	hours := cfg.organPolicy(o.OrganType).ViabilityHours
+	v := &OrganViability{
+		OrganID: o.ID, OrganType: o.OrganType, Status: o.Status,
+		RecoveredAt: o.RecoveredAt, ViableUntil: o.ViableUntil,
+		ViabilityHours: hours, RemainingMinutes: hours * 60,
+	}
+	recovered, errR := parseTimestamp(o.RecoveredAt)
+	until, errU := parseTimestamp(o.ViableUntil)
+	if errR != nil || errU != nil {
+		return v
+	}
+	// A recovered organ keeps the window that applied when it was recovered.
+	v.Recovered = true
+	v.ViabilityHours = int(until.Sub(recovered).Hours())
+	v.RemainingMinutes = int(until.Sub(now).Minutes())
+	if v.RemainingMinutes <= 0 {
+		v.RemainingMinutes, v.Expired = 0, true
+	}
+	return v
+}
+
+// requireViableOrgan rejects a donor's organ whose viability window has passed.
+// Organs without a record have not been recovered and are always viable.
+func (s *SmartContract) requireViableOrgan(ctx contractapi.TransactionContextInterface, cfg *PolicyConfig, donorId, organType string) error {
+	o, err := findState[Organ](ctx, organID(donorId, organType))
+	if err != nil || o == nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if v := organViability(cfg, o, *now); v.Expired {
+		return codedError(CodeInvalidTransition, docTypeOrgan, "", "organ %s is no longer viable: its window ended at %s", o.ID, o.ViableUntil)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PatientUpdate holds the fields UpdatePatient may correct. A field left out is kept
+// as it is. Urgency, sensitization and status have their own functions, and a
+// different organ is a new listing.
+type PatientUpdate struct {
+	NameHash     *string `json:"nameHash"`
+	IdentityHash *string `json:"identityHash"`
+	BloodType    *string `json:"bloodType"`
+	HLA          *string `json:"hla"`
+	IPFSHash     *string `json:"ipfsHash"`
+}
+
+// PatientFieldChange is one field changed by UpdatePatient. HLA typings are recorded
+// in their JSON form.
+type PatientFieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// PatientChange is one UpdatePatient call: the fields it changed, why, and the
+// version of the record it produced.
+type PatientChange struct {
+	Version    int                   `json:"version"`
+	Changes    []*PatientFieldChange `json:"changes"`
+	Reason     string                `json:"reason"`
+	HospitalID string                `json:"hospitalId"`
+	ChangedBy  string                `json:"changedBy"`
+	ChangedAt  string                `json:"changedAt"`
+}
+
+// UpdatePatient corrects a patient's record from updateJSON, a PatientUpdate, and
+// appends the changes and reason to the patient's ChangeLog. Blood type and HLA
+// typing cannot change while a match is open on the patient, since the match was
+// scored against the old values. Only the patient's hospital (or the admin hospital)
+// may update them.
+func (s *SmartContract) UpdatePatient(ctx contractapi.TransactionContextInterface, patientId, updateJSON, reason string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to update a patient")
+	}
+	var update PatientUpdate
+	dec := json.NewDecoder(strings.NewReader(updateJSON))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&update); err != nil {
+		return nil, codedError(CodeInvalidArgument, "", "update", "update must be a JSON object of nameHash, identityHash, bloodType, hla and ipfsHash: %v", err)
+	}
+	var typing HLATyping
+	var hlaErr error
+	if update.HLA != nil {
+		if strings.TrimSpace(*update.HLA) == "" {
+			hlaErr = codedError(CodeInvalidHLA, "", "hla", "an HLA typing cannot be removed")
+		} else {
+			typing, hlaErr = parseHLATyping(*update.HLA)
+		}
+	}
+	var bloodErr, identityErr error
+	if update.BloodType != nil {
+		bloodErr = validateBloodType(*update.BloodType)
+	}
+	if update.IdentityHash != nil {
+		identityErr = validateIdentityHash("identityHash", *update.IdentityHash)
+	}
+	if err := validateFields(bloodErr, hlaErr, identityErr); err != nil {
+		return nil, err
+	}
+
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot update patient")
+	}
+	clinical := update.BloodType != nil && *update.BloodType != p.BloodType
+	changes := []*PatientFieldChange{}
+	set := func(field string, to *string, current *string) {
+		if to != nil && *to != *current {
+			changes = append(changes, &PatientFieldChange{Field: field, From: *current, To: *to})
+			*current = *to
+		}
+	}
+	set("nameHash", update.NameHash, &p.NameHash)
+	set("identityHash", update.IdentityHash, &p.IdentityHash)
+	set("bloodType", update.BloodType, &p.BloodType)
+	set("ipfsHash", update.IPFSHash, &p.IPFSHash)
+	if update.HLA != nil {
+		from, err := json.Marshal(p.HLA)
+		if err != nil {
+			return nil, err
+		}
+		to, err := json.Marshal(typing)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(from, to) {
+			changes = append(changes, &PatientFieldChange{Field: "hla", From: string(from), To: string(to)})
+			p.HLA = typing
+			clinical = true
+		}
+	}
+	if len(changes) == 0 {
+		return nil, codedError(CodeInvalidArgument, docTypePatient, "", "nothing to update for patient %s", p.ID)
+	}
+	if clinical {
+		open, err := matchesByIndex(ctx, indexMatchPatient, p.ID, func(m *Match) bool { return !terminalMatchStatuses[m.Status] })
+		if err != nil {
+			return nil, err
+		}
+		if len(open) > 0 {
+			return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s has open match %s; close it before changing blood type or HLA", p.ID, open[0].ID)
+		}
+	}
+
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.ChangeLog = append(p.ChangeLog, &PatientChange{
+		Version: p.Version + 1, Changes: changes, Reason: reason, HospitalID: hospitalId,
+		ChangedBy: actor.ID, ChangedAt: now.Format(time.RFC3339),
+	})
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(changes))
+	for i, c := range changes {
+		fields[i] = c.Field
+	}
+	return p, emitEvent(ctx, EventPatientUpdated, map[string]interface{}{
+		"patientId": p.ID, "fields": fields, "changedBy": hospitalId, "reason": reason, "version": p.Version,
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	policyConfigKey           = "POLICY-CONFIG"
+	defaultReverificationDays = 365
+
+	// ErrBloodTypeIncompatible is the error code of ABO/Rh rejections, and prefixes
+	// them in compatibility reasons, so clients can tell them apart from other failures.
+	ErrBloodTypeIncompatible = "BLOOD_TYPE_INCOMPATIBLE"
+	// CodeIncompatible is the error code of every other compatibility failure; the
+	// message lists the reasons.
+	CodeIncompatible = "INCOMPATIBLE"
+)
+
+// OrganPolicy holds the allocation rules for a single organ type. ViabilityHours is how
+// long the organ stays usable after recovery.
+type OrganPolicy struct {
+	RequiresHLA    bool `json:"requiresHLA"`
+	MinHLAScore    int  `json:"minHLAScore"`
+	ViabilityHours int  `json:"viabilityHours"`
+}
+
+// defaultViabilityHours are conservative cold ischemia limits per organ type.
+var defaultViabilityHours = map[string]int{
+	"Heart": 4, "Lung": 6, "Liver": 12, "Pancreas": 12, "Intestine": 8, "Kidney": 24, "Cornea": 336,
+}
+
+// PolicyConfig is the on-chain allocation policy, keyed by organ type.
+type PolicyConfig struct {
+	Organs             map[string]OrganPolicy `json:"organs"`
+	ReverificationDays int                    `json:"reverificationDays"`
+	DocType            string                 `json:"docType"`
+	SchemaVersion      int                    `json:"schemaVersion"`
+	UpdatedAt          string                 `json:"updatedAt"`
+}
+
+// CompatibilityResult explains whether a donor organ may be matched to a patient.
+type CompatibilityResult struct {
+	PatientID       string `json:"patientId"`
+	DonorID         string `json:"donorId"`
+	OrganType       string `json:"organType"`
+	BloodCompatible bool   `json:"bloodCompatible"`
+	OrganAvailable  bool   `json:"organAvailable"`
+	HLAScore        int    `json:"hlaScore"`
+	HLARequired     bool   `json:"hlaRequired"`
+	MinHLAScore     int    `json:"minHLAScore"`
+	// ConflictingAntigens are donor antigens the patient has antibodies against.
+	ConflictingAntigens []string `json:"conflictingAntigens"`
+	Compatible          bool     `json:"compatible"`
+	Reasons             []string `json:"reasons"`
+	// EpletMismatch is reported by CheckCompatibility alongside the antigen-level
+	// HLAScore; it does not decide compatibility.
+	EpletMismatch *EpletMismatch `json:"epletMismatch,omitempty" metadata:",optional"`
+}
+
+func defaultPolicyConfig() *PolicyConfig {
+	return &PolicyConfig{
+		Organs: map[string]OrganPolicy{
+			"Kidney":    {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Kidney"]},
+			"Liver":     {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Liver"]},
+			"Heart":     {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Heart"]},
+			"Lung":      {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Lung"]},
+			"Pancreas":  {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Pancreas"]},
+			"Intestine": {RequiresHLA: true, ViabilityHours: defaultViabilityHours["Intestine"]},
+			"Cornea":    {RequiresHLA: false, ViabilityHours: defaultViabilityHours["Cornea"]},
+		},
+		ReverificationDays: defaultReverificationDays,
+		DocType:            "policy",
+	}
+}
+
+func (s *SmartContract) GetPolicyConfig(ctx contractapi.TransactionContextInterface) (*PolicyConfig, error) {
+	cfg, err := findState[PolicyConfig](ctx, policyConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return defaultPolicyConfig(), nil
+	}
+	if cfg.ReverificationDays <= 0 {
+		cfg.ReverificationDays = defaultReverificationDays
+	}
+	return cfg, nil
+}
+
+func (s *SmartContract) SetOrganPolicy(ctx contractapi.TransactionContextInterface, organType string, requiresHLA bool, minHLAScore int) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if err := validateOrgan(organType); err != nil {
+		return err
+	}
+	if minHLAScore < 0 || minHLAScore > 6 {
+		return codedError(CodeInvalidArgument, "", "minHLAScore", "minimum HLA score must be between 0 and 6")
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	policy := cfg.organPolicy(organType)
+	policy.RequiresHLA, policy.MinHLAScore = requiresHLA, minHLAScore
+	cfg.Organs[organType] = policy
+	if cfg.UpdatedAt, err = s.getTimestamp(ctx); err != nil {
+		return err
+	}
+	if err := putState(ctx, policyConfigKey, cfg); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPolicyUpdated, map[string]interface{}{
+		"organType": organType, "requiresHLA": requiresHLA, "minHLAScore": minHLAScore,
+	})
+}
+
+func (s *SmartContract) SetReverificationWindow(ctx contractapi.TransactionContextInterface, days int) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if days <= 0 {
+		return codedError(CodeInvalidArgument, "", "days", "reverification window must be a positive number of days")
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	cfg.ReverificationDays = days
+	if cfg.UpdatedAt, err = s.getTimestamp(ctx); err != nil {
+		return err
+	}
+	if err := putState(ctx, policyConfigKey, cfg); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPolicyUpdated, map[string]interface{}{"reverificationDays": days})
+}
+
+// SetViabilityWindow sets how many hours an organ type stays usable after recovery.
+func (s *SmartContract) SetViabilityWindow(ctx contractapi.TransactionContextInterface, organType string, hours int) error {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return err
+	}
+	if err := validateOrgan(organType); err != nil {
+		return err
+	}
+	if hours <= 0 {
+		return codedError(CodeInvalidArgument, "", "hours", "viability window must be a positive number of hours")
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	policy := cfg.organPolicy(organType)
+	policy.ViabilityHours = hours
+	cfg.Organs[organType] = policy
+	if cfg.UpdatedAt, err = s.getTimestamp(ctx); err != nil {
+		return err
+	}
+	if err := putState(ctx, policyConfigKey, cfg); err != nil {
+		return err
+	}
+	return emitEvent(ctx, EventPolicyUpdated, map[string]interface{}{"organType": organType, "viabilityHours": hours})
+}
+
+// organPolicy returns the rules for an organ; organs without an entry require HLA
+// matching, and policies stored before viability windows existed use the defaults.
+func (cfg *PolicyConfig) organPolicy(organType string) OrganPolicy {
+	p, ok := cfg.Organs[organType]
+	if !ok {
+		p = OrganPolicy{RequiresHLA: true}
+	}
+	if p.ViabilityHours <= 0 {
+		p.ViabilityHours = defaultViabilityHours[organType]
+	}
+	return p
+}
+
+func (s *SmartContract) CheckCompatibility(ctx contractapi.TransactionContextInterface, patientId, donorId, organType string) (*CompatibilityResult, error) {
+	p, errP := getState[Patient](ctx, patientId)
+	d, errD := s.GetDonor(ctx, donorId)
+	if errP != nil {
+		return nil, errP
+	}
+	if errD != nil {
+		return nil, errD
+	}
+	if err := requirePatientVisible(ctx, p); err != nil {
+		return nil, err
+	}
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := s.evaluateCompatibility(cfg, p, d, organType, *now)
+	if res.EpletMismatch, err = s.epletMismatch(ctx, p, d); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SmartContract) evaluateCompatibility(cfg *PolicyConfig, p *Patient, d *Donor, organType string, now time.Time) *CompatibilityResult {
+	policy := cfg.organPolicy(organType)
+	res := &CompatibilityResult{
+		PatientID: p.ID, DonorID: d.ID, OrganType: organType,
+		HLARequired:         policy.RequiresHLA,
+		MinHLAScore:         policy.MinHLAScore,
+		ConflictingAntigens: unacceptableDonorAntigens(p, d),
+		Reasons:             []string{},
+	}
+	for _, o := range d.OrgansAvailable {
+		if o == organType {
+			res.OrganAvailable = true
+			break
+		}
+	}
+
+	// The score is always computed for the record, but a missing typing only
+	// blocks organs whose policy requires HLA matching.
+	score, err := hlaScore(p.HLA, d.HLA)
+	res.HLAScore = score
+	if err != nil && res.HLARequired {
+		res.Reasons = append(res.Reasons, errorMessage(err))
+	}
+
+	compatible, err := s.IsBloodCompatible(d.BloodType, p.BloodType)
+	res.BloodCompatible = compatible
+	if err != nil {
+		res.Reasons = append(res.Reasons, errorMessage(err))
+	} else if !compatible {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("%s: donor blood type %s cannot be given to recipient %s", ErrBloodTypeIncompatible, d.BloodType, p.BloodType))
+	}
+	if !res.OrganAvailable {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("organ %s not available from donor %s", organType, d.ID))
+	}
+	if p.OrganNeeded != organType {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("patient %s needs a %s, not a %s", p.ID, p.OrganNeeded, organType))
+	}
+	if d.DonorType == "" {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("donor %s has not been classified as LIVING, DBD or DCD", d.ID))
+	}
+	if (d.DonorType == DonorDBD || d.DonorType == DonorDCD) && !d.DeathConfirmed {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("death of donor %s has not been confirmed by two physicians", d.ID))
+	}
+	if problem := consentProblem(d, organType, now); problem != "" {
+		res.Reasons = append(res.Reasons, problem)
+	}
+	if !d.ScreeningCleared {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("donor %s has not cleared infectious disease screening", d.ID))
+	}
+	if len(res.ConflictingAntigens) > 0 {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("donor carries unacceptable antigens %s", strings.Join(res.ConflictingAntigens, ", ")))
+	}
+	if res.HLARequired && res.HLAScore < res.MinHLAScore {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("HLA score %d below required %d", res.HLAScore, res.MinHLAScore))
+	}
+	res.Compatible = len(res.Reasons) == 0
+	return res
+}
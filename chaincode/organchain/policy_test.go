@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	tests := []struct {
+		name, patient, donor, organ string
+		compatible                  bool
+		reason                      string
+	}{
+		{"kidney for a kidney patient", "PAT-001", "DON-101", "Kidney", true, ""},
+		{"liver for a liver patient", "PAT-002", "DON-101", "Liver", true, ""},
+		{"wrong organ", "PAT-001", "DON-101", "Liver", false, "needs a Kidney, not a Liver"},
+		{"organ the donor lacks", "PAT-001", "DON-102", "Kidney", false, "not available from donor DON-102"},
+		{"incompatible blood", "PAT-003", "DON-102", "Heart", false, ErrBloodTypeIncompatible},
+	}
+	l := newSeededLedger(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var res CompatibilityResult
+			l.mustInvokeJSON(&res, "CheckCompatibility", tc.patient, tc.donor, tc.organ)
+			reasons := strings.Join(res.Reasons, "; ")
+			if res.Compatible != tc.compatible {
+				t.Errorf("compatible = %v (%s), want %v", res.Compatible, reasons, tc.compatible)
+			}
+			if !strings.Contains(reasons, tc.reason) {
+				t.Errorf("reasons = %q, want one containing %q", reasons, tc.reason)
+			}
+		})
+	}
+}
+
+func TestCreateMatchRejectsTheWrongOrgan(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	// PAT-001 needs a kidney; DON-101 also has a liver to give.
+	if err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Liver"); err.Code != CodeIncompatible {
+		t.Errorf("CreateMatch error = %s %s, want %s", err.Code, err.Message, CodeIncompatible)
+	}
+	if d := l.donor("DON-101"); !containsString(d.OrgansAvailable, "Liver") {
+		t.Errorf("liver was reserved for a kidney patient: %v", d.OrgansAvailable)
+	}
+	if p := l.patient("PAT-001"); p.Status != "WAITING" {
+		t.Errorf("patient status = %s, want WAITING", p.Status)
+	}
+}
+
+func TestCreateMatchReportsMalformedBloodTypes(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	// A record written before blood types were validated.
+	p := l.patient("PAT-001")
+	p.BloodType = "A"
+	l.put(docTypePatient, p.ID, p)
+
+	err := l.mustFail("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	if err.Code != CodeInvalidArgument || err.Field != "bloodType" {
+		t.Errorf("CreateMatch error = %s on %q (%s), want %s on bloodType", err.Code, err.Field, err.Message, CodeInvalidArgument)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxPageSize caps a single paginated read so one call cannot pull the whole registry.
+const maxPageSize = 200
+
+// Rich queries need CouchDB as the state database. The indexes they rely on ship in
+// META-INF/statedb/couchdb/indexes and are deployed with the chaincode, e.g.
+//
+//	{"index":{"fields":["docType","bloodType","verificationStatus"]},"ddoc":"indexDonorDoc","name":"indexDonor","type":"json"}
+//	{"index":{"fields":["docType","bloodType","organNeeded","status"]},"ddoc":"indexPatientDoc","name":"indexPatient","type":"json"}
+//	{"index":{"fields":["docType","hospitalId","status"]},"ddoc":"indexPatientHospitalDoc","name":"indexPatientHospital","type":"json"}
+
+func richQuery[T any](ctx contractapi.TransactionContextInterface, query string) ([]*T, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(query)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	items := []*T{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var item T
+		if err := json.Unmarshal(queryResponse.Value, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, nil
+}
+
+// notArchived is the selector condition queries apply to a record's status field
+// unless the caller filters on status themselves.
+var notArchived = map[string]interface{}{"$ne": StatusArchived}
+
+// buildSelector returns a CouchDB query for a docType, skipping empty field filters.
+func buildSelector(docType string, fields map[string]interface{}) (string, error) {
+	selector := map[string]interface{}{"docType": docType}
+	for k, v := range fields {
+		if str, ok := v.(string); ok && str == "" {
+			continue
+		}
+		selector[k] = v
+	}
+	bytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	return string(bytes), err
+}
+
+func (s *SmartContract) QueryDonors(ctx contractapi.TransactionContextInterface, bloodType, organ, verificationStatus string) ([]*Donor, error) {
+	fields := map[string]interface{}{"bloodType": bloodType, "verificationStatus": verificationStatus}
+	if verificationStatus == "" {
+		fields["verificationStatus"] = notArchived
+	}
+	if organ != "" {
+		fields["organsAvailable"] = map[string]interface{}{"$elemMatch": map[string]string{"$eq": organ}}
+	}
+	query, err := buildSelector("donor", fields)
+	if err != nil {
+		return nil, err
+	}
+	donors, err := richQuery[Donor](ctx, query)
+	for _, d := range donors {
+		if d.OrgansAvailable == nil {
+			d.OrgansAvailable = []string{}
+		}
+	}
+	return donors, err
+}
+
+func (s *SmartContract) QueryPatients(ctx contractapi.TransactionContextInterface, bloodType, organNeeded, status string) ([]*Patient, error) {
+	fields := map[string]interface{}{"bloodType": bloodType, "organNeeded": organNeeded, "status": status}
+	if status == "" {
+		fields["status"] = notArchived
+	}
+	query, err := buildSelector("patient", fields)
+	if err != nil {
+		return nil, err
+	}
+	patients, err := richQuery[Patient](ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return visiblePatients(ctx, patients)
+}
+
+// QueryWaitingPatients returns the patients needing an organ, optionally only those of
+// one blood type, in a given status (WAITING if empty), ordered as on the waitlist. It
+// reads the patient index rather than a rich query, so it also works on LevelDB.
+func (s *SmartContract) QueryWaitingPatients(ctx contractapi.TransactionContextInterface, organNeeded, bloodType, status string) ([]*Patient, error) {
+	if status == "" {
+		status = "WAITING"
+	}
+	checks := []error{validateOrgan(organNeeded)}
+	if bloodType != "" {
+		checks = append(checks, validateBloodType(bloodType))
+	}
+	if err := validateFields(checks...); err != nil {
+		return nil, err
+	}
+	prefix := []string{organNeeded}
+	if bloodType != "" {
+		prefix = append(prefix, bloodType, status)
+	}
+	indexed, err := indexedRecords[Patient](ctx, indexPatientOrgan, prefix...)
+	if err != nil {
+		return nil, err
+	}
+	if indexed, err = visiblePatients(ctx, indexed); err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patients := []*Patient{}
+	for _, p := range indexed {
+		if p.OrganNeeded != organNeeded || p.Status != status || (bloodType != "" && p.BloodType != bloodType) {
+			continue
+		}
+		patients = append(patients, p)
+	}
+	sortWaitlist(patients, *now)
+	return patients, nil
+}
+
+// QueryDonorsByOrgan returns the verified donors who have an organ available,
+// optionally only those of one blood type. Like QueryWaitingPatients it reads an index
+// rather than running a rich query.
+func (s *SmartContract) QueryDonorsByOrgan(ctx contractapi.TransactionContextInterface, organ, bloodType string) ([]*Donor, error) {
+	checks := []error{validateOrgan(organ)}
+	if bloodType != "" {
+		checks = append(checks, validateBloodType(bloodType))
+	}
+	if err := validateFields(checks...); err != nil {
+		return nil, err
+	}
+	prefix := []string{organ, "VERIFIED"}
+	if bloodType != "" {
+		prefix = append(prefix, bloodType)
+	}
+	indexed, err := indexedRecords[Donor](ctx, indexDonorOrgan, prefix...)
+	if err != nil {
+		return nil, err
+	}
+	donors := []*Donor{}
+	for _, d := range indexed {
+		if d.VerificationStatus != "VERIFIED" || !containsString(d.OrgansAvailable, organ) || (bloodType != "" && d.BloodType != bloodType) {
+			continue
+		}
+		donors = append(donors, d)
+	}
+	return donors, nil
+}
+
+// GetMatchesByPatient returns every match proposed for a patient, oldest first.
+func (s *SmartContract) GetMatchesByPatient(ctx contractapi.TransactionContextInterface, patientId string) ([]*Match, error) {
+	if err := validateID("patientId", patientIDPrefix, patientId); err != nil {
+		return nil, err
+	}
+	return matchesByIndex(ctx, indexMatchPatient, patientId, func(m *Match) bool { return m.PatientID == patientId })
+}
+
+// GetMatchesByDonor returns every match that uses one of a donor's organs, oldest first.
+func (s *SmartContract) GetMatchesByDonor(ctx contractapi.TransactionContextInterface, donorId string) ([]*Match, error) {
+	if err := validateID("donorId", donorIDPrefix, donorId); err != nil {
+		return nil, err
+	}
+	return matchesByIndex(ctx, indexMatchDonor, donorId, func(m *Match) bool { return m.DonorID == donorId })
+}
+
+// GetMatchesByHospital returns every match a hospital created, oldest first.
+func (s *SmartContract) GetMatchesByHospital(ctx contractapi.TransactionContextInterface, hospitalId string) ([]*Match, error) {
+	if err := validateRequired("hospitalId", hospitalId); err != nil {
+		return nil, err
+	}
+	return matchesByIndex(ctx, indexMatchHospital, hospitalId, func(m *Match) bool { return m.ApprovedBy == hospitalId })
+}
+
+func matchesByIndex(ctx contractapi.TransactionContextInterface, index, value string, keep func(*Match) bool) ([]*Match, error) {
+	indexed, err := indexedRecords[Match](ctx, index, value)
+	if err != nil {
+		return nil, err
+	}
+	matches := []*Match{}
+	for _, m := range indexed {
+		if keep(m) {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].CreatedAt < matches[j].CreatedAt })
+	return matches, nil
+}
+
+// Fields and operators a client-supplied selector may use. docType is always set by
+// the chaincode, and operators such as $regex and $where are refused because they
+// force full scans on the peer.
+var (
+	patientSelectorFields = map[string]bool{"bloodType": true, "organNeeded": true, "status": true, "hospitalId": true, "urgency": true, "createdAt": true}
+	donorSelectorFields   = map[string]bool{"bloodType": true, "organsAvailable": true, "verificationStatus": true, "verifiedBy": true, "verifiedAt": true, "createdAt": true}
+	selectorOperators     = map[string]bool{"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true, "$in": true, "$nin": true, "$exists": true, "$elemMatch": true}
+)
+
+// sanitizeSelector parses a CouchDB selector, keeps it to the allowed fields and
+// operators, and pins it to the given docType. Archived records are left out unless
+// the selector filters on statusField.
+func sanitizeSelector(docType, statusField, selectorJSON string, allowed map[string]bool) (string, error) {
+	fields := map[string]interface{}{}
+	if selectorJSON != "" {
+		if err := json.Unmarshal([]byte(selectorJSON), &fields); err != nil {
+			return "", codedError(CodeInvalidArgument, "", "selector", "selector must be a JSON object: %v", err)
+		}
+	}
+	for field, cond := range fields {
+		if !allowed[field] {
+			return "", codedError(CodeInvalidArgument, "", "selector", "field %q cannot be queried", field)
+		}
+		if err := checkSelectorOperators(cond); err != nil {
+			return "", codedError(CodeInvalidArgument, "", "selector", "field %q: %v", field, err)
+		}
+	}
+	if _, ok := fields[statusField]; !ok {
+		fields[statusField] = notArchived
+	}
+	return buildSelector(docType, fields)
+}
+
+func checkSelectorOperators(cond interface{}) error {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for op, arg := range ops {
+		if !selectorOperators[op] {
+			return codedError(CodeInvalidArgument, "", "selector", "operator %q is not allowed", op)
+		}
+		if err := checkSelectorOperators(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryPatientsBySelector runs a client-built CouchDB selector over patient records.
+func (s *SmartContract) QueryPatientsBySelector(ctx contractapi.TransactionContextInterface, selectorJSON string) ([]*Patient, error) {
+	query, err := sanitizeSelector("patient", "status", selectorJSON, patientSelectorFields)
+	if err != nil {
+		return nil, err
+	}
+	patients, err := richQuery[Patient](ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return visiblePatients(ctx, patients)
+}
+
+// QueryDonorsBySelector runs a client-built CouchDB selector over donor records.
+func (s *SmartContract) QueryDonorsBySelector(ctx contractapi.TransactionContextInterface, selectorJSON string) ([]*Donor, error) {
+	query, err := sanitizeSelector("donor", "verificationStatus", selectorJSON, donorSelectorFields)
+	if err != nil {
+		return nil, err
+	}
+	donors, err := richQuery[Donor](ctx, query)
+	for _, d := range donors {
+		if d.OrgansAvailable == nil {
+			d.OrgansAvailable = []string{}
+		}
+	}
+	return donors, err
+}
+
+// PatientPage is one page of patients plus the bookmark for the next call.
+type PatientPage struct {
+	Records      []*Patient `json:"records"`
+	Bookmark     string     `json:"bookmark"`
+	FetchedCount int32      `json:"fetchedCount"`
+}
+
+// DonorPage is one page of donors plus the bookmark for the next call.
+type DonorPage struct {
+	Records      []*Donor `json:"records"`
+	Bookmark     string   `json:"bookmark"`
+	FetchedCount int32    `json:"fetchedCount"`
+}
+
+// MatchPage is one page of matches plus the bookmark for the next call.
+type MatchPage struct {
+	Records      []*Match `json:"records"`
+	Bookmark     string   `json:"bookmark"`
+	FetchedCount int32    `json:"fetchedCount"`
+}
+
+// queryPopulatePaginated reads one page of the records of type T, at most maxPageSize records.
+// An empty bookmark starts at the beginning; the returned bookmark is empty once the
+// records are exhausted.
+func queryPopulatePaginated[T any](ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) ([]*T, string, int32, error) {
+	if pageSize <= 0 {
+		return nil, "", 0, codedError(CodeInvalidArgument, "", "pageSize", "page size must be positive")
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	docType, err := docTypeOf[T]()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(docType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer resultsIterator.Close()
+
+	items := []*T{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		var item T
+		if err := json.Unmarshal(queryResponse.Value, &item); err != nil {
+			return nil, "", 0, err
+		}
+		items = append(items, &item)
+	}
+
+	next, fetched := "", int32(len(items))
+	if metadata != nil {
+		next, fetched = metadata.Bookmark, metadata.FetchedRecordsCount
+	}
+	if fetched < pageSize {
+		next = ""
+	}
+	return items, next, fetched, nil
+}
+
+// GetAllPatientsPaginated returns one page of patients. Archived patients and those the
+// caller may not read are dropped from the page, so it may hold fewer than pageSize records; FetchedCount still
+// counts them.
+func (s *SmartContract) GetAllPatientsPaginated(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*PatientPage, error) {
+	records, next, fetched, err := queryPopulatePaginated[Patient](ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	patients := []*Patient{}
+	for _, p := range records {
+		if p.Status != StatusArchived {
+			patients = append(patients, p)
+		}
+	}
+	if patients, err = visiblePatients(ctx, patients); err != nil {
+		return nil, err
+	}
+	return &PatientPage{Records: patients, Bookmark: next, FetchedCount: fetched}, nil
+}
+
+// GetAllDonorsPaginated returns one page of donors, dropping archived donors as
+// GetAllPatientsPaginated does.
+func (s *SmartContract) GetAllDonorsPaginated(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*DonorPage, error) {
+	records, next, fetched, err := queryPopulatePaginated[Donor](ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	donors := []*Donor{}
+	for _, d := range records {
+		if d.VerificationStatus == StatusArchived {
+			continue
+		}
+		if d.OrgansAvailable == nil {
+			d.OrgansAvailable = []string{}
+		}
+		donors = append(donors, d)
+	}
+	return &DonorPage{Records: donors, Bookmark: next, FetchedCount: fetched}, nil
+}
+
+func (s *SmartContract) GetAllMatchesPaginated(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MatchPage, error) {
+	records, next, fetched, err := queryPopulatePaginated[Match](ctx, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &MatchPage{Records: records, Bookmark: next, FetchedCount: fetched}, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+func TestRichQuerySelectors(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   string
+		args []string
+		want string
+	}{
+		{
+			"donors on every filter", "QueryDonors", []string{"O-", "Kidney", "VERIFIED"},
+			`{"selector":{"bloodType":"O-","docType":"donor","organsAvailable":{"$elemMatch":{"$eq":"Kidney"}},"verificationStatus":"VERIFIED"}}`,
+		},
+		{
+			"donors unfiltered", "QueryDonors", []string{"", "", ""},
+			`{"selector":{"docType":"donor","verificationStatus":{"$ne":"ARCHIVED"}}}`,
+		},
+		{
+			"donors by organ", "QueryDonors", []string{"", "Heart", ""},
+			`{"selector":{"docType":"donor","organsAvailable":{"$elemMatch":{"$eq":"Heart"}},"verificationStatus":{"$ne":"ARCHIVED"}}}`,
+		},
+		{
+			"patients on every filter", "QueryPatients", []string{"A+", "Kidney", "WAITING"},
+			`{"selector":{"bloodType":"A+","docType":"patient","organNeeded":"Kidney","status":"WAITING"}}`,
+		},
+		{
+			"patients without a status", "QueryPatients", []string{"A+", "Kidney", ""},
+			`{"selector":{"bloodType":"A+","docType":"patient","organNeeded":"Kidney","status":{"$ne":"ARCHIVED"}}}`,
+		},
+		{
+			"patients unfiltered", "QueryPatients", []string{"", "", ""},
+			`{"selector":{"docType":"patient","status":{"$ne":"ARCHIVED"}}}`,
+		},
+		{
+			"client selector", "QueryPatientsBySelector", []string{`{"urgency":{"$in":["STATUS_1A","STATUS_1B"]}}`},
+			`{"selector":{"docType":"patient","status":{"$ne":"ARCHIVED"},"urgency":{"$in":["STATUS_1A","STATUS_1B"]}}}`,
+		},
+		{
+			"client selector on status", "QueryDonorsBySelector", []string{`{"verificationStatus":"ARCHIVED"}`},
+			`{"selector":{"docType":"donor","verificationStatus":"ARCHIVED"}}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			l.mustInvoke(tc.fn, tc.args...)
+			if len(l.Queries) != 1 {
+				t.Fatalf("%s ran %d queries, want 1", tc.fn, len(l.Queries))
+			}
+			if l.Queries[0] != tc.want {
+				t.Errorf("%s(%q) query:\n got %s\nwant %s", tc.fn, tc.args, l.Queries[0], tc.want)
+			}
+		})
+	}
+}
+
+func TestClientSelectorsAreRestricted(t *testing.T) {
+	for _, selector := range []string{
+		`{"nameHash":"abc"}`,
+		`{"docType":"donor"}`,
+		`{"bloodType":{"$regex":"^O"}}`,
+		`{"status":{"$or":[{"$where":"1"}]}}`,
+		`[1]`,
+	} {
+		l := newTestLedger(t)
+		l.mustFail("QueryPatientsBySelector", selector)
+		if len(l.Queries) != 0 {
+			t.Errorf("selector %s reached the state database as %s", selector, l.Queries[0])
+		}
+	}
+}
+
+func TestQueryPatientsKeepsToTheCallersHospital(t *testing.T) {
+	l := newTestLedger(t)
+	for _, p := range []*Patient{
+		{ID: "PAT-001", HospitalID: "HOSP-001", Status: "WAITING", DocType: docTypePatient},
+		{ID: "PAT-002", HospitalID: "HOSP-002", Status: "WAITING", DocType: docTypePatient},
+	} {
+		bytes, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.QueryResults = append(l.QueryResults, &queryresult.KV{Key: p.ID, Value: bytes})
+	}
+	l.asHospital("HOSP-001")
+	var patients []*Patient
+	l.mustInvokeJSON(&patients, "QueryPatients", "", "", "WAITING")
+	if len(patients) != 1 || patients[0].ID != "PAT-001" {
+		t.Errorf("QueryPatients returned %d patients, want only PAT-001", len(patients))
+	}
+}
+
+// walkPages reads every page of a paginated getter and returns the record IDs of each.
+func walkPages(t *testing.T, l *testLedger, fn string, pageSize int) [][]string {
+	t.Helper()
+	pages := [][]string{}
+	bookmark := ""
+	for {
+		var page struct {
+			Records []struct {
+				ID string `json:"id"`
+			} `json:"records"`
+			Bookmark string `json:"bookmark"`
+		}
+		l.mustInvokeJSON(&page, fn, fmt.Sprint(pageSize), bookmark)
+		if len(page.Records) > pageSize {
+			t.Fatalf("%s returned %d records for a page size of %d", fn, len(page.Records), pageSize)
+		}
+		ids := []string{}
+		for _, r := range page.Records {
+			ids = append(ids, r.ID)
+		}
+		pages = append(pages, ids)
+		if page.Bookmark == "" {
+			return pages
+		}
+		if len(pages) > 20 {
+			t.Fatalf("%s is still returning bookmarks after %d pages", fn, len(pages))
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+func TestPaginatedGettersWalkEveryRecordOnce(t *testing.T) {
+	l := newSeededLedger(t)
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+	l.mustInvoke("CreateMatch", "MATCH-2", "PAT-002", "DON-101", "Liver")
+	l.mustInvoke("CreatePatient", "PAT-100", "h", "AB+", "A2, B35, DR1", "Heart", "", "", "")
+	l.mustInvoke("CreateMatch", "MATCH-3", "PAT-100", "DON-102", "Heart")
+	want := map[string]int{"GetAllPatientsPaginated": 5, "GetAllDonorsPaginated": 4, "GetAllMatchesPaginated": 3}
+
+	for fn, total := range want {
+		for pageSize := 1; pageSize <= total+1; pageSize++ {
+			pages := walkPages(t, l, fn, pageSize)
+			seen := map[string]bool{}
+			for i, page := range pages {
+				if i < len(pages)-1 && len(page) != pageSize {
+					t.Errorf("%s page %d of size %d has %d records", fn, i+1, pageSize, len(page))
+				}
+				for _, id := range page {
+					if seen[id] {
+						t.Errorf("%s with page size %d returned %s on more than one page", fn, pageSize, id)
+					}
+					seen[id] = true
+				}
+			}
+			if len(seen) != total {
+				t.Errorf("%s with page size %d returned %d records, want %d", fn, pageSize, len(seen), total)
+			}
+		}
+	}
+}
+
+func TestPaginatedGettersRejectBadPageSizes(t *testing.T) {
+	l := newSeededLedger(t)
+	l.mustFail("GetAllPatientsPaginated", "0", "")
+	l.mustFail("GetAllDonorsPaginated", "-1", "")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// National registry submissions are fixed-field flat files: one record per line, each
+// starting with its record type, alphanumeric fields left-justified and space-padded,
+// numeric fields right-justified and zero-padded, lines ending CRLF. A file is a
+// header, the full waitlist, the transplants not yet submitted, and a trailer holding
+// the record counts. A value too long for its field fails the submission rather than
+// being truncated.
+const (
+	registrySender     = "ORGANCHAIN"
+	registryFormat     = "001"
+	registryLineEnding = "\r\n"
+	registryDate       = "20060102"
+)
+
+// registryField is one column of a record layout.
+type registryField struct {
+	name    string
+	width   int
+	numeric bool
+}
+
+var (
+	registryHeaderLayout = []registryField{
+		{"recordType", 1, false}, {"batchId", 20, false}, {"createdDate", 8, true}, {"createdTime", 6, true},
+		{"sender", 10, false}, {"format", 3, true},
+	}
+	registryWaitlistLayout = []registryField{
+		{"recordType", 1, false}, {"patientId", 32, false}, {"hospitalId", 32, false}, {"organ", 12, false},
+		{"bloodType", 3, false}, {"urgency", 10, false}, {"listedDate", 8, true}, {"waitDays", 5, true}, {"cpra", 3, true},
+	}
+	registryTransplantLayout = []registryField{
+		{"recordType", 1, false}, {"transplantId", 80, false}, {"patientId", 32, false}, {"donorId", 32, false},
+		{"hospitalId", 32, false}, {"organ", 12, false}, {"transplantDate", 8, true}, {"coldIschemiaMinutes", 5, true},
+		{"hlaScore", 8, false},
+	}
+	registryTrailerLayout = []registryField{
+		{"recordType", 1, false}, {"batchId", 20, false}, {"waitlistRecords", 7, true}, {"transplantRecords", 7, true},
+		{"totalRecords", 9, true},
+	}
+)
+
+// RegistrySubmission records a file generated for the national registry. The file
+// itself is not kept on the ledger; its hash is, so a copy can be checked against it.
+type RegistrySubmission struct {
+	ID                string   `json:"id"`
+	SubmittedBy       string   `json:"submittedBy"`
+	WaitlistRecords   int      `json:"waitlistRecords"`
+	TransplantRecords int      `json:"transplantRecords"`
+	TransplantIDs     []string `json:"transplantIds"`
+	FileHash          string   `json:"fileHash"`
+	DocType           string   `json:"docType"`
+	SchemaVersion     int      `json:"schemaVersion"`
+	CreatedAt         string   `json:"createdAt"`
+}
+
+// RegistryExport is the result of CreateRegistrySubmission: the recorded submission
+// and the file to send.
+type RegistryExport struct {
+	Submission *RegistrySubmission `json:"submission"`
+	File       string              `json:"file"`
+}
+
+// registryRecord formats values into one line of the given layout.
+func registryRecord(layout []registryField, values ...string) (string, error) {
+	var b strings.Builder
+	for i, f := range layout {
+		v := values[i]
+		if len(v) > f.width {
+			return "", codedError(CodeInvalidArgument, "", f.name, "%s %q does not fit the registry's %d-character field", f.name, v, f.width)
+		}
+		pad := strings.Repeat(" ", f.width-len(v))
+		if f.numeric {
+			b.WriteString(strings.Repeat("0", len(pad)) + v)
+		} else {
+			b.WriteString(v + pad)
+		}
+	}
+	return b.String() + registryLineEnding, nil
+}
+
+// registryDateOf returns the date of an RFC 3339 timestamp in registry format, or
+// zeroes if it has none.
+func registryDateOf(ts string) string {
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		return "00000000"
+	}
+	return t.UTC().Format(registryDate)
+}
+
+// nextRegistryBatchID numbers the day's submissions from 001, e.g. REG-20261017-001.
+func nextRegistryBatchID(ctx contractapi.TransactionContextInterface, now time.Time) (string, error) {
+	submissions, err := queryPopulate[RegistrySubmission](ctx)
+	if err != nil {
+		return "", err
+	}
+	prefix := "REG-" + now.UTC().Format(registryDate) + "-"
+	seq := 1
+	for _, sub := range submissions {
+		if strings.HasPrefix(sub.ID, prefix) {
+			seq++
+		}
+	}
+	return fmt.Sprintf("%s%03d", prefix, seq), nil
+}
+
+// CreateRegistrySubmission generates the national registry file of the current
+// waitlist and of every transplant not in an earlier submission, records the
+// submission under a new batch ID, and stamps that ID on each transplant it carries.
+// Only network admins may call it.
+func (s *SmartContract) CreateRegistrySubmission(ctx contractapi.TransactionContextInterface) (*RegistryExport, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batchID, err := nextRegistryBatchID(ctx, *now)
+	if err != nil {
+		return nil, err
+	}
+	sub := &RegistrySubmission{
+		ID: batchID, SubmittedBy: mspID, TransplantIDs: []string{}, DocType: docTypeRegistry,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+
+	header, err := registryRecord(registryHeaderLayout, "H", batchID, now.UTC().Format(registryDate),
+		now.UTC().Format("150405"), registrySender, registryFormat)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{header}
+
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	waitlist := []*Patient{}
+	for _, p := range patients {
+		if p.Status == "WAITING" {
+			waitlist = append(waitlist, p)
+		}
+	}
+	sortWaitlist(waitlist, *now)
+	for _, p := range waitlist {
+		line, err := registryRecord(registryWaitlistLayout, "W", p.ID, p.HospitalID, p.OrganNeeded, p.BloodType,
+			p.Urgency, registryDateOf(p.CreatedAt), strconv.Itoa(int(waitingTime(p, *now).Hours()/24)), strconv.Itoa(p.CPRA))
+		if err != nil {
+			return nil, wrapError(err, "cannot submit patient "+p.ID)
+		}
+		lines = append(lines, line)
+	}
+	sub.WaitlistRecords = len(waitlist)
+
+	transplants, err := queryPopulate[Transplant](ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := []*Transplant{}
+	for _, t := range transplants {
+		if t.RegistryBatchID != "" {
+			continue
+		}
+		hlaScore := ""
+		m, err := findState[Match](ctx, t.MatchID)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			hlaScore = m.HLAScore
+		}
+		line, err := registryRecord(registryTransplantLayout, "T", t.ID, t.PatientID, t.DonorID, t.HospitalID, t.OrganType,
+			registryDateOf(t.TransplantDate), strconv.Itoa(t.ColdIschemiaMinutes), hlaScore)
+		if err != nil {
+			return nil, wrapError(err, "cannot submit transplant "+t.ID)
+		}
+		lines = append(lines, line)
+		pending = append(pending, t)
+		sub.TransplantIDs = append(sub.TransplantIDs, t.ID)
+	}
+	sub.TransplantRecords = len(pending)
+
+	trailer, err := registryRecord(registryTrailerLayout, "Z", batchID, strconv.Itoa(sub.WaitlistRecords),
+		strconv.Itoa(sub.TransplantRecords), strconv.Itoa(len(lines)+1))
+	if err != nil {
+		return nil, err
+	}
+	file := strings.Join(append(lines, trailer), "")
+	sum := sha256.Sum256([]byte(file))
+	sub.FileHash = hex.EncodeToString(sum[:])
+
+	for _, t := range pending {
+		t.RegistryBatchID = batchID
+		if err := putState(ctx, t.ID, t); err != nil {
+			return nil, err
+		}
+	}
+	if err := putState(ctx, batchID, sub); err != nil {
+		return nil, err
+	}
+	err = emitEvent(ctx, EventRegistrySubmitted, map[string]interface{}{
+		"batchId": batchID, "waitlistRecords": sub.WaitlistRecords, "transplantRecords": sub.TransplantRecords,
+		"fileHash": sub.FileHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RegistryExport{Submission: sub, File: file}, nil
+}
+
+func (s *SmartContract) GetRegistrySubmission(ctx contractapi.TransactionContextInterface, batchId string) (*RegistrySubmission, error) {
+	if err := requireRole(ctx, RoleAdmin, RoleRegulator); err != nil {
+		return nil, err
+	}
+	return getState[RegistrySubmission](ctx, batchId)
+}
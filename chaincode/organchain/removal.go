@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Reason codes for taking a patient off the waitlist. TRANSFERRED is for a move to a
+// centre outside the network; transfers between member hospitals use InitiateTransfer.
+const (
+	RemovalDeceased      = "DECEASED"
+	RemovalRecovered     = "RECOVERED"
+	RemovalTransferred   = "TRANSFERRED"
+	RemovalTooSick       = "TOO_SICK"
+	RemovalPatientChoice = "PATIENT_CHOICE"
+)
+
+// WaitlistRemovalCodes are the reasons RemovePatientFromWaitlist accepts.
+var WaitlistRemovalCodes = []string{RemovalDeceased, RemovalRecovered, RemovalTransferred, RemovalTooSick, RemovalPatientChoice}
+
+// Statuses of a patient taken off the waitlist. A deceased patient is recorded as
+// such; every other removal leaves the patient REMOVED.
+const (
+	StatusDeceased = "DECEASED"
+	StatusRemoved  = "REMOVED"
+)
+
+// removableStatuses are the statuses of a patient still on the waitlist.
+var removableStatuses = map[string]bool{"WAITING": true, "INACTIVE": true, "MATCHED": true}
+
+// PatientRemoval records why, when and by whom a patient left the waitlist.
+type PatientRemoval struct {
+	ReasonCode       string   `json:"reasonCode"`
+	Reason           string   `json:"reason,omitempty" metadata:",optional"`
+	RemovedAt        string   `json:"removedAt"`
+	RemovedBy        string   `json:"removedBy"`
+	HospitalID       string   `json:"hospitalId"`
+	RecordedAt       string   `json:"recordedAt"`
+	CancelledMatches []string `json:"cancelledMatches"`
+}
+
+// RemovePatientFromWaitlist takes a patient off the waitlist for one of the
+// WaitlistRemovalCodes. removedAt is when the removal took effect, such as the time of
+// death, and defaults to now; waiting time stops accruing then. The patient's open
+// matches are cancelled and their organs returned to the donors. Only the patient's
+// hospital (or the admin hospital) may remove them.
+func (s *SmartContract) RemovePatientFromWaitlist(ctx contractapi.TransactionContextInterface, patientId, reasonCode, reason, removedAt string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if !containsString(WaitlistRemovalCodes, reasonCode) {
+		return nil, codedError(CodeInvalidReasonCode, "", "reasonCode", "unknown removal reason %q; expected one of %s", reasonCode, strings.Join(WaitlistRemovalCodes, ", "))
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	effective := *now
+	if removedAt != "" {
+		if effective, err = parseTimestamp(removedAt); err != nil {
+			return nil, err
+		}
+		if effective.After(*now) {
+			return nil, codedError(CodeInvalidArgument, "", "removedAt", "removal date %s is in the future", removedAt)
+		}
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot remove patient")
+	}
+	if !removableStatuses[p.Status] {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is %s and not on the waitlist", p.ID, p.Status)
+	}
+	if listed, err := parseTimestamp(p.CreatedAt); err == nil && effective.Before(listed) {
+		return nil, codedError(CodeInvalidArgument, "", "removedAt", "removal date %s is before patient %s was listed", removedAt, p.ID)
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := matchesByIndex(ctx, indexMatchPatient, p.ID, func(m *Match) bool { return !terminalMatchStatuses[m.Status] })
+	if err != nil {
+		return nil, err
+	}
+	removal := &PatientRemoval{
+		ReasonCode: reasonCode, Reason: reason, RemovedAt: effective.UTC().Format(time.RFC3339), RemovedBy: actor.ID,
+		HospitalID: hospitalId, RecordedAt: now.Format(time.RFC3339), CancelledMatches: []string{},
+	}
+	for _, m := range matches {
+		if err := s.transitionMatch(ctx, m, "CANCELLED", hospitalId, ReasonPatientRemoved, "patient removed from waitlist: "+reasonCode); err != nil {
+			return nil, err
+		}
+		if _, err := s.restoreOrgan(ctx, m.DonorID, m.OrganType); err != nil {
+			return nil, err
+		}
+		removal.CancelledMatches = append(removal.CancelledMatches, m.ID)
+	}
+
+	if p.Status == "INACTIVE" {
+		if since, err := parseTimestamp(p.InactiveSince); err == nil && effective.After(since) {
+			p.InactiveSeconds += int64(effective.Sub(since) / time.Second)
+		}
+		p.InactiveSince, p.InactiveReason = "", ""
+	}
+	p.Status = StatusRemoved
+	if reasonCode == RemovalDeceased {
+		p.Status = StatusDeceased
+	}
+	p.Removal = removal
+	p.PendingTransfer = nil
+	p.TransferRequired = false
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientRemoved, map[string]interface{}{
+		"patientId": p.ID, "hospitalId": hospitalId, "status": p.Status, "reasonCode": reasonCode,
+		"removedAt": removal.RemovedAt, "cancelledMatches": removal.CancelledMatches,
+	})
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	defaultActivityLimit = 20
+	maxActivityLimit     = 100
+)
+
+// ActivityEntry is a single event in the system-wide activity feed.
+type ActivityEntry struct {
+	Type      string `json:"type"`
+	EntityID  string `json:"entityId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// activityFeed collects activity entries for the hospital dashboard.
+type activityFeed struct {
+	entries []*ActivityEntry
+}
+
+// add records an event; records written before the timestamp existed have none and are left out.
+func (f *activityFeed) add(kind, id, ts string) {
+	if ts != "" {
+		f.entries = append(f.entries, &ActivityEntry{Type: kind, EntityID: id, Timestamp: ts})
+	}
+}
+
+// activityLimit clamps a requested feed length; see GetRecentActivity.
+func activityLimit(limit int) int {
+	if limit <= 0 {
+		return defaultActivityLimit
+	}
+	if limit > maxActivityLimit {
+		return maxActivityLimit
+	}
+	return limit
+}
+
+// newest returns up to limit entries, newest first; see GetRecentActivity for limit.
+func (f *activityFeed) newest(limit int) []*ActivityEntry {
+	limit = activityLimit(limit)
+	entries := append([]*ActivityEntry{}, f.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareNewestFirst(entries[i].Timestamp, entries[j].Timestamp) < 0
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// compareNewestFirst orders two timestamps newest first. As in compareByCreatedAt,
+// missing or malformed values sort after every valid one.
+func compareNewestFirst(a, b string) int {
+	ta, errA := parseTimestamp(a)
+	tb, errB := parseTimestamp(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return 1
+	case errB != nil:
+		return -1
+	}
+	return tb.Compare(ta)
+}
+
+// activityMalformed is the sort key of events whose timestamp does not parse. It sorts
+// after every valid key, so those events come last.
+const activityMalformed = "~"
+
+// appendActivity adds the indexActivity entry of an event to a record's index entries.
+// The first attribute counts down from the latest representable time, so the index
+// lists the newest event first. Events without a timestamp are left out, as in
+// activityFeed.add.
+func appendActivity(entries [][]string, kind, id, ts string) [][]string {
+	if ts == "" {
+		return entries
+	}
+	key := activityMalformed
+	if t, err := parseTimestamp(ts); err == nil {
+		key = fmt.Sprintf("%019d", math.MaxInt64-t.UnixNano())
+	}
+	return append(entries, []string{indexActivity, key, ts, kind, id})
+}
+
+// GetRecentActivity returns the newest limit events across patients, donors, matches
+// and transplants. limit defaults to 20 and is capped at 100. Events are read from
+// indexActivity, which stops at limit entries instead of loading every record; records
+// written before the index existed appear after RebuildIndexes.
+func (s *SmartContract) GetRecentActivity(ctx contractapi.TransactionContextInterface, limit int) ([]*ActivityEntry, error) {
+	limit = activityLimit(limit)
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(indexActivity, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	entries := []*ActivityEntry{}
+	for len(entries) < limit && it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &ActivityEntry{Type: attrs[2], EntityID: attrs[3], Timestamp: attrs[1]})
+	}
+	return entries, nil
+}
+
+// HospitalAcceptanceRate summarizes a hospital's donor verification decisions.
+type HospitalAcceptanceRate struct {
+	HospitalID     string  `json:"hospitalId"`
+	Verified       int     `json:"verified"`
+	Rejected       int     `json:"rejected"`
+	AcceptanceRate float64 `json:"acceptanceRate"`
+}
+
+// GetDonorAcceptanceRate returns per-hospital verification outcomes, lowest acceptance first.
+func (s *SmartContract) GetDonorAcceptanceRate(ctx contractapi.TransactionContextInterface) ([]*HospitalAcceptanceRate, error) {
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byHospital := map[string]*HospitalAcceptanceRate{}
+	for _, d := range donors {
+		if d.VerifiedBy == "" || (d.VerificationStatus != "VERIFIED" && d.VerificationStatus != "REJECTED") {
+			continue
+		}
+		rate, ok := byHospital[d.VerifiedBy]
+		if !ok {
+			rate = &HospitalAcceptanceRate{HospitalID: d.VerifiedBy}
+			byHospital[d.VerifiedBy] = rate
+		}
+		if d.VerificationStatus == "VERIFIED" {
+			rate.Verified++
+		} else {
+			rate.Rejected++
+		}
+	}
+
+	rates := []*HospitalAcceptanceRate{}
+	for _, rate := range byHospital {
+		rate.AcceptanceRate = math.Round(float64(rate.Verified)*10000/float64(rate.Verified+rate.Rejected)) / 100
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].AcceptanceRate != rates[j].AcceptanceRate {
+			return rates[i].AcceptanceRate < rates[j].AcceptanceRate
+		}
+		return rates[i].HospitalID < rates[j].HospitalID
+	})
+	return rates, nil
+}
+
+// ReverificationItem is a verified donor due for another review, tagged with why.
+type ReverificationItem struct {
+	DonorID     string   `json:"donorId"`
+	VerifiedBy  string   `json:"verifiedBy"`
+	VerifiedAt  string   `json:"verifiedAt"`
+	DaysOverdue int      `json:"daysOverdue"`
+	Reasons     []string `json:"reasons"`
+}
+
+// GetDonorsNeedingReverification returns verified donors whose verification is older
+// than the policy window or was never dated, most overdue first.
+func (s *SmartContract) GetDonorsNeedingReverification(ctx contractapi.TransactionContextInterface) ([]*ReverificationItem, error) {
+	cfg, err := s.GetPolicyConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	window := time.Duration(cfg.ReverificationDays) * 24 * time.Hour
+
+	items := []*ReverificationItem{}
+	for _, d := range donors {
+		if d.VerificationStatus != "VERIFIED" {
+			continue
+		}
+		item := &ReverificationItem{DonorID: d.ID, VerifiedBy: d.VerifiedBy, VerifiedAt: d.VerifiedAt, Reasons: []string{}}
+		verifiedAt, err := parseTimestamp(d.VerifiedAt)
+		if err != nil {
+			item.Reasons = append(item.Reasons, "VERIFICATION_UNDATED")
+		} else if age := now.Sub(verifiedAt); age > window {
+			item.Reasons = append(item.Reasons, "VERIFICATION_STALE")
+			item.DaysOverdue = int((age - window) / (24 * time.Hour))
+		}
+		if len(item.Reasons) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	// Undated verifications first, then the oldest.
+	sort.SliceStable(items, func(i, j int) bool {
+		_, errI := parseTimestamp(items[i].VerifiedAt)
+		_, errJ := parseTimestamp(items[j].VerifiedAt)
+		if (errI != nil) != (errJ != nil) {
+			return errI != nil
+		}
+		return compareByCreatedAt(items[i].VerifiedAt, items[j].VerifiedAt) < 0
+	})
+	return items, nil
+}
+
+// StatusCounts is a record total broken down by status and by organ: the organ needed
+// for patients, each organ available for donors and the organ matched for matches.
+type StatusCounts struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"byStatus"`
+	ByOrgan  map[string]int `json:"byOrgan"`
+}
+
+// TransplantCounts counts completed transplants, in total and by organ.
+type TransplantCounts struct {
+	Total   int            `json:"total"`
+	ByOrgan map[string]int `json:"byOrgan"`
+}
+
+// HospitalCounts splits registered hospitals by whether they may still act.
+type HospitalCounts struct {
+	Total    int `json:"total"`
+	Active   int `json:"active"`
+	Inactive int `json:"inactive"`
+}
+
+// LedgerStats holds the record counts shown on the admin dashboard.
+type LedgerStats struct {
+	Patients    StatusCounts     `json:"patients"`
+	Donors      StatusCounts     `json:"donors"`
+	Matches     StatusCounts     `json:"matches"`
+	Transplants TransplantCounts `json:"transplants"`
+	Hospitals   HospitalCounts   `json:"hospitals"`
+}
+
+// countByStatus walks a docType's records once, tallying records by the given status
+// field and by the organ field, which holds an organ or a list of them. Known statuses
+// and every organ are always present so the dashboard can rely on the keys.
+func countByStatus(ctx contractapi.TransactionContextInterface, docType, field, organField string, known ...string) (StatusCounts, error) {
+	counts := StatusCounts{ByStatus: map[string]int{}, ByOrgan: map[string]int{}}
+	for _, status := range known {
+		counts.ByStatus[status] = 0
+	}
+	for _, organ := range Organs {
+		counts.ByOrgan[organ] = 0
+	}
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docType, []string{})
+	if err != nil {
+		return counts, err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return counts, err
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(kv.Value, &record); err != nil {
+			return counts, err
+		}
+		if field != "" {
+			status, _ := record[field].(string)
+			counts.ByStatus[status]++
+		}
+		switch organs := record[organField].(type) {
+		case string:
+			counts.ByOrgan[organs]++
+		case []interface{}:
+			for _, o := range organs {
+				if organ, ok := o.(string); ok {
+					counts.ByOrgan[organ]++
+				}
+			}
+		}
+		counts.Total++
+	}
+	return counts, nil
+}
+
+func (s *SmartContract) GetLedgerStats(ctx contractapi.TransactionContextInterface) (*LedgerStats, error) {
+	stats := &LedgerStats{}
+	var err error
+	if stats.Patients, err = countByStatus(ctx, docTypePatient, "status", "organNeeded", "WAITING", "INACTIVE", "MATCHED", "TRANSPLANTED", StatusRemoved, StatusDeceased); err != nil {
+		return nil, err
+	}
+	if stats.Donors, err = countByStatus(ctx, docTypeDonor, "verificationStatus", "organsAvailable", "PENDING_VERIFICATION", "VERIFIED", "REJECTED", "WITHDRAWN", DonorInactive); err != nil {
+		return nil, err
+	}
+	if stats.Matches, err = countByStatus(ctx, docTypeMatch, "status", "organType", "PENDING", "APPROVED", "REJECTED", "CANCELLED", "COMPLETED"); err != nil {
+		return nil, err
+	}
+	transplants, err := countByStatus(ctx, docTypeTransplant, "", "organType")
+	if err != nil {
+		return nil, err
+	}
+	stats.Transplants = TransplantCounts{Total: transplants.Total, ByOrgan: transplants.ByOrgan}
+
+	hospitals, err := s.GetAllHospitals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hospitals {
+		stats.Hospitals.Total++
+		if h.IsActive {
+			stats.Hospitals.Active++
+		} else {
+			stats.Hospitals.Inactive++
+		}
+	}
+	return stats, nil
+}
+
+// Transplant statistics are grouped by calendar month (2026-01) or quarter (2026-Q1).
+const (
+	GranularityMonth   = "month"
+	GranularityQuarter = "quarter"
+)
+
+// TransplantPeriodStats summarizes the transplants performed in one period. The HLA
+// score is the match's six-antigen score and the wait is the patient's active waiting
+// time at the transplant date; transplants whose match or patient no longer exists are
+// left out of the corresponding average.
+type TransplantPeriodStats struct {
+	Period          string  `json:"period"`
+	Transplants     int     `json:"transplants"`
+	AverageHLAScore float64 `json:"averageHlaScore"`
+	AverageWaitDays float64 `json:"averageWaitDays"`
+}
+
+func transplantPeriod(granularity string, t time.Time) string {
+	if granularity == GranularityQuarter {
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	}
+	return t.Format("2006-01")
+}
+
+// GetTransplantStats aggregates completed transplants by month or quarter of their
+// transplant date, optionally between two dates; see parseDateBound. Periods without
+// transplants are left out.
+func (s *SmartContract) GetTransplantStats(ctx contractapi.TransactionContextInterface, granularity, fromDate, toDate string) ([]*TransplantPeriodStats, error) {
+	if granularity == "" {
+		granularity = GranularityMonth
+	}
+	var errGranularity error
+	if granularity != GranularityMonth && granularity != GranularityQuarter {
+		errGranularity = codedError(CodeInvalidArgument, "", "granularity", "granularity must be %q or %q", GranularityMonth, GranularityQuarter)
+	}
+	from, errFrom := parseDateBound("fromDate", fromDate, false)
+	to, errTo := parseDateBound("toDate", toDate, true)
+	if err := validateFields(errGranularity, errFrom, errTo); err != nil {
+		return nil, err
+	}
+	transplants, err := queryPopulate[Transplant](ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type totals struct {
+		count, scored, waited int
+		hla                   float64
+		wait                  time.Duration
+	}
+	byPeriod := map[string]*totals{}
+	for _, t := range transplants {
+		performed, err := parseTimestamp(t.TransplantDate)
+		if err != nil || (from != nil && performed.Before(*from)) || (to != nil && performed.After(*to)) {
+			continue
+		}
+		period := transplantPeriod(granularity, performed)
+		sum := byPeriod[period]
+		if sum == nil {
+			sum = &totals{}
+			byPeriod[period] = sum
+		}
+		sum.count++
+		m, err := findState[Match](ctx, t.MatchID)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			if score, err := strconv.Atoi(m.HLAScore); err == nil {
+				sum.hla += float64(score)
+				sum.scored++
+			}
+		}
+		p, err := findState[Patient](ctx, t.PatientID)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			sum.wait += waitingTime(p, performed)
+			sum.waited++
+		}
+	}
+
+	stats := []*TransplantPeriodStats{}
+	for period, sum := range byPeriod {
+		ps := &TransplantPeriodStats{Period: period, Transplants: sum.count}
+		if sum.scored > 0 {
+			ps.AverageHLAScore = math.Round(sum.hla/float64(sum.scored)*100) / 100
+		}
+		if sum.waited > 0 {
+			ps.AverageWaitDays = math.Round(sum.wait.Hours()/24/float64(sum.waited)*100) / 100
+		}
+		stats = append(stats, ps)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Period < stats[j].Period })
+	return stats, nil
+}
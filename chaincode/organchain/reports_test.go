@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// organCounts returns a by-organ tally with every organ present, as the stats report it.
+func organCounts(counts map[string]int) map[string]int {
+	all := map[string]int{}
+	for _, organ := range Organs {
+		all[organ] = counts[organ]
+	}
+	return all
+}
+
+func TestGetLedgerStats(t *testing.T) {
+	l := newTestLedger(t)
+	for _, p := range []*Patient{
+		{ID: "PAT-001", Status: "WAITING", OrganNeeded: "Kidney"},
+		{ID: "PAT-002", Status: "WAITING", OrganNeeded: "Kidney"},
+		{ID: "PAT-003", Status: "MATCHED", OrganNeeded: "Liver"},
+		{ID: "PAT-004", Status: "TRANSPLANTED", OrganNeeded: "Heart"},
+		{ID: "PAT-005", Status: StatusDeceased, OrganNeeded: "Lung"},
+		{ID: "PAT-006", Status: StatusArchived, OrganNeeded: "Kidney"},
+	} {
+		p.DocType = docTypePatient
+		l.put(docTypePatient, p.ID, p)
+	}
+	for _, d := range []*Donor{
+		{ID: "DON-101", VerificationStatus: "VERIFIED", OrgansAvailable: []string{"Kidney", "Liver"}},
+		{ID: "DON-102", VerificationStatus: "VERIFIED", OrgansAvailable: []string{"Kidney"}},
+		{ID: "DON-103", VerificationStatus: "PENDING_VERIFICATION", OrgansAvailable: []string{"Heart", "Lung", "Cornea"}},
+		{ID: "DON-104", VerificationStatus: "WITHDRAWN", OrgansAvailable: []string{}},
+	} {
+		d.DocType = docTypeDonor
+		l.put(docTypeDonor, d.ID, d)
+	}
+	for _, m := range []*Match{
+		{ID: "MATCH-1", Status: "PENDING", OrganType: "Liver"},
+		{ID: "MATCH-2", Status: "COMPLETED", OrganType: "Heart"},
+		{ID: "MATCH-3", Status: "REJECTED", OrganType: "Kidney"},
+		{ID: "MATCH-4", Status: "REJECTED", OrganType: "Kidney"},
+	} {
+		m.DocType = docTypeMatch
+		l.put(docTypeMatch, m.ID, m)
+	}
+	l.put(docTypeTransplant, "TRANS-MATCH-2", &Transplant{ID: "TRANS-MATCH-2", OrganType: "Heart", DocType: docTypeTransplant})
+	for _, h := range []*Hospital{
+		{ID: "HOSP-001", IsActive: true},
+		{ID: "HOSP-002", IsActive: true},
+		{ID: "HOSP-003", IsActive: false},
+	} {
+		h.DocType = docTypeHospital
+		l.put(docTypeHospital, h.ID, h)
+	}
+
+	var got LedgerStats
+	l.mustInvokeJSON(&got, "GetLedgerStats")
+	want := LedgerStats{
+		Patients: StatusCounts{
+			Total: 6,
+			ByStatus: map[string]int{
+				"WAITING": 2, "INACTIVE": 0, "MATCHED": 1, "TRANSPLANTED": 1,
+				StatusRemoved: 0, StatusDeceased: 1, StatusArchived: 1,
+			},
+			ByOrgan: organCounts(map[string]int{"Kidney": 3, "Liver": 1, "Heart": 1, "Lung": 1}),
+		},
+		Donors: StatusCounts{
+			Total: 4,
+			ByStatus: map[string]int{
+				"PENDING_VERIFICATION": 1, "VERIFIED": 2, "REJECTED": 0, "WITHDRAWN": 1, DonorInactive: 0,
+			},
+			ByOrgan: organCounts(map[string]int{"Kidney": 2, "Liver": 1, "Heart": 1, "Lung": 1, "Cornea": 1}),
+		},
+		Matches: StatusCounts{
+			Total:    4,
+			ByStatus: map[string]int{"PENDING": 1, "APPROVED": 0, "REJECTED": 2, "CANCELLED": 0, "COMPLETED": 1},
+			ByOrgan:  organCounts(map[string]int{"Liver": 1, "Heart": 1, "Kidney": 2}),
+		},
+		Transplants: TransplantCounts{Total: 1, ByOrgan: organCounts(map[string]int{"Heart": 1})},
+		Hospitals:   HospitalCounts{Total: 3, Active: 2, Inactive: 1},
+	}
+	if !reflect.DeepEqual(got.Patients, want.Patients) {
+		t.Errorf("patients = %+v\nwant %+v", got.Patients, want.Patients)
+	}
+	if !reflect.DeepEqual(got.Donors, want.Donors) {
+		t.Errorf("donors = %+v\nwant %+v", got.Donors, want.Donors)
+	}
+	if !reflect.DeepEqual(got.Matches, want.Matches) {
+		t.Errorf("matches = %+v\nwant %+v", got.Matches, want.Matches)
+	}
+	if !reflect.DeepEqual(got.Transplants, want.Transplants) {
+		t.Errorf("transplants = %+v\nwant %+v", got.Transplants, want.Transplants)
+	}
+	if got.Hospitals != want.Hospitals {
+		t.Errorf("hospitals = %+v, want %+v", got.Hospitals, want.Hospitals)
+	}
+}
+
+func TestGetRecentActivityReturnsNewestFirst(t *testing.T) {
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	l.Now = testEpoch.Add(time.Hour)
+	l.mustInvoke("CreatePatient", "PAT-101", "h", "O+", "A2, B8, DR15", "Lung", "", "ROUTINE", "")
+	l.Now = testEpoch.Add(2 * time.Hour)
+	l.mustInvoke("CreatePatient", "PAT-102", "h", "O+", "A2, B8, DR15", "Lung", "", "ROUTINE", "")
+	l.Now = testEpoch.Add(3 * time.Hour)
+	l.mustInvoke("CreateMatch", "MATCH-1", "PAT-001", "DON-101", "Kidney")
+
+	var activity []*ActivityEntry
+	l.mustInvokeJSON(&activity, "GetRecentActivity", "3")
+	got := []string{}
+	for _, e := range activity {
+		got = append(got, e.Type+" "+e.EntityID+" "+e.Timestamp)
+	}
+	want := []string{
+		"MATCH_CREATED MATCH-1 " + l.Now.Format(time.RFC3339),
+		"PATIENT_CREATED PAT-102 " + testEpoch.Add(2*time.Hour).Format(time.RFC3339),
+		"PATIENT_CREATED PAT-101 " + testEpoch.Add(time.Hour).Format(time.RFC3339),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("activity = %q, want %q", got, want)
+	}
+}
+
+func TestRecentActivitySortsMalformedTimestampsLast(t *testing.T) {
+	l := newTestLedger(t)
+	l.put(docTypeHospital, "HOSP-001", &Hospital{ID: "HOSP-001", DocType: docTypeHospital, IsActive: true})
+	for _, p := range []*Patient{
+		{ID: "PAT-001", CreatedAt: "yesterday"},
+		{ID: "PAT-002", CreatedAt: testEpoch.Format(time.RFC3339)},
+		{ID: "PAT-003", CreatedAt: testEpoch.Add(time.Hour).Format(time.RFC3339)},
+	} {
+		p.DocType, p.HospitalID, p.Status, p.OrganNeeded = docTypePatient, "HOSP-001", "WAITING", "Kidney"
+		l.put(docTypePatient, p.ID, p)
+	}
+	l.mustInvoke("RebuildIndexes")
+
+	ids := func(entries []*ActivityEntry) string {
+		got := []string{}
+		for _, e := range entries {
+			got = append(got, e.EntityID)
+		}
+		return strings.Join(got, " ")
+	}
+	want := "PAT-003 PAT-002 PAT-001"
+	var activity []*ActivityEntry
+	l.mustInvokeJSON(&activity, "GetRecentActivity", "10")
+	if got := ids(activity); got != want {
+		t.Errorf("recent activity = %s, want %s", got, want)
+	}
+	var dashboard HospitalDashboard
+	l.mustInvokeJSON(&dashboard, "GetHospitalDashboard", "HOSP-001")
+	if got := ids(dashboard.RecentActivity); got != want {
+		t.Errorf("dashboard activity = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Research records carry no record IDs, names, hashes, hospitals or HLA typings. Each
+// record is keyed by a pseudonym that is stable within one export, so transplants can
+// be joined to their patients and donors, but differs between exports. Dates are
+// given as months and durations in bands. The ledger holds no birth dates, so there
+// are no ages to release.
+
+// ResearchPatient is a de-identified patient.
+type ResearchPatient struct {
+	Key         string `json:"key"`
+	BloodType   string `json:"bloodType"`
+	OrganNeeded string `json:"organNeeded"`
+	Urgency     string `json:"urgency"`
+	Status      string `json:"status"`
+	CPRABand    string `json:"cpraBand"`
+	ListedMonth string `json:"listedMonth"`
+	// WaitBand is the patient's active waiting time so far; see waitBand.
+	WaitBand string `json:"waitBand"`
+}
+
+// ResearchDonor is a de-identified donor who has consented to research use.
+type ResearchDonor struct {
+	Key                string   `json:"key"`
+	BloodType          string   `json:"bloodType"`
+	DonorType          string   `json:"donorType,omitempty" metadata:",optional"`
+	OrgansAvailable    []string `json:"organsAvailable"`
+	VerificationStatus string   `json:"verificationStatus"`
+	RegisteredMonth    string   `json:"registeredMonth"`
+}
+
+// ResearchTransplant is a de-identified transplant whose donor has consented to
+// research use.
+type ResearchTransplant struct {
+	PatientKey      string `json:"patientKey"`
+	DonorKey        string `json:"donorKey"`
+	OrganType       string `json:"organType"`
+	TransplantMonth string `json:"transplantMonth"`
+	HLAScore        string `json:"hlaScore,omitempty" metadata:",optional"`
+	// WaitBand is the patient's active waiting time at the transplant.
+	WaitBand         string `json:"waitBand,omitempty" metadata:",optional"`
+	ColdIschemiaBand string `json:"coldIschemiaBand"`
+}
+
+// ResearchDataset is the result of ExportResearchDataset. ExcludedDonors counts the
+// donors left out, with their transplants, for lack of research consent.
+type ResearchDataset struct {
+	GeneratedAt    string                `json:"generatedAt"`
+	Patients       []*ResearchPatient    `json:"patients"`
+	Donors         []*ResearchDonor      `json:"donors"`
+	Transplants    []*ResearchTransplant `json:"transplants"`
+	ExcludedDonors int                   `json:"excludedDonors"`
+}
+
+// researchKey pseudonymizes a record ID for one export, salted with its transaction ID.
+func researchKey(txID, id string) string {
+	sum := sha256.Sum256([]byte(txID + "/" + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// researchMonth returns the month of an RFC 3339 timestamp, or "" if it has none.
+func researchMonth(ts string) string {
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01")
+}
+
+// band returns the label of the first band whose upper bound exceeds v, or the last
+// label if none does; labels has one more entry than bounds.
+func band(v float64, bounds []float64, labels []string) string {
+	for i, b := range bounds {
+		if v < b {
+			return labels[i]
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+func waitBand(d time.Duration) string {
+	return band(d.Hours()/24, []float64{30, 90, 180, 365, 730},
+		[]string{"<30d", "30-89d", "90-179d", "180-364d", "1-2y", "2y+"})
+}
+
+// cpraBand uses the usual clinical sensitization bands.
+func cpraBand(cpra int) string {
+	return band(float64(cpra), []float64{1, 20, 80, 98},
+		[]string{"0", "1-19", "20-79", "80-97", "98-100"})
+}
+
+func coldIschemiaBand(minutes int) string {
+	return band(float64(minutes)/60, []float64{4, 8, 12, 24},
+		[]string{"<4h", "4-7h", "8-11h", "12-23h", "24h+"})
+}
+
+// ExportResearchDataset returns de-identified patients, donors and transplants for a
+// researcher identity. Donors appear only with research consent and while their
+// donation consent stands; see SetResearchConsent.
+func (s *SmartContract) ExportResearchDataset(ctx contractapi.TransactionContextInterface) (*ResearchDataset, error) {
+	if err := requireRole(ctx, RoleResearcher); err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txID := ctx.GetStub().GetTxID()
+	dataset := &ResearchDataset{
+		GeneratedAt: now.Format(time.RFC3339), Patients: []*ResearchPatient{},
+		Donors: []*ResearchDonor{}, Transplants: []*ResearchTransplant{},
+	}
+
+	patients, err := allPatients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patients {
+		dataset.Patients = append(dataset.Patients, &ResearchPatient{
+			Key: researchKey(txID, p.ID), BloodType: p.BloodType, OrganNeeded: p.OrganNeeded,
+			Urgency: p.Urgency, Status: p.Status, CPRABand: cpraBand(p.CPRA),
+			ListedMonth: researchMonth(p.CreatedAt), WaitBand: waitBand(waitingTime(p, *now)),
+		})
+	}
+
+	donors, err := s.GetAllDonors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	consented := map[string]bool{}
+	for _, d := range donors {
+		if !d.ResearchConsent || d.VerificationStatus == "WITHDRAWN" {
+			dataset.ExcludedDonors++
+			continue
+		}
+		consented[d.ID] = true
+		dataset.Donors = append(dataset.Donors, &ResearchDonor{
+			Key: researchKey(txID, d.ID), BloodType: d.BloodType, DonorType: d.DonorType,
+			OrgansAvailable: d.OrgansAvailable, VerificationStatus: d.VerificationStatus,
+			RegisteredMonth: researchMonth(d.CreatedAt),
+		})
+	}
+
+	transplants, err := queryPopulate[Transplant](ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transplants {
+		if !consented[t.DonorID] {
+			continue
+		}
+		rt := &ResearchTransplant{
+			PatientKey: researchKey(txID, t.PatientID), DonorKey: researchKey(txID, t.DonorID),
+			OrganType: t.OrganType, TransplantMonth: researchMonth(t.TransplantDate),
+			ColdIschemiaBand: coldIschemiaBand(t.ColdIschemiaMinutes),
+		}
+		m, err := findState[Match](ctx, t.MatchID)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			rt.HLAScore = m.HLAScore
+		}
+		p, err := findState[Patient](ctx, t.PatientID)
+		if err != nil {
+			return nil, err
+		}
+		if performed, err := parseTimestamp(t.TransplantDate); err == nil && p != nil {
+			rt.WaitBand = waitBand(waitingTime(p, performed))
+		}
+		dataset.Transplants = append(dataset.Transplants, rt)
+	}
+	return dataset, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// currentSchemaVersion is the schema every record is written with. Records written
+// before schema versioning have no schemaVersion and are treated as version 1.
+// Changing a record struct in a way old data cannot be read into means bumping this
+// and adding the upgrade to schemaUpgrades.
+const currentSchemaVersion = 3
+
+// schemaUpgrades[v] upgrades the raw JSON of a record of the given docType from
+// schema version v to v+1.
+var schemaUpgrades = map[int]func(docType string, record map[string]interface{}) error{
+	1: upgradeSchemaV1,
+	2: upgradeSchemaV2,
+}
+
+// requiredLists are the list fields of each docType that must be present as arrays:
+// contractapi will not return a record holding null in place of one, which readers
+// such as GetDonor otherwise have to patch up.
+var requiredLists = map[string][]string{
+	docTypeDonor:    {"organsAvailable"},
+	docTypeAccess:   {"hospitalMsps", "adminMsps"},
+	docTypeChain:    {"pairIds", "matchIds"},
+	docTypeSerology: {"outstanding"},
+	docTypeDeath:    {"attestations"},
+	docTypeRegistry: {"transplantIds"},
+}
+
+// upgradeSchemaV1 replaces missing or null required lists with empty ones. Version 1
+// records were written by code that did not always initialise them.
+func upgradeSchemaV1(docType string, record map[string]interface{}) error {
+	for _, field := range requiredLists[docType] {
+		if record[field] == nil {
+			record[field] = []interface{}{}
+		}
+	}
+	return nil
+}
+
+// upgradeSchemaV2 replaces the comma-separated HLA string of patients and donors with
+// a typing by locus, and writes patients' unacceptable antigens as antigen-level names
+// such as A*02. A string that does not parse, such as a placeholder entered before
+// typing was validated, leaves the record untyped; its history keeps the original.
+func upgradeSchemaV2(docType string, record map[string]interface{}) error {
+	if docType != docTypePatient && docType != docTypeDonor {
+		return nil
+	}
+	if legacy, ok := record["hla"].(string); ok {
+		record["hla"], _ = parseHLATyping(legacy)
+	}
+	if list, ok := record["unacceptableAntigens"].([]interface{}); ok {
+		antigens := []interface{}{}
+		for _, a := range list {
+			name, _ := a.(string)
+			if locus, allele, err := parseHLAAllele(name); err == nil {
+				name = locus + "*" + hlaAntigen(allele)
+			}
+			antigens = append(antigens, name)
+		}
+		record["unacceptableAntigens"] = antigens
+	}
+	return nil
+}
+
+type schemaVersioned interface {
+	setSchemaVersion(v int)
+}
+
+func (p *Patient) setSchemaVersion(v int)            { p.SchemaVersion = v }
+func (d *Donor) setSchemaVersion(v int)              { d.SchemaVersion = v }
+func (m *Match) setSchemaVersion(v int)              { m.SchemaVersion = v }
+func (h *Hospital) setSchemaVersion(v int)           { h.SchemaVersion = v }
+func (t *Transplant) setSchemaVersion(v int)         { t.SchemaVersion = v }
+func (c *PolicyConfig) setSchemaVersion(v int)       { c.SchemaVersion = v }
+func (c *AccessConfig) setSchemaVersion(v int)       { c.SchemaVersion = v }
+func (o *Organ) setSchemaVersion(v int)              { o.SchemaVersion = v }
+func (o *Offer) setSchemaVersion(v int)              { o.SchemaVersion = v }
+func (p *ExchangePair) setSchemaVersion(v int)       { p.SchemaVersion = v }
+func (c *ExchangeChain) setSchemaVersion(v int)      { c.SchemaVersion = v }
+func (p *SerologyPanel) setSchemaVersion(v int)      { p.SchemaVersion = v }
+func (d *DeathDeclaration) setSchemaVersion(v int)   { d.SchemaVersion = v }
+func (t *EpletTable) setSchemaVersion(v int)         { t.SchemaVersion = v }
+func (r *RegistrySubmission) setSchemaVersion(v int) { r.SchemaVersion = v }
+
+// stampSchema marks data as written with the current schema if it is a record type.
+func stampSchema(data any) {
+	if r, ok := data.(schemaVersioned); ok {
+		r.setSchemaVersion(currentSchemaVersion)
+	}
+}
+
+// schemaDocTypes lists every docType carrying a schemaVersion, including the
+// append-only score and custody logs that are not written through putState.
+var schemaDocTypes = append(append([]string{}, recordDocTypes...), docTypeScore, docTypeCustody)
+
+// MigrateLedger upgrades every record below targetVersion to it in place, applying
+// each schema upgrade in turn. Records already at or above targetVersion are left
+// alone, as are their record versions: a migration is not an update. Records that
+// are not valid JSON are reported as skipped.
+func (s *SmartContract) MigrateLedger(ctx contractapi.TransactionContextInterface, targetVersion int) (*MigrationSummary, error) {
+	if err := s.requireNetworkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if targetVersion < 1 || targetVersion > currentSchemaVersion {
+		return nil, codedError(CodeInvalidArgument, "", "targetVersion", "target schema version must be between 1 and %d", currentSchemaVersion)
+	}
+
+	summary := &MigrationSummary{Migrated: map[string]int{}, Skipped: []string{}}
+	for _, docType := range schemaDocTypes {
+		if err := migrateDocType(ctx, docType, targetVersion, summary); err != nil {
+			return nil, err
+		}
+	}
+	if err := emitEvent(ctx, EventLedgerMigrated, map[string]interface{}{
+		"targetVersion": targetVersion, "migrated": summary.Migrated,
+	}); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func migrateDocType(ctx contractapi.TransactionContextInterface, docType string, targetVersion int, summary *MigrationSummary) error {
+	it, err := ctx.GetStub().GetStateByPartialCompositeKey(docType, []string{})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return err
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(kv.Value, &record); err != nil || record == nil {
+			_, attrs, _ := ctx.GetStub().SplitCompositeKey(kv.Key)
+			summary.Skipped = append(summary.Skipped, docType+"/"+strings.Join(attrs, "/"))
+			continue
+		}
+		version := 1
+		if v, ok := record["schemaVersion"].(float64); ok && v >= 1 {
+			version = int(v)
+		}
+		if version >= targetVersion {
+			continue
+		}
+		for ; version < targetVersion; version++ {
+			if err := schemaUpgrades[version](docType, record); err != nil {
+				return fmt.Errorf("cannot upgrade %s record to schema %d: %v", docType, version+1, err)
+			}
+		}
+		record["schemaVersion"] = targetVersion
+		bytes, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(kv.Key)
+		if err != nil {
+			return err
+		}
+		if err := writeAudit(ctx, docType, attrs[0], kv.Key, bytes); err != nil {
+			return err
+		}
+		if err := ctx.GetStub().PutState(kv.Key, bytes); err != nil {
+			return err
+		}
+		summary.Migrated[docType]++
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ScreeningTests are the infectious disease screens that may be recorded for a donor.
+var ScreeningTests = []string{"HIV", "HBV", "HCV", "CMV", "EBV", "SYPHILIS", "HTLV", "TOXOPLASMA"}
+
+// MandatoryScreens must each be negative, or flagged as an accepted risk, before a
+// donor can be matched.
+var MandatoryScreens = []string{"HIV", "HBV", "HCV", "CMV"}
+
+// ScreeningOutcomes are the possible results of a screening test.
+var ScreeningOutcomes = []string{"NEGATIVE", "POSITIVE", "INDETERMINATE"}
+
+// ScreeningResult is the latest result of one screening test. FlagNote records why a
+// positive or indeterminate donor may still be used, e.g. a CMV-positive donor for a
+// CMV-positive recipient.
+type ScreeningResult struct {
+	Test       string `json:"test"`
+	Result     string `json:"result"`
+	LabID      string `json:"labId"`
+	FlagNote   string `json:"flagNote,omitempty" metadata:",optional"`
+	RecordedBy string `json:"recordedBy"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// SerologyPanel is a donor's infectious disease screening, keyed by donor ID. Each
+// test keeps only its latest result; earlier results remain in the key history.
+type SerologyPanel struct {
+	DonorID       string                      `json:"donorId"`
+	Results       map[string]*ScreeningResult `json:"results"`
+	Cleared       bool                        `json:"cleared"`
+	Outstanding   []string                    `json:"outstanding"`
+	DocType       string                      `json:"docType"`
+	SchemaVersion int                         `json:"schemaVersion"`
+	UpdatedAt     string                      `json:"updatedAt"`
+}
+
+// evaluate lists the mandatory screens that are missing, or non-negative without a
+// flag, and sets Cleared when there are none.
+func (panel *SerologyPanel) evaluate() {
+	panel.Outstanding = []string{}
+	for _, test := range MandatoryScreens {
+		r := panel.Results[test]
+		if r == nil || (r.Result != "NEGATIVE" && strings.TrimSpace(r.FlagNote) == "") {
+			panel.Outstanding = append(panel.Outstanding, test)
+		}
+	}
+	panel.Cleared = len(panel.Outstanding) == 0
+}
+
+// RecordScreeningResult records a lab's result for one screening test on a donor and
+// re-evaluates whether the donor has cleared screening. A POSITIVE or INDETERMINATE
+// result on a mandatory screen keeps the donor out of matching unless flagNote
+// explains why the organs may still be offered.
+func (s *SmartContract) RecordScreeningResult(ctx contractapi.TransactionContextInterface, donorId, test, result, labId, flagNote string) (*SerologyPanel, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	test, result = strings.ToUpper(test), strings.ToUpper(result)
+	if !containsString(ScreeningTests, test) {
+		return nil, codedError(CodeInvalidArgument, "", "test", "unknown screening test %q: must be one of %s", test, strings.Join(ScreeningTests, ", "))
+	}
+	if !containsString(ScreeningOutcomes, result) {
+		return nil, codedError(CodeInvalidArgument, "", "result", "invalid screening result %q: must be one of %s", result, strings.Join(ScreeningOutcomes, ", "))
+	}
+	if strings.TrimSpace(labId) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "labId", "a lab ID is required")
+	}
+	d, err := s.GetDonor(ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	panel, err := findState[SerologyPanel](ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if panel == nil {
+		panel = &SerologyPanel{DonorID: donorId, Results: map[string]*ScreeningResult{}, DocType: docTypeSerology}
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	panel.Results[test] = &ScreeningResult{
+		Test: test, Result: result, LabID: labId, FlagNote: flagNote, RecordedBy: mspID, Timestamp: ts,
+	}
+	panel.UpdatedAt = ts
+	panel.evaluate()
+	if err := putState(ctx, donorId, panel); err != nil {
+		return nil, err
+	}
+	if d.ScreeningCleared != panel.Cleared {
+		d.ScreeningCleared = panel.Cleared
+		if err := putState(ctx, d.ID, d); err != nil {
+			return nil, err
+		}
+	}
+	err = emitEvent(ctx, EventScreeningRecorded, map[string]interface{}{
+		"donorId": donorId, "test": test, "result": result, "flagged": flagNote != "", "cleared": panel.Cleared,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return panel, nil
+}
+
+// GetSerologyPanel returns a donor's screening results. Donors with nothing recorded
+// get an empty panel listing every mandatory screen as outstanding.
+func (s *SmartContract) GetSerologyPanel(ctx contractapi.TransactionContextInterface, donorId string) (*SerologyPanel, error) {
+	if _, err := s.GetDonor(ctx, donorId); err != nil {
+		return nil, err
+	}
+	panel, err := findState[SerologyPanel](ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if panel == nil {
+		panel = &SerologyPanel{DonorID: donorId, Results: map[string]*ScreeningResult{}, DocType: docTypeSerology}
+		panel.evaluate()
+	}
+	return panel, nil
+}
+
+// seedSerologyPanel is the all-negative panel InitLedger gives each sample donor.
+func seedSerologyPanel(donorId, owner, ts string) *SerologyPanel {
+	panel := &SerologyPanel{DonorID: donorId, Results: map[string]*ScreeningResult{}, DocType: docTypeSerology, UpdatedAt: ts}
+	for _, test := range MandatoryScreens {
+		panel.Results[test] = &ScreeningResult{Test: test, Result: "NEGATIVE", LabID: "SEED", RecordedBy: owner, Timestamp: ts}
+	}
+	panel.evaluate()
+	return panel
+}
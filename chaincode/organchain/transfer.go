@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PatientTransfer moves a patient's listing from one hospital to another. The current
+// hospital initiates it and the receiving hospital accepts it; the patient keeps the
+// listing date and inactive time, so waiting time carries over.
+type PatientTransfer struct {
+	FromHospitalID string `json:"fromHospitalId"`
+	ToHospitalID   string `json:"toHospitalId"`
+	Reason         string `json:"reason"`
+	InitiatedBy    string `json:"initiatedBy"`
+	InitiatedAt    string `json:"initiatedAt"`
+	AcceptedBy     string `json:"acceptedBy,omitempty" metadata:",optional"`
+	AcceptedAt     string `json:"acceptedAt,omitempty" metadata:",optional"`
+}
+
+// transferableStatuses are the statuses a patient may be transferred in. A MATCHED
+// patient's match holds an organ at the current hospital.
+var transferableStatuses = map[string]bool{"WAITING": true, "INACTIVE": true}
+
+// InitiateTransfer offers a patient's listing to another active hospital. Only the
+// patient's current hospital (or the admin hospital) may initiate it, and the patient
+// stays there until the receiving hospital calls AcceptTransfer.
+func (s *SmartContract) InitiateTransfer(ctx contractapi.TransactionContextInterface, patientId, toHospitalId, reason string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to transfer a patient")
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, patientId, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot transfer patient")
+	}
+	if !transferableStatuses[p.Status] {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is %s and cannot be transferred", p.ID, p.Status)
+	}
+	if p.PendingTransfer != nil {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s already has a pending transfer to %s", p.ID, p.PendingTransfer.ToHospitalID)
+	}
+	if toHospitalId == p.HospitalID {
+		return nil, codedError(CodeInvalidArgument, "", "toHospitalId", "patient %s is already registered at %s", p.ID, toHospitalId)
+	}
+	if _, err := activeHospital(ctx, toHospitalId); err != nil {
+		return nil, err
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.PendingTransfer = &PatientTransfer{
+		FromHospitalID: p.HospitalID, ToHospitalID: toHospitalId, Reason: reason,
+		InitiatedBy: actor.ID, InitiatedAt: now.Format(time.RFC3339),
+	}
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientTransferInitiated, map[string]interface{}{
+		"patientId": p.ID, "fromHospitalId": p.HospitalID, "toHospitalId": toHospitalId, "hospitalId": hospitalId, "reason": reason,
+	})
+}
+
+// AcceptTransfer completes a patient's pending transfer. The caller must act for the
+// receiving hospital, which takes over the listing and, with it, ownership of the
+// record by its org.
+func (s *SmartContract) AcceptTransfer(ctx contractapi.TransactionContextInterface, patientId string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	t := p.PendingTransfer
+	if t == nil {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s has no pending transfer", p.ID)
+	}
+	if t.ToHospitalID != hospitalId {
+		return nil, codedError(CodeForbidden, docTypePatient, "", "the transfer of patient %s is to hospital %s, not %s", p.ID, t.ToHospitalID, hospitalId)
+	}
+	if !transferableStatuses[p.Status] {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is %s and cannot be transferred", p.ID, p.Status)
+	}
+	if err := requireVersion("patient", p.ID, p.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	h, err := activeHospital(ctx, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.AcceptedBy, t.AcceptedAt = actor.ID, now.Format(time.RFC3339)
+	p.Transfers = append(p.Transfers, t)
+	p.PendingTransfer = nil
+	p.HospitalID, p.OwnerMSP = hospitalId, h.OwnerMSP
+	p.TransferRequired = false
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientTransferred, map[string]interface{}{
+		"patientId": p.ID, "fromHospitalId": t.FromHospitalID, "toHospitalId": t.ToHospitalID,
+		"waitingDays": int(waitingTime(p, *now) / (24 * time.Hour)),
+	})
+}
+
+// CancelTransfer withdraws a patient's pending transfer. Either hospital may cancel
+// it: the current one to take back the offer, the receiving one to decline it.
+func (s *SmartContract) CancelTransfer(ctx contractapi.TransactionContextInterface, patientId string, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := getState[Patient](ctx, patientId)
+	if err != nil {
+		return nil, err
+	}
+	t := p.PendingTransfer
+	if t == nil {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s has no pending transfer", p.ID)
+	}
+	if hospitalId != t.FromHospitalID && hospitalId != t.ToHospitalID && hospitalId != adminHospitalID {
+		return nil, codedError(CodeForbidden, docTypePatient, "", "hospital %s is not party to the transfer of patient %s", hospitalId, p.ID)
+	}
+	if err := requireVersion("patient", p.ID, p.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	p.PendingTransfer = nil
+	if err := putState(ctx, p.ID, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientTransferCancelled, map[string]interface{}{
+		"patientId": p.ID, "fromHospitalId": t.FromHospitalID, "toHospitalId": t.ToHospitalID, "hospitalId": hospitalId,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Record ID prefixes. IDs are the prefix followed by letters, digits, '-' or '_'.
+const (
+	patientIDPrefix  = "PAT-"
+	donorIDPrefix    = "DON-"
+	matchIDPrefix    = "MATCH-"
+	hospitalIDPrefix = "HOSP-"
+	pairIDPrefix     = "PAIR-"
+	chainIDPrefix    = "KPE-"
+)
+
+var (
+	idSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	// phonePattern accepts an optional leading + and digits grouped by spaces,
+	// dashes, dots or parentheses, as in +44 20 7946 0958 or (555) 123-4567.
+	phonePattern = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+	// sha256HexPattern is a SHA-256 digest in lowercase hex.
+	sha256HexPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// FieldError is one failed check on an argument.
+type FieldError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validateFields combines the results of argument checks. A single failure is returned
+// as it is; several are returned together under VALIDATION_FAILED, one entry per field,
+// so a form can mark every bad field at once.
+func validateFields(checks ...error) error {
+	var failed []*ChaincodeError
+	for _, err := range checks {
+		if err == nil {
+			continue
+		}
+		ce, ok := err.(*ChaincodeError)
+		if !ok {
+			return err
+		}
+		failed = append(failed, ce)
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	env := &ChaincodeError{Code: CodeValidationFailed, Errors: []*FieldError{}}
+	messages := []string{}
+	for _, ce := range failed {
+		env.Errors = append(env.Errors, &FieldError{Code: ce.Code, Field: ce.Field, Message: ce.Message})
+		messages = append(messages, ce.Message)
+	}
+	env.Message = strings.Join(messages, "; ")
+	return env
+}
+
+// validateID checks that id is prefix followed by at least one ID character.
+func validateID(field, prefix, id string) error {
+	if !strings.HasPrefix(id, prefix) || !idSuffixPattern.MatchString(strings.TrimPrefix(id, prefix)) {
+		return codedError(CodeInvalidID, "", field, "%s %q must be %s followed by letters, digits, '-' or '_'", field, id, prefix)
+	}
+	return nil
+}
+
+// validateIdentityHash checks that a national ID reaches the ledger only as a
+// SHA-256 hex digest. The hash is optional.
+func validateIdentityHash(field, hash string) error {
+	if hash != "" && !sha256HexPattern.MatchString(hash) {
+		return codedError(CodeInvalidArgument, "", field, "%s must be a SHA-256 digest in lowercase hex, not the ID itself", field)
+	}
+	return nil
+}
+
+// validateRequired checks that a free-text argument is not blank.
+func validateRequired(field, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return codedError(CodeInvalidArgument, "", field, "%s is required", field)
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if email != "" && !emailPattern.MatchString(email) {
+		return codedError(CodeInvalidEmail, "", "email", "invalid email address %q", email)
+	}
+	return nil
+}
+
+// validatePhone accepts 7 to 15 digits, the range of E.164 numbers with and without
+// their country code.
+func validatePhone(phone string) error {
+	if phone == "" {
+		return nil
+	}
+	digits := 0
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if !phonePattern.MatchString(phone) || digits < 7 || digits > 15 {
+		return codedError(CodeInvalidPhone, "", "phone", "invalid phone number %q", phone)
+	}
+	return nil
+}
+
+// validateDonorContact checks the contact details of donor PII, which are optional.
+func validateDonorContact(pii *DonorPrivate) error {
+	return validateFields(validateEmail(pii.Email), validatePhone(pii.Phone))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCreatePatientValidatesOrganAndBloodType(t *testing.T) {
+	tests := []struct {
+		organ, bloodType string
+		wantCode         string
+	}{
+		{"Kidney", "O-", ""},
+		{"Liver", "O+", ""},
+		{"Heart", "A-", ""},
+		{"Lung", "A+", ""},
+		{"Pancreas", "B-", ""},
+		{"Intestine", "B+", ""},
+		{"Cornea", "AB-", ""},
+		{"Kidney", "AB+", ""},
+		{"kidney", "O+", CodeInvalidOrgan},
+		{"Spleen", "O+", CodeInvalidOrgan},
+		{"", "O+", CodeInvalidOrgan},
+		{"Kidney", "AB", CodeInvalidBloodType},
+		{"Kidney", "o+", CodeInvalidBloodType},
+		{"Kidney", "A+ ", CodeInvalidBloodType},
+		{"Kidney", "", CodeInvalidBloodType},
+	}
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	for i, tc := range tests {
+		id := fmt.Sprintf("PAT-2%02d", i)
+		args := []string{id, "h", tc.bloodType, "A2, B8, DR15", tc.organ, "", "ROUTINE", ""}
+		if tc.wantCode == "" {
+			l.mustInvoke("CreatePatient", args...)
+			if p := l.patient(id); p.OrganNeeded != tc.organ || p.BloodType != tc.bloodType {
+				t.Errorf("patient %s = %s %s, want %s %s", id, p.OrganNeeded, p.BloodType, tc.organ, tc.bloodType)
+			}
+			continue
+		}
+		if err := l.mustFail("CreatePatient", args...); err.Code != tc.wantCode {
+			t.Errorf("CreatePatient(organ %q, blood type %q) error = %s %s, want %s", tc.organ, tc.bloodType, err.Code, err.Message, tc.wantCode)
+		}
+		if l.record(docTypePatient, id, &Patient{}) {
+			t.Errorf("patient %s was written with organ %q and blood type %q", id, tc.organ, tc.bloodType)
+		}
+	}
+}
+
+func TestCreateDonorValidatesOrgansAvailable(t *testing.T) {
+	tests := []struct {
+		organs   string
+		wantCode string
+	}{
+		{`["Kidney"]`, ""},
+		{`["Kidney","Liver","Heart","Lung","Pancreas","Intestine","Cornea"]`, ""},
+		{`[]`, CodeInvalidOrgan},
+		{`null`, CodeInvalidOrgan},
+		{`["Kidney","Kidney"]`, CodeInvalidOrgan},
+		{`["Liver","Heart","Liver"]`, CodeInvalidOrgan},
+		{`["Kidney","Spleen"]`, CodeInvalidOrgan},
+		{`["kidney"]`, CodeInvalidOrgan},
+		{`"Kidney"`, CodeInvalidArgument},
+		{``, CodeInvalidArgument},
+	}
+	l := newSeededLedger(t)
+	l.asHospital("HOSP-001")
+	for i, tc := range tests {
+		id := fmt.Sprintf("DON-2%02d", i)
+		l.Transient = map[string][]byte{donorPIITransientKey: []byte(`{"name":"Donor"}`)}
+		args := []string{id, "O-", "A2, B8, DR15", tc.organs, "", "consent", "", "", ""}
+		if tc.wantCode == "" {
+			l.mustInvoke("CreateDonor", args...)
+			continue
+		}
+		if err := l.mustFail("CreateDonor", args...); err.Code != tc.wantCode {
+			t.Errorf("CreateDonor(organs %s) error = %s %s, want %s", tc.organs, err.Code, err.Message, tc.wantCode)
+		}
+		if l.record(docTypeDonor, id, &Donor{}) {
+			t.Errorf("donor %s was written with organs %s", id, tc.organs)
+		}
+	}
+}
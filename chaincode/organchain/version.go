@@ -0,0 +1,28 @@
+package main
+
+// versioned records carry a counter that putState advances on every write. Update
+// functions take the version the caller last read and reject the write if the record
+// has moved on since, so two hospitals editing the same record in one block cannot
+// silently overwrite each other; the second transaction fails and must be retried.
+type versioned interface {
+	nextVersion()
+}
+
+func (p *Patient) nextVersion() { p.Version++ }
+func (d *Donor) nextVersion()   { d.Version++ }
+func (m *Match) nextVersion()   { m.Version++ }
+
+// bumpVersion advances the version of data if it is a versioned record.
+func bumpVersion(data any) {
+	if v, ok := data.(versioned); ok {
+		v.nextVersion()
+	}
+}
+
+// requireVersion fails unless the caller's expected version matches the stored one.
+func requireVersion(kind, id string, current, expected int) error {
+	if current != expected {
+		return codedError(CodeVersionConflict, kind, "expectedVersion", "%s %s is at version %d, not %d; reload it and retry", kind, id, current, expected)
+	}
+	return nil
+}
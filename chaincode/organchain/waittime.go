@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// waitPointsPerYear is the allocation priority a patient earns for each year of
+// active waiting time. A year on the list is worth one HLA allele match.
+const waitPointsPerYear = 1.0
+
+// waitingTime is how long a patient has been actively listed: the time since
+// listing less every period spent INACTIVE, including the current one. It stops at
+// the patient's removal from the waitlist.
+func waitingTime(p *Patient, now time.Time) time.Duration {
+	if p.Removal != nil {
+		if removed, err := parseTimestamp(p.Removal.RemovedAt); err == nil && removed.Before(now) {
+			now = removed
+		}
+	}
+	listed, err := parseTimestamp(p.CreatedAt)
+	if err != nil || now.Before(listed) {
+		return 0
+	}
+	wait := now.Sub(listed) - time.Duration(p.InactiveSeconds)*time.Second
+	if p.Status == "INACTIVE" {
+		if since, err := parseTimestamp(p.InactiveSince); err == nil && now.After(since) {
+			wait -= now.Sub(since)
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// waitTimePoints converts active waiting time to priority points, rounded to two places.
+func waitTimePoints(wait time.Duration) float64 {
+	years := wait.Hours() / (24 * 365)
+	return math.Round(years*waitPointsPerYear*100) / 100
+}
+
+// DeactivatePatient puts a waiting patient on hold, e.g. while an infection is treated.
+// Inactive patients are left out of allocation and their waiting time stops accruing.
+func (s *SmartContract) DeactivatePatient(ctx contractapi.TransactionContextInterface, id, reason string, expectedVersion int) (*Patient, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to deactivate a patient")
+	}
+	return s.setPatientActive(ctx, id, reason, false, expectedVersion)
+}
+
+// ReactivatePatient returns an inactive patient to the waitlist. The time spent
+// inactive is added to the patient's total and not counted as waiting time.
+func (s *SmartContract) ReactivatePatient(ctx contractapi.TransactionContextInterface, id string, expectedVersion int) (*Patient, error) {
+	return s.setPatientActive(ctx, id, "", true, expectedVersion)
+}
+
+func (s *SmartContract) setPatientActive(ctx contractapi.TransactionContextInterface, id, reason string, active bool, expectedVersion int) (*Patient, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	p, hospitalId, err := s.patientForHospital(ctx, id, expectedVersion)
+	if err != nil {
+		return nil, wrapError(err, "cannot change patient status")
+	}
+	from, to := "WAITING", "INACTIVE"
+	if active {
+		from, to = to, from
+	}
+	if p.Status != from {
+		return nil, codedError(CodeInvalidTransition, docTypePatient, "", "patient %s is %s, not %s", p.ID, p.Status, from)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts := now.Format(time.RFC3339)
+
+	if active {
+		if since, err := parseTimestamp(p.InactiveSince); err == nil && now.After(since) {
+			p.InactiveSeconds += int64(now.Sub(since) / time.Second)
+		}
+		p.InactiveSince = ""
+		p.InactiveReason = ""
+	} else {
+		p.InactiveSince = ts
+		p.InactiveReason = reason
+	}
+	p.Status = to
+	if err := putState(ctx, id, p); err != nil {
+		return nil, err
+	}
+	return p, emitEvent(ctx, EventPatientUpdated, map[string]interface{}{
+		"patientId": id, "status": to, "hospitalId": hospitalId, "reason": reason,
+		"waitingDays": int(waitingTime(p, *now) / (24 * time.Hour)),
+	})
+}
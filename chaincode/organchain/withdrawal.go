@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DonorInactive is the status of a donor taken out of matching by WithdrawDonor. Unlike
+// REJECTED it says nothing about the donor's verification, and unlike WITHDRAWN it is
+// not a revocation of consent.
+const DonorInactive = "INACTIVE"
+
+// Who may initiate a donor's withdrawal.
+const (
+	WithdrawalByDonor    = "DONOR"
+	WithdrawalByFamily   = "FAMILY"
+	WithdrawalByHospital = "HOSPITAL"
+)
+
+// DonorWithdrawalInitiators are the initiators WithdrawDonor accepts.
+var DonorWithdrawalInitiators = []string{WithdrawalByDonor, WithdrawalByFamily, WithdrawalByHospital}
+
+// withdrawableDonorStatuses are the statuses of a donor still in matching or awaiting
+// verification.
+var withdrawableDonorStatuses = map[string]bool{"PENDING_VERIFICATION": true, "VERIFIED": true}
+
+// DonorWithdrawal records who asked for a donor to be withdrawn and who recorded it.
+type DonorWithdrawal struct {
+	InitiatedBy      string   `json:"initiatedBy"`
+	Reason           string   `json:"reason"`
+	HospitalID       string   `json:"hospitalId"`
+	WithdrawnBy      string   `json:"withdrawnBy"`
+	WithdrawnAt      string   `json:"withdrawnAt"`
+	PreviousStatus   string   `json:"previousStatus"`
+	CancelledMatches []string `json:"cancelledMatches"`
+	CancelledOffers  []string `json:"cancelledOffers"`
+}
+
+// WithdrawDonor takes a donor out of matching at the request of initiatedBy, one of
+// DonorWithdrawalInitiators, and sets their status to INACTIVE. Pending offers and
+// matches on the donor are cancelled as in withdrawConsent. A donor revoking consent
+// should go through WithdrawDonorConsent or RevokeConsent instead. Only the donor's
+// owning org may withdraw them.
+func (s *SmartContract) WithdrawDonor(ctx contractapi.TransactionContextInterface, donorId, initiatedBy, reason string, expectedVersion int) (*Donor, error) {
+	if err := s.requireHospitalWriter(ctx); err != nil {
+		return nil, err
+	}
+	if !containsString(DonorWithdrawalInitiators, initiatedBy) {
+		return nil, codedError(CodeInvalidArgument, "", "initiatedBy", "unknown initiator %q; expected one of %s", initiatedBy, strings.Join(DonorWithdrawalInitiators, ", "))
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, codedError(CodeInvalidArgument, "", "reason", "a reason is required to withdraw a donor")
+	}
+	d, err := getState[Donor](ctx, donorId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwnerOrg(ctx, d.OwnerMSP); err != nil {
+		return nil, err
+	}
+	if err := requireNotArchived(d); err != nil {
+		return nil, err
+	}
+	if !withdrawableDonorStatuses[d.VerificationStatus] {
+		return nil, codedError(CodeInvalidTransition, docTypeDonor, "", "donor %s is %s and cannot be withdrawn", d.ID, d.VerificationStatus)
+	}
+	if err := requireVersion("donor", d.ID, d.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	hospitalId, err := actingHospital(ctx)
+	if err != nil {
+		return nil, wrapError(err, "cannot withdraw donor")
+	}
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches, offers, err := s.releaseDonor(ctx, d, "CANCELLED", ReasonDonorWithdrawn, "donor withdrawn: "+reason)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Withdrawal = &DonorWithdrawal{
+		InitiatedBy: initiatedBy, Reason: reason, HospitalID: hospitalId, WithdrawnBy: actor.ID,
+		WithdrawnAt: now.Format(time.RFC3339), PreviousStatus: d.VerificationStatus,
+		CancelledMatches: matches, CancelledOffers: offers,
+	}
+	d.VerificationStatus = DonorInactive
+	d.OrgansAvailable = []string{}
+	if err := putState(ctx, d.ID, d); err != nil {
+		return nil, err
+	}
+	if err := s.syncDonorOrgans(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, emitEvent(ctx, EventDonorWithdrawn, map[string]interface{}{
+		"donorId": d.ID, "initiatedBy": initiatedBy, "hospitalId": hospitalId,
+		"cancelledMatches": matches, "cancelledOffers": offers,
+	})
+}
+
+// releaseDonor closes a departing donor's pending matches in matchStatus and cancels
+// their pending offers, discarding the organs either held. Patients of the closed
+// matches go back to the waitlist unless another match still holds them. Approved
+// matches are left to the transplant teams. It returns the IDs of the matches and
+// offers it closed.
+func (s *SmartContract) releaseDonor(ctx contractapi.TransactionContextInterface, d *Donor, matchStatus, reasonCode, reason string) ([]string, []string, error) {
+	ts, err := s.getTimestamp(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	matches, err := matchesByIndex(ctx, indexMatchDonor, d.ID, func(m *Match) bool { return m.Status == "PENDING" })
+	if err != nil {
+		return nil, nil, err
+	}
+	closed := []string{}
+	for _, m := range matches {
+		if err := s.transitionMatch(ctx, m, matchStatus, "", reasonCode, reason); err != nil {
+			return nil, nil, err
+		}
+		if err := s.setOrganStatus(ctx, d.ID, m.OrganType, OrganDiscarded, "", ""); err != nil {
+			return nil, nil, err
+		}
+		closed = append(closed, m.ID)
+		if err := returnToWaitlist(ctx, m.PatientID, closed...); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	offers, err := queryPopulate[Offer](ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cancelled := []string{}
+	for _, offer := range offers {
+		if offer.DonorID != d.ID || offer.Status != "PENDING" {
+			continue
+		}
+		offer.Status, offer.RespondedAt = "CANCELLED", ts
+		offer.ReasonCode, offer.Reason = reasonCode, reason
+		if err := putState(ctx, offer.ID, offer); err != nil {
+			return nil, nil, err
+		}
+		if err := s.setOrganStatus(ctx, d.ID, offer.OrganType, OrganDiscarded, "", ""); err != nil {
+			return nil, nil, err
+		}
+		cancelled = append(cancelled, offer.ID)
+	}
+	return closed, cancelled, nil
+}
@@ -259,7 +259,7 @@ export default function App() {
                     type="text"
                     value={hospitalId}
                     onChange={(e) => setHospitalId(e.target.value.toUpperCase())}
-                    placeholder="e.g., ADMIN-HOSP"
+                    placeholder="e.g., HOSP-ADMIN"
                     className="w-full px-6 py-4 rounded-[16px] bg-slate-50 border border-slate-200 focus:bg-white focus:border-[#10b981] focus:ring-4 focus:ring-[#10b981]/10 outline-none text-base text-[#064e3b] font-medium transition-all"
                   />
                 </div>
@@ -301,7 +301,7 @@ export default function App() {
 
                 <div className="text-center text-xs text-slate-400 pt-2">
                   <p className="font-medium">Admin Credentials:</p>
-                  <p className="font-mono mt-1">ADMIN-HOSP / admin123</p>
+                  <p className="font-mono mt-1">HOSP-ADMIN / admin123</p>
                 </div>
               </form>
             )}
@@ -375,7 +375,7 @@ export default function App() {
 
         <main className="flex-1 min-w-0">
           <div className="bg-white rounded-[32px] p-12 shadow-sm border border-slate-100 min-h-[600px] animate-in slide-in-from-bottom-4 duration-500">
-            {view === 'dashboard' && <Dashboard patients={patients} donors={donors} />}
+            {view === 'dashboard' && <Dashboard patients={patients} donors={donors} hospitalId={role === 'HOSPITAL_ADMIN' ? hospitalId : ''} />}
             {view === 'ledger' && (
               <Ledger patients={patients} donors={donors} apiConnected={apiConnected} />
             )}
@@ -2,8 +2,15 @@ const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:3001/api'
 
 const handleResponse = async (response) => {
     if (!response.ok) {
-        const error = await response.json().catch(() => ({}));
-        throw new Error(error.error || error.message || `HTTP error! status: ${response.status}`);
+        const body = await response.json().catch(() => ({}));
+        const error = new Error(body.error || body.message || `HTTP error! status: ${response.status}`);
+        // Chaincode failures carry a code such as DONOR_NOT_FOUND for localized messages.
+        error.code = body.code;
+        error.entity = body.entity;
+        error.field = body.field;
+        error.errors = body.errors;
+        error.status = response.status;
+        throw error;
     }
     return response.json();
 };
@@ -12,12 +19,36 @@ export const api = {
     async getHealth() {
         return handleResponse(await fetch(`${API_BASE_URL}/health`));
     },
+    async getStats() {
+        return handleResponse(await fetch(`${API_BASE_URL}/stats`));
+    },
+    async getTransplantStats({ granularity = 'month', from = '', to = '' } = {}) {
+        const query = new URLSearchParams({ granularity, from, to });
+        return handleResponse(await fetch(`${API_BASE_URL}/stats/transplants?${query}`));
+    },
+    async getHospitalDashboard(hospitalId) {
+        return handleResponse(await fetch(`${API_BASE_URL}/hospitals/${encodeURIComponent(hospitalId)}/dashboard`));
+    },
     async getPatients() {
         return handleResponse(await fetch(`${API_BASE_URL}/patients`));
     },
+    async getWaitingPatients({ organ, bloodType = '', status = '' }) {
+        const query = new URLSearchParams({ organ, bloodType, status });
+        return handleResponse(await fetch(`${API_BASE_URL}/patients/waiting?${query}`));
+    },
+    waitlistCsvUrl(organ) {
+        return `${API_BASE_URL}/patients/waitlist.csv?${new URLSearchParams({ organ })}`;
+    },
     async getDonors() {
         return handleResponse(await fetch(`${API_BASE_URL}/donors`));
     },
+    async getAvailableDonors({ organ, bloodType = '' }) {
+        const query = new URLSearchParams({ organ, bloodType });
+        return handleResponse(await fetch(`${API_BASE_URL}/donors/available?${query}`));
+    },
+    async findMatchesForPatient(patientId) {
+        return handleResponse(await fetch(`${API_BASE_URL}/patients/${patientId}/matches`));
+    },
     async login(hospitalId, passwordHash) {
         return handleResponse(await fetch(`${API_BASE_URL}/auth/login`, {
             method: 'POST',
@@ -39,6 +70,34 @@ export const api = {
             body: JSON.stringify(donorData)
         }));
     },
+    // Batch calls resolve to { created, failed, results } with one result per record.
+    async createPatientsBatch(records) {
+        return handleResponse(await fetch(`${API_BASE_URL}/patients/batch`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ records })
+        }));
+    },
+    async createDonorsBatch(records) {
+        return handleResponse(await fetch(`${API_BASE_URL}/donors/batch`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ records })
+        }));
+    },
+    // rows are { docType: 'patient' | 'donor', record }; resolves to the per-row import report.
+    async importRecords(rows, { dryRun = false } = {}) {
+        return handleResponse(await fetch(`${API_BASE_URL}/import`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ rows, dryRun })
+        }));
+    },
+    // filter is one of { patientId }, { donorId } or { hospitalId }; empty returns all matches.
+    async getMatches(filter = {}) {
+        const query = new URLSearchParams(filter);
+        return handleResponse(await fetch(`${API_BASE_URL}/matches?${query}`));
+    },
     async createMatch(matchData) {
         return handleResponse(await fetch(`${API_BASE_URL}/matches`, {
             method: 'POST',
@@ -46,11 +105,39 @@ export const api = {
             body: JSON.stringify(matchData)
         }));
     },
-    async updateDonorStatus(donorId, organToRemove) {
+    async approveMatch(matchId, hospitalId, expectedVersion) {
+        return handleResponse(await fetch(`${API_BASE_URL}/matches/${matchId}/approve`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ hospitalId, expectedVersion })
+        }));
+    },
+    async rejectMatch(matchId, hospitalId, reasonCode, reason, expectedVersion) {
+        return handleResponse(await fetch(`${API_BASE_URL}/matches/${matchId}/reject`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ hospitalId, reasonCode, reason, expectedVersion })
+        }));
+    },
+    async cancelMatch(matchId, hospitalId, reasonCode, reason, expectedVersion) {
+        return handleResponse(await fetch(`${API_BASE_URL}/matches/${matchId}/cancel`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ hospitalId, reasonCode, reason, expectedVersion })
+        }));
+    },
+    async confirmTransplant(matchId, transplantData) {
+        return handleResponse(await fetch(`${API_BASE_URL}/matches/${matchId}/transplant`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(transplantData)
+        }));
+    },
+    async updateDonorStatus(donorId, organToRemove, expectedVersion) {
         return handleResponse(await fetch(`${API_BASE_URL}/donors/${donorId}/status`, {
             method: 'PATCH',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ organToRemove })
+            body: JSON.stringify({ organToRemove, expectedVersion })
         }));
     },
     async verifyDonor(donorId, hospitalId, status) {
@@ -74,3 +161,8 @@ export const BLOOD_COMPATIBILITY = {
 };
 
 export const canReceiveFrom = (recipient, donor) => BLOOD_COMPATIBILITY[recipient]?.includes(donor) || false;
+
+// HLA typings come back per locus, e.g. { A: ['02:01', '24'], B: ['35'], ... }.
+export const HLA_LOCI = ['A', 'B', 'C', 'DRB1', 'DQB1'];
+export const hlaAlleles = (hla) => HLA_LOCI.flatMap(locus => (hla?.[locus] || []).map(allele => `${locus}*${allele}`));
+export const formatHLA = (hla) => hlaAlleles(hla).join(', ');
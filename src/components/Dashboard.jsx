@@ -1,12 +1,32 @@
-import React from 'react';
+import React, { useState, useEffect } from 'react';
 import { Users, Activity, Database, ShieldCheck, Server, Link as LinkIcon } from 'lucide-react';
+import { api } from '../api';
 
-const Dashboard = ({ patients, donors }) => {
+const Dashboard = ({ patients, donors, hospitalId }) => {
+    // Tiles come from the ledger's own counts; the loaded lists stand in until they arrive.
+    const [ledgerStats, setLedgerStats] = useState(null);
+
+    useEffect(() => {
+        api.getStats().then(setLedgerStats).catch(() => setLedgerStats(null));
+    }, [patients, donors]);
+
+    // A signed-in hospital's events come from its dashboard, read in a single call.
+    const [hospitalDashboard, setHospitalDashboard] = useState(null);
+
+    useEffect(() => {
+        if (!hospitalId) {
+            setHospitalDashboard(null);
+            return;
+        }
+        api.getHospitalDashboard(hospitalId).then(setHospitalDashboard).catch(() => setHospitalDashboard(null));
+    }, [hospitalId, patients, donors]);
+
+    const count = (fromLedger, fromLists) => (ledgerStats ? fromLedger(ledgerStats) : fromLists);
     const stats = [
-        { label: 'Total Patients', value: patients.length, icon: Users, color: 'text-[#10b981]', bg: 'bg-[#10b981]/5' },
-        { label: 'Active Donors', value: donors.length, icon: Activity, color: 'text-[#059669]', bg: 'bg-[#059669]/5' },
-        { label: 'Pending Matches', value: patients.filter(p => p.status === 'WAITING').length, icon: Database, color: 'text-[#f59e0b]', bg: 'bg-[#f59e0b]/5' },
-        { label: 'Successful Matches', value: patients.filter(p => p.status === 'MATCHED').length, icon: ShieldCheck, color: 'text-[#ef4444]', bg: 'bg-[#ef4444]/5' },
+        { label: 'Total Patients', value: count(s => s.patients.total, patients.length), icon: Users, color: 'text-[#10b981]', bg: 'bg-[#10b981]/5' },
+        { label: 'Active Donors', value: count(s => s.donors.total, donors.length), icon: Activity, color: 'text-[#059669]', bg: 'bg-[#059669]/5' },
+        { label: 'Pending Matches', value: count(s => s.patients.byStatus.WAITING, patients.filter(p => p.status === 'WAITING').length), icon: Database, color: 'text-[#f59e0b]', bg: 'bg-[#f59e0b]/5' },
+        { label: 'Successful Matches', value: count(s => s.patients.byStatus.MATCHED, patients.filter(p => p.status === 'MATCHED').length), icon: ShieldCheck, color: 'text-[#ef4444]', bg: 'bg-[#ef4444]/5' },
     ];
 
     return (
@@ -53,7 +73,15 @@ const Dashboard = ({ patients, donors }) => {
                         Ledger Events
                     </h3>
                     <div className="space-y-4">
-                        {[1, 2, 3].map((i) => (
+                        {hospitalDashboard ? hospitalDashboard.recentActivity.slice(0, 5).map((event) => (
+                            <div key={`${event.type}-${event.entityId}-${event.timestamp}`} className="flex items-center text-sm p-4 bg-white rounded-2xl shadow-sm border border-slate-100 group hover:border-indigo-200 transition-colors">
+                                <div className="flex-1">
+                                    <p className="font-bold text-slate-700">{event.entityId}</p>
+                                    <p className="text-xs text-slate-400 font-medium">{event.type.replace(/_/g, ' ')}</p>
+                                </div>
+                                <span className="text-[10px] font-bold text-slate-400 group-hover:text-indigo-400 transition-colors uppercase tracking-widest">{new Date(event.timestamp).toLocaleString()}</span>
+                            </div>
+                        )) : [1, 2, 3].map((i) => (
                             <div key={i} className="flex items-center text-sm p-4 bg-white rounded-2xl shadow-sm border border-slate-100 group hover:border-indigo-200 transition-colors">
                                 <div className="flex-1">
                                     <p className="font-bold text-slate-700">Tx: {`8f43...a${i}2`}</p>
@@ -5,6 +5,7 @@ const DonorRegistrationForm = ({ onBack, addNotification }) => {
         name: '',
         email: '',
         phone: '',
+        nationalId: '',
         bloodType: '',
         hla: '',
         organs: [],
@@ -48,8 +49,9 @@ const DonorRegistrationForm = ({ onBack, addNotification }) => {
                 name: formData.name,
                 email: formData.email,
                 phone: formData.phone,
+                nationalId: formData.nationalId,
                 bloodType: formData.bloodType,
-                hla: formData.hla || 'Pending medical test',
+                hla: formData.hla,
                 organsAvailable: formData.organs,
                 ipfsHash: '',
                 consentHash: consentHash
@@ -123,6 +125,13 @@ const DonorRegistrationForm = ({ onBack, addNotification }) => {
                     onChange={e => setFormData({ ...formData, phone: e.target.value })}
                     className="px-4 py-3 rounded-xl bg-slate-50 border border-slate-200 focus:bg-white focus:border-rose-400 focus:ring-2 focus:ring-rose-100 outline-none text-sm"
                 />
+                <input
+                    type="text"
+                    placeholder="National ID"
+                    value={formData.nationalId}
+                    onChange={e => setFormData({ ...formData, nationalId: e.target.value })}
+                    className="col-span-2 px-4 py-3 rounded-xl bg-slate-50 border border-slate-200 focus:bg-white focus:border-rose-400 focus:ring-2 focus:ring-rose-100 outline-none text-sm"
+                />
             </div>
 
             <div>
@@ -54,7 +54,7 @@ const DonorRegistry = ({ role, hospitalId, donors, setDonors, addNotification, f
                 hla: formData.hla,
                 organsAvailable: formData.organs,
                 ipfsHash: mockIpfsCid,
-                consentHash: `0x${dataHash.substring(0, 10)}...signed`
+                consentHash: dataHash
             });
 
             // Refresh donors from blockchain
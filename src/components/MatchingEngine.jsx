@@ -1,13 +1,15 @@
 import React, { useState, useEffect } from 'react';
 import { Activity, ShieldCheck, Database, Users, Heart, Server, CheckCircle, Search, Loader2 } from 'lucide-react';
 import { Card } from './UI';
-import { api } from '../api';
+import { api, hlaAlleles } from '../api';
 
-const MatchingEngine = ({ donors, patients, setPatients, setDonors, hospitalId, addNotification, canReceiveFrom }) => {
+const MatchingEngine = ({ patients, setPatients, setDonors, hospitalId, addNotification, canReceiveFrom }) => {
     const [selectedPatient, setSelectedPatient] = useState(null);
     const [matches, setMatches] = useState([]);
     const [isProcessing, setIsProcessing] = useState(false);
     const [loadingStep, setLoadingStep] = useState(0);
+    const [organFilter, setOrganFilter] = useState('');
+    const [waitingList, setWaitingList] = useState([]);
 
     const matchSteps = [
         { text: "Verifying Donor Consent Hash...", icon: ShieldCheck },
@@ -29,19 +31,42 @@ const MatchingEngine = ({ donors, patients, setPatients, setDonors, hospitalId,
         }
     }, [isProcessing]);
 
+    // With an organ chosen the ledger returns that organ's waitlist in allocation order.
+    useEffect(() => {
+        if (!organFilter) {
+            setWaitingList(patients.filter(p => p.status === 'WAITING'));
+            return;
+        }
+        api.getWaitingPatients({ organ: organFilter })
+            .then(setWaitingList)
+            .catch(error => addNotification(`❌ Error: ${error.message}`));
+    }, [organFilter, patients]);
+
     // The "Off-Chain" Matching Algorithm
-    const runMatching = (patient) => {
+    // Candidates are the verified donors the ledger lists for the patient's organ.
+    const runMatching = async (patient) => {
         setSelectedPatient(patient);
 
-        const results = donors.map(donor => {
+        let candidates;
+        try {
+            candidates = await api.getAvailableDonors({ organ: patient.organNeeded });
+        } catch (error) {
+            addNotification(`❌ Error: ${error.message}`);
+            setMatches([]);
+            return;
+        }
+
+        const results = candidates.map(donor => {
             const isVerified = donor.verificationStatus === 'VERIFIED';
             const isBloodCompatible = canReceiveFrom(patient.bloodType, donor.bloodType);
             const isExactBloodMatch = patient.bloodType === donor.bloodType;
             const isOrganCompatible = (donor.organsAvailable || []).includes(patient.organNeeded);
 
-            const patientHla = (patient.hla || '').split(',').map(s => s.trim());
-            const donorHla = (donor.hla || '').split(',').map(s => s.trim());
-            const commonAntigens = patientHla.filter(antigen => donorHla.includes(antigen));
+            // Compare at antigen level, the first field of each allele, as the chaincode does.
+            const antigen = (allele) => allele.split(':')[0];
+            const patientHla = hlaAlleles(patient.hla).map(antigen);
+            const donorHla = hlaAlleles(donor.hla).map(antigen);
+            const commonAntigens = patientHla.filter(a => donorHla.includes(a));
             const hlaRawScore = (commonAntigens.length / Math.max(patientHla.length, 1)) * 100;
 
             const daysWaiting = (new Date() - new Date(patient.createdAt)) / (1000 * 60 * 60 * 24);
@@ -54,6 +79,7 @@ const MatchingEngine = ({ donors, patients, setPatients, setDonors, hospitalId,
 
             return {
                 donorId: donor.id,
+                donorVersion: donor.version || 0,
                 bloodType: donor.bloodType,
                 score: totalScore.toFixed(1),
                 hlaScore: hlaRawScore.toFixed(0),
@@ -85,10 +111,11 @@ const MatchingEngine = ({ donors, patients, setPatients, setDonors, hospitalId,
                 donorId: match.donorId,
                 organType: selectedPatient.organNeeded,
                 hlaScore: match.score,
-                approvedBy: hospitalId || 'ADMIN-HOSP'
+                approvedBy: hospitalId || 'HOSP-ADMIN'
             });
 
-            await api.updateDonorStatus(match.donorId, selectedPatient.organNeeded);
+            // createMatch has just written the donor once, advancing its version.
+            await api.updateDonorStatus(match.donorId, selectedPatient.organNeeded, match.donorVersion + 1);
 
             const [patientsData, donorsData] = await Promise.all([
                 api.getPatients(),
@@ -153,9 +180,22 @@ const MatchingEngine = ({ donors, patients, setPatients, setDonors, hospitalId,
                     <div className="p-4 border-b bg-slate-50">
                         <h3 className="font-semibold text-slate-700">Waiting List</h3>
                         <p className="text-xs text-slate-500">Select a patient to run matching logic</p>
+                        <select
+                            value={organFilter}
+                            onChange={e => setOrganFilter(e.target.value)}
+                            className="mt-2 w-full text-xs border border-slate-200 rounded px-2 py-1 bg-white"
+                        >
+                            <option value="">All organs</option>
+                            {['Kidney', 'Liver', 'Heart', 'Lung', 'Pancreas', 'Intestine', 'Cornea'].map(o => <option key={o} value={o}>{o}</option>)}
+                        </select>
+                        {organFilter && (
+                            <a href={api.waitlistCsvUrl(organFilter)} className="mt-2 inline-block text-xs text-blue-600 hover:underline">
+                                Download {organFilter} waitlist (CSV)
+                            </a>
+                        )}
                     </div>
                     <div className="overflow-y-auto flex-1 p-2 space-y-2">
-                        {patients.filter(p => p.status === 'WAITING').map(p => (
+                        {waitingList.map(p => (
                             <div
                                 key={p.id}
                                 onClick={() => runMatching(p)}
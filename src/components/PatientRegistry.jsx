@@ -1,11 +1,12 @@
 import React, { useState } from 'react';
 import { Lock, UploadCloud, Loader2 } from 'lucide-react';
 import { Card, Badge } from './UI';
-import { api } from '../api';
+import { api, formatHLA } from '../api';
 
 const PatientRegistry = ({ role, hospitalId, patients, setPatients, addNotification }) => {
     const [formData, setFormData] = useState({
         name: '',
+        nationalId: '',
         bloodType: 'A+',
         organNeeded: 'Kidney',
         hla: '',
@@ -39,11 +40,12 @@ const PatientRegistry = ({ role, hospitalId, patients, setPatients, addNotificat
             await api.createPatient({
                 id: patientId,
                 nameHash: nameHash,
+                nationalId: formData.nationalId,
                 bloodType: formData.bloodType,
                 hla: formData.hla,
                 organNeeded: formData.organNeeded,
                 ipfsHash: mockIpfsCid,
-                hospitalId: hospitalId || 'ADMIN-HOSP'
+                hospitalId: hospitalId || 'HOSP-ADMIN'
             });
 
             // Refresh patients from blockchain
@@ -81,6 +83,19 @@ const PatientRegistry = ({ role, hospitalId, patients, setPatients, addNotificat
                                 </p>
                             </div>
 
+                            <div>
+                                <label className="block text-xs font-medium text-slate-500 uppercase mb-1">National ID (Private)</label>
+                                <input
+                                    type="text"
+                                    value={formData.nationalId}
+                                    onChange={e => setFormData({ ...formData, nationalId: e.target.value })}
+                                    className="w-full p-2 border border-slate-300 rounded focus:ring-2 focus:ring-blue-500 outline-none text-sm"
+                                />
+                                <p className="text-xs text-slate-400 mt-1 flex items-center">
+                                    <Lock className="w-3 h-3 mr-1" /> Hashed to flag listings at other hospitals
+                                </p>
+                            </div>
+
                             <div className="grid grid-cols-2 gap-4">
                                 <div>
                                     <label className="block text-xs font-medium text-slate-500 uppercase mb-1">Blood Type</label>
@@ -198,7 +213,7 @@ const PatientRegistry = ({ role, hospitalId, patients, setPatients, addNotificat
                                         <td className="p-3 font-mono text-xs">{p.id}</td>
                                         <td className="p-3"><span className="font-bold text-slate-700">{p.bloodType}</span></td>
                                         <td className="p-3">{p.organNeeded}</td>
-                                        <td className="p-3 text-xs text-slate-500 truncate max-w-[150px]">{p.hla}</td>
+                                        <td className="p-3 text-xs text-slate-500 truncate max-w-[150px]">{formatHLA(p.hla)}</td>
                                         <td className="p-3"><Badge status={p.status} /></td>
                                     </tr>
                                 ))}